@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Default public Piston API endpoint, which does not allow managing packages.
+const DEFAULT_PISTON_URL = piston.DefaultBaseURL
+
+// isAdmin checks if a user is allowed to use admin commands.
+func isAdmin(userID string) bool {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return stringInSlice(userID, ADMIN_IDS)
+}
+
+// adminFollowup sends an ephemeral followup message to an admin command.
+func adminFollowup(s Discord, i *discordgo.InteractionCreate, content string) {
+	_, err := s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending followup message.")
+	}
+}
+
+// Admin command definition.
+var adminCommand = &discordgo.ApplicationCommand{
+	Name:        "admin",
+	Description: "Administrative commands for the bot.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "stats",
+			Description: "Shows usage statistics from the execution history.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+		{
+			Name:        "usage",
+			Description: "Shows executions per day, top languages and users, error rates, and latency over a window of time.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options:     usageOptions,
+		},
+		{
+			Name:        "reload",
+			Description: "Reloads the configuration from the environment file without restarting.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+		{
+			Name:        "runtimes",
+			Description: "Manage the runtimes installed on the Piston instance.",
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "list",
+					Description: "Lists the installed runtimes.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "refresh",
+					Description: "Reloads the supported languages from the installed runtimes.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "install",
+					Description: "Installs a package.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "language",
+							Description: "The language of the package.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+						{
+							Name:        "version",
+							Description: "The version of the package.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "remove",
+					Description: "Removes a package.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "language",
+							Description: "The language of the package.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+						{
+							Name:        "version",
+							Description: "The version of the package.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func adminHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	if !isAdmin(interactionUser(i).ID) {
+		err := s.InteractionRespond(
+			i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: "You are not allowed to use admin commands.",
+					Flags:   discordgo.MessageFlagsEphemeral,
+				},
+			},
+		)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error responding to interaction.")
+		}
+
+		return
+	}
+
+	// Send deferred ephemeral message, telling the user that a response is coming shortly.
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Flags: discordgo.MessageFlagsEphemeral,
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+		return
+	}
+
+	group := i.ApplicationCommandData().Options[0]
+	switch group.Name {
+	case "stats":
+		adminFollowup(s, i, historyStats())
+	case "usage":
+		adminUsageHandler(s, i, group)
+	case "reload":
+		adminReloadHandler(ctx, s, i)
+	case "runtimes":
+		adminRuntimesHandler(s, i, group.Options[0])
+	}
+}
+
+func adminRuntimesHandler(s Discord, i *discordgo.InteractionCreate, cmd *discordgo.ApplicationCommandInteractionDataOption) {
+	if cmd.Name == "list" {
+		runtimes, err := GetRuntimes()
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error getting runtimes.")
+
+			adminFollowup(s, i, fmt.Sprintf("Error getting runtimes.```\n%v\n```", err))
+			return
+		}
+
+		lines := make([]string, len(runtimes))
+		for n, r := range runtimes {
+			lines[n] = fmt.Sprintf("%v %v (%v)", r.Language, r.Version, strings.Join(r.Aliases, ", "))
+		}
+		sort.Strings(lines)
+
+		for _, message := range splitOutput(strings.Join(lines, "\n"), 1000) {
+			adminFollowup(s, i, message)
+		}
+
+		return
+	}
+
+	if cmd.Name == "refresh" {
+		err := loadLanguages()
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error refreshing languages.")
+
+			adminFollowup(s, i, fmt.Sprintf("Error refreshing languages.```\n%v\n```", err))
+			return
+		}
+
+		adminFollowup(s, i, fmt.Sprintf("Refreshed languages. %d languages are supported.", len(getLanguages())))
+		return
+	}
+
+	// Installing and removing packages is only possible on a self-hosted instance.
+	if _, ok := executor.(*piston.Client); !ok || PISTON_URL == DEFAULT_PISTON_URL {
+		adminFollowup(s, i, "Packages can only be managed when the bot uses a self-hosted Piston instance.")
+		return
+	}
+
+	lang := cmd.Options[0].StringValue()
+	version := cmd.Options[1].StringValue()
+
+	var err error
+	var done string
+	switch cmd.Name {
+	case "install":
+		err = InstallPackage(lang, version)
+		done = "Installed"
+	case "remove":
+		err = UninstallPackage(lang, version)
+		done = "Removed"
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("action", cmd.Name).
+			Str("language", lang).
+			Str("version", version).
+			Msg("Error managing package.")
+
+		adminFollowup(s, i, fmt.Sprintf("Error managing package.```\n%v\n```", err))
+		return
+	}
+
+	log.Info().
+		Str("action", cmd.Name).
+		Str("language", lang).
+		Str("version", version).
+		Str("user_id", interactionUser(i).ID).
+		Msg("Package managed.")
+
+	// Make the change to the runtimes available immediately.
+	err = loadLanguages()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error refreshing languages.")
+	}
+
+	adminFollowup(s, i, fmt.Sprintf("%v %v %v.", done, lang, version))
+}
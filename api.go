@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum size of a request to the API.
+const apiMaxRequestSize = 1 << 20
+
+// APIRunRequest is the body of POST /api/run. Either Code or Files must be
+// given.
+type APIRunRequest struct {
+	Language string            `json:"language"`          // required, name or alias of the language
+	Version  string            `json:"version,omitempty"` // defaults to the latest version
+	Code     string            `json:"code,omitempty"`
+	Files    []piston.File     `json:"files,omitempty"`
+	Stdin    string            `json:"stdin,omitempty"`
+	Args     []string          `json:"args,omitempty"` // command line arguments of the program
+	Env      map[string]string `json:"env,omitempty"`  // environment variables, if the executor can set them
+	Raw      bool              `json:"raw,omitempty"`  // don't wrap bare statements in a main function
+}
+
+// APIRunResponse is the result of POST /api/run. Output has control sequences
+// removed, like output posted on Discord.
+type APIRunResponse struct {
+	ID            string  `json:"id"` // ID of the run, shown in the logs
+	Language      string  `json:"language"`
+	Version       string  `json:"version"`
+	Status        string  `json:"status"` // see executionStatus
+	CompileOutput string  `json:"compile_output,omitempty"`
+	Stdout        string  `json:"stdout"`
+	Stderr        string  `json:"stderr"`
+	Code          int     `json:"code"`
+	Signal        string  `json:"signal,omitempty"`
+	Duration      float64 `json:"duration_ms"`
+	CPUTime       int     `json:"cpu_time_ms,omitempty"`
+	Memory        int     `json:"memory,omitempty"` // bytes
+	Cached        bool    `json:"cached,omitempty"`
+}
+
+// apiError is the body of an unsuccessful response of the API.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// parseAPIKeys parses API keys given as comma-separated name:key pairs. The
+// names identify the clients in logs and rate limits.
+func parseAPIKeys(v string) map[string]string {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		keys[parts[0]] = parts[1]
+	}
+	return keys
+}
+
+// apiClient returns the name of the client whose key authorizes a request.
+func apiClient(r *http.Request) (string, bool) {
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if key == "" {
+		return "", false
+	}
+
+	for name, k := range API_KEYS {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// writeJSON responds with a value as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error writing API response.")
+	}
+}
+
+// apiRunHandler runs code for clients outside Discord, through the same
+// executor, queue, rate limiter and cache as commands.
+func apiRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{"Only POST is allowed."})
+		return
+	}
+
+	client, ok := apiClient(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, apiError{"Missing or invalid API key."})
+		return
+	}
+
+	if !shutdown.Begin() {
+		writeJSON(w, http.StatusServiceUnavailable, apiError{"The bot is shutting down."})
+		return
+	}
+	defer shutdown.Done()
+
+	var req APIRunRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxRequestSize)).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{"Invalid request: " + err.Error()})
+		return
+	}
+
+	lang := resolveLanguage(req.Language)
+	if lang == "" {
+		writeJSON(w, http.StatusBadRequest, apiError{"Language " + req.Language + " is not supported."})
+		return
+	}
+	if req.Version != "" && !stringInSlice(req.Version, getLanguageVersions(lang)) {
+		writeJSON(w, http.StatusBadRequest, apiError{"Version " + req.Version + " of " + lang + " is not supported."})
+		return
+	}
+
+	err = checkEnv(req.Env)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{"Invalid environment variables: " + err.Error() + "."})
+		return
+	}
+
+	files := req.Files
+	if req.Code != "" {
+		files = append([]piston.File{{Content: req.Code}}, files...)
+	}
+	if len(files) == 0 {
+		writeJSON(w, http.StatusBadRequest, apiError{"No code given."})
+		return
+	}
+	if !req.Raw {
+		files = applyTemplate(lang, files)
+	}
+
+	// Each client is rate limited like a user in its own server.
+	release, wait, ok := rateLimiter.Acquire("api:"+client, "api:"+client)
+	if !ok {
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		writeJSON(w, http.StatusTooManyRequests, apiError{"Too many requests."})
+		return
+	}
+	defer release()
+
+	commandsReceived.WithLabelValues("api", "").Inc()
+
+	var result *piston.ExecuteResponse
+	releaseSlot, err := execQueue.Acquire(r.Context(), nil)
+	if err == nil {
+		result, err = Execute(r.Context(), ExecRequest{
+			Language: lang,
+			Version:  req.Version,
+			Files:    files,
+			Stdin:    req.Stdin,
+			Args:     req.Args,
+			Env:      req.Env,
+			Limits:   getDefaultLimits(),
+		})
+		releaseSlot()
+	}
+
+	log.Info().
+		Str("client", client).
+		Str("language", lang).
+		Str("status", executionStatus(result, err)).
+		Str("execution_id", executionID(result, err)).
+		Msg("API execution.")
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+
+		status := http.StatusBadGateway
+		if errors.Is(err, piston.ErrTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, apiError{execErrorMessage("code", err)})
+		return
+	}
+
+	res := APIRunResponse{
+		ID:       result.ExecutionID,
+		Language: lang,
+		Version:  result.Version,
+		Status:   executionStatus(result, nil),
+		Stdout:   stripControlSequences(result.Run.Stdout),
+		Stderr:   stripControlSequences(result.Run.Stderr),
+		Code:     result.Run.Code,
+		Signal:   result.Run.Signal,
+		Duration: float64(result.RunTime()) / float64(time.Millisecond),
+		CPUTime:  result.Run.CPUTime,
+		Memory:   result.Run.Memory,
+		Cached:   result.Cached,
+	}
+	if result.Compile != nil {
+		res.CompileOutput = stripControlSequences(result.Compile.Output)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
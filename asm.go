@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Compiles C or C++ code to assembly with the compiler of the runtime. The
+// program is valid as both C and C++.
+const gccAsmProgram = `#include <stdio.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+int main(void) {
+    char dir[] = "/tmp/asmXXXXXX";
+    if (!mkdtemp(dir)) {
+        perror("mkdtemp");
+        return 1;
+    }
+
+    char src[64];
+    snprintf(src, sizeof src, "%s/main.{{ext}}", dir);
+    FILE *f = fopen(src, "w");
+    int c;
+    while ((c = getchar()) != EOF) {
+        fputc(c, f);
+    }
+    fclose(f);
+
+    execlp("{{compiler}}", "{{compiler}}", "-S", "-O{{opt}}", "-masm=intel", "-fno-asynchronous-unwind-tables",
+           "-fno-dwarf2-cfi-asm", "-o", "-", src, (char *)NULL);
+    perror("{{compiler}}");
+    return 1;
+}
+`
+
+// Compiles Go code to assembly with the go command of the runtime, which
+// prints the assembly on stderr.
+const goAsmProgram = `package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+func main() {
+	src, _ := io.ReadAll(os.Stdin)
+	dir, _ := os.MkdirTemp("", "asm")
+	os.WriteFile(filepath.Join(dir, "main.go"), src, 0o644)
+
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-gcflags=-S {{flags}}", "-o", filepath.Join(dir, "main"), "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOCACHE="+filepath.Join(dir, ".cache"), "GOPATH="+filepath.Join(dir, ".gopath"), "GO111MODULE=off")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+	if cmd.Run() != nil {
+		os.Exit(1)
+	}
+}
+`
+
+// Compiles Rust code to assembly with the rustc of the runtime.
+const rustAsmProgram = `use std::io::Read;
+use std::process::{exit, Command};
+
+fn main() {
+    let mut src = String::new();
+    std::io::stdin().read_to_string(&mut src).unwrap();
+
+    let dir = std::env::temp_dir().join(format!("asm{}", std::process::id()));
+    std::fs::create_dir_all(&dir).unwrap();
+    std::fs::write(dir.join("main.rs"), src).unwrap();
+
+    let status = Command::new("rustc")
+        .args(&["--emit", "asm", "-C", "opt-level={{opt}}", "-C", "llvm-args=-x86-asm-syntax=intel", "-o"])
+        .arg(dir.join("main.s"))
+        .arg(dir.join("main.rs"))
+        .status()
+        .unwrap();
+    if !status.success() {
+        exit(1);
+    }
+
+    print!("{}", std::fs::read_to_string(dir.join("main.s")).unwrap());
+}
+`
+
+// asmTool returns the tool that compiles code of a language to assembly at
+// an optimization level from 0 to 3, or false if the language isn't supported.
+func asmTool(lang string, opt string) (Tool, bool) {
+	switch lang {
+	case "c", "c++":
+		compiler, ext := "gcc", "c"
+		if lang == "c++" {
+			compiler, ext = "g++", "cpp"
+		}
+		r := strings.NewReplacer("{{compiler}}", compiler, "{{ext}}", ext, "{{opt}}", opt)
+		return Tool{compiler, lang, r.Replace(gccAsmProgram)}, true
+	case "go":
+		// The Go compiler only has optimizations on or off.
+		flags := ""
+		if opt == "0" {
+			flags = "-N -l"
+		}
+		return Tool{"go build", lang, strings.ReplaceAll(goAsmProgram, "{{flags}}", flags)}, true
+	case "rust":
+		return Tool{"rustc", lang, strings.ReplaceAll(rustAsmProgram, "{{opt}}", opt)}, true
+	}
+	return Tool{}, false
+}
+
+// Matches the assembler directives in the output of gcc and rustc, e.g. ".file" or ".section".
+var asmDirectiveRegex = regexp.MustCompile(`^\s*\.[a-z_]+\b`)
+
+// Matches the lines of the Go compiler output that aren't instructions:
+// hex dumps, relocations, and GC metadata.
+var goAsmNoiseRegex = regexp.MustCompile(`^\s+(0x[0-9a-f]{4}( [0-9a-f]{2})+|rel \d+\+\d+ )|\b(FUNCDATA|PCDATA)\b|^# `)
+
+// trimAssembly removes the lines of assembly that don't help reading it, such
+// as assembler directives and metadata.
+func trimAssembly(lang string, asm string) string {
+	var lines []string
+	for _, line := range strings.Split(asm, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if lang == "go" {
+			if goAsmNoiseRegex.MatchString(line) {
+				continue
+			}
+		} else if asmDirectiveRegex.MatchString(line) && !strings.HasSuffix(strings.TrimSpace(line), ":") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Asm command definition.
+var asmCommand = &discordgo.ApplicationCommand{
+	Name:        "asm",
+	Description: "Shows the assembly of the latest C, C++, Rust, or Go code message.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "optimization",
+			Description: "The optimization level. Defaults to O1.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "O0", Value: "0"},
+				{Name: "O1", Value: "1"},
+				{Name: "O2", Value: "2"},
+				{Name: "O3", Value: "3"},
+			},
+		},
+		{
+			Name:        "directives",
+			Description: "Whether to keep assembler directives and metadata. Defaults to false.",
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Required:    false,
+		},
+		{
+			Name:        "language",
+			Description: "The language of the code.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:        "message",
+			Description: "A link to or the ID of the message to compile. Defaults to the latest code message.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+	},
+}
+
+func asmHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+	options := optionMap(i.ApplicationCommandData().Options)
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	// The code is checked as it was posted.
+	w.Raw = true
+	lang, _, files, ok := getCodeFromChannel(w)
+	if !ok {
+		return
+	}
+
+	opt := "1"
+	if option, ok := options["optimization"]; ok {
+		opt = option.StringValue()
+	}
+
+	t, ok := asmTool(lang, opt)
+	if !ok {
+		w.Error(fmt.Sprintf("Assembly can't be shown for %v code. Supported languages are: c, c++, go, rust", lang))
+		return
+	}
+
+	result, err := runTool(w.Context(), t, files[0].Content, guildLimits(i.GuildID))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Str("compiler", t.Name).
+			Msg("Error executing compiler.")
+
+		w.Error(execErrorMessage(t.Name, err))
+		return
+	}
+
+	if executionStatus(result, nil) != "success" {
+		w.Error(labelOutput("Compilation", splitOutput(fullOutput(result), 1800))[0])
+		return
+	}
+
+	asm := stripControlSequences(result.Run.Stdout)
+	if option, ok := options["directives"]; !ok || !option.BoolValue() {
+		asm = trimAssembly(lang, asm)
+	}
+
+	title := fmt.Sprintf("Assembly (%v, %v, O%v)", lang, t.Name, opt)
+	content := fmt.Sprintf("**%v**\n```x86asm\n%v\n```", title, sanitizeOutput(asm))
+
+	// Long assembly is attached as a file, with the start of it shown.
+	if len(content) > 2000 {
+		link, files := attachLong("main.s", asm)
+		w.Send(&discordgo.WebhookParams{
+			Content: strings.TrimSpace(labelOutput(title, splitOutput(asm, 1800))[0] + "\n" + link),
+			Files:   files,
+		})
+		return
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Content: content,
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum length of the code shown in the audit log.
+const auditCodeLimit = 900
+
+// auditExecution mirrors an execution into the audit log channel of its
+// guild, if it has one, with who ran what, how it ended, and the ID of the
+// run, if any. It is sent in the background so that it doesn't delay the
+// output.
+func auditExecution(s Discord, channelID string, userID string, guildID string, runID string, lang string, files []piston.File, status string) {
+	auditChannel := guildConfigs.Get(guildID).AuditChannel
+	if auditChannel == "" {
+		return
+	}
+
+	code := ""
+	if len(files) > 0 {
+		code = truncate(files[0].Content, auditCodeLimit)
+	}
+
+	color := colorSuccess
+	if status != "success" && !strings.HasPrefix(status, "passed all") {
+		color = colorFailure
+	}
+
+	var footer *discordgo.MessageEmbedFooter
+	if runID != "" {
+		footer = &discordgo.MessageEmbedFooter{
+			Text: "Run " + runID,
+		}
+	}
+
+	go func() {
+		_, err := s.ChannelMessageSendComplex(auditChannel, &discordgo.MessageSend{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Execution",
+					Footer:      footer,
+					Description: fmt.Sprintf("<@%v> ran %v code in <#%v>.", userID, lang, channelID),
+					Color:       color,
+					Fields: []*discordgo.MessageEmbedField{
+						{
+							Name:  "Status",
+							Value: status,
+						},
+						{
+							Name:  "Code",
+							Value: "```\n" + sanitizeOutput(code) + "\n```",
+						},
+					},
+				},
+			},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("channel_id", auditChannel).
+				Str("execution_id", runID).
+				Msg("Error sending to audit log.")
+		}
+	}()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Number of runs of a benchmark when no count is given.
+const defaultBenchmarkRuns = 5
+
+// Benchmark command definition.
+var benchmarkCommand = &discordgo.ApplicationCommand{
+	Name:        "benchmark",
+	Description: "Runs code multiple times and reports timing and memory statistics. Run this command after a code message.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "count",
+			Description: "The number of times to run the code.",
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Required:    false,
+		},
+		{
+			Name:        "language",
+			Description: "The language to run the code in.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:         "version",
+			Description:  "The version of the language to use. Defaults to the latest version.",
+			Type:         discordgo.ApplicationCommandOptionString,
+			Required:     false,
+			Autocomplete: true,
+		},
+	},
+}
+
+// BenchmarkStats are the statistics of multiple runs of the same code.
+type BenchmarkStats struct {
+	Runs      int
+	Failures  int
+	Min       time.Duration
+	Max       time.Duration
+	Total     time.Duration
+	TotalCPU  time.Duration
+	MinMemory int // bytes; 0 if not reported
+	MaxMemory int // bytes; 0 if not reported
+	TotalMem  int
+}
+
+// Add records the result of a run.
+func (b *BenchmarkStats) Add(result *piston.ExecuteResponse) {
+	duration := result.RunTime()
+
+	if b.Runs == 0 || duration < b.Min {
+		b.Min = duration
+	}
+	if duration > b.Max {
+		b.Max = duration
+	}
+	if result.Run.Memory > b.MaxMemory {
+		b.MaxMemory = result.Run.Memory
+	}
+	if result.Run.Memory > 0 && (b.MinMemory == 0 || result.Run.Memory < b.MinMemory) {
+		b.MinMemory = result.Run.Memory
+	}
+	if result.Run.Code != 0 || result.Run.Signal != "" {
+		b.Failures++
+	}
+
+	b.Total += duration
+	b.TotalCPU += time.Duration(result.Run.CPUTime) * time.Millisecond
+	b.TotalMem += result.Run.Memory
+	b.Runs++
+}
+
+// Avg returns the average duration of the runs.
+func (b *BenchmarkStats) Avg() time.Duration {
+	if b.Runs == 0 {
+		return 0
+	}
+	return b.Total / time.Duration(b.Runs)
+}
+
+// AvgCPU returns the average CPU time of the runs.
+func (b *BenchmarkStats) AvgCPU() time.Duration {
+	if b.Runs == 0 {
+		return 0
+	}
+	return b.TotalCPU / time.Duration(b.Runs)
+}
+
+// AvgMemory returns the average memory used by the runs, in bytes.
+func (b *BenchmarkStats) AvgMemory() int {
+	if b.Runs == 0 {
+		return 0
+	}
+	return b.TotalMem / b.Runs
+}
+
+func benchmarkHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	// Get the code to run from the channel.
+	lang, version, files, ok := getCodeFromChannel(w)
+	if !ok {
+		return
+	}
+
+	count := defaultBenchmarkRuns
+	if option, ok := optionMap(i.ApplicationCommandData().Options)["count"]; ok {
+		count = int(option.IntValue())
+	}
+	if count < 1 {
+		count = 1
+	}
+	if max := getBenchmarkMaxRuns(); count > max {
+		count = max
+	}
+
+	// Run the code, waiting in the queue for every run so that benchmarks
+	// don't starve other executions.
+	var stats BenchmarkStats
+	for n := 0; n < count; n++ {
+		var result *piston.ExecuteResponse
+		releaseSlot, err := execQueue.Acquire(w.Context(), nil)
+		if err == nil {
+			result, err = Execute(withoutCache(w.Context()), ExecRequest{
+				Language: lang,
+				Version:  version,
+				Files:    files,
+				Limits:   guildLimits(i.GuildID),
+			})
+			releaseSlot()
+		}
+		if n == 0 {
+			auditExecution(w.Session, i.ChannelID, interactionUser(i).ID, i.GuildID, executionID(result, err), lang, files, executionStatus(result, err))
+		}
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("execution_id", executionID(nil, err)).
+				Msg("Error executing code.")
+
+			w.Error(execErrorMessage("code", err))
+			return
+		}
+
+		// Code that doesn't compile can't be benchmarked.
+		if result.Compile != nil && result.Compile.Code != 0 {
+			w.Send(&discordgo.WebhookParams{
+				Content: labelOutput("Compilation", splitOutput(result.Compile.Output, 500))[0],
+			})
+
+			return
+		}
+
+		stats.Add(result)
+	}
+
+	memory := "Not reported"
+	if stats.MaxMemory > 0 {
+		memory = fmt.Sprintf(
+			"%.2f / %.2f / %.2f MB",
+			float64(stats.MinMemory)/1e6, float64(stats.AvgMemory())/1e6, float64(stats.MaxMemory)/1e6,
+		)
+	}
+	cpu := "Not reported"
+	if stats.TotalCPU > 0 {
+		cpu = stats.AvgCPU().Round(time.Millisecond).String()
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title: fmt.Sprintf("Benchmark (%v, %d runs)", lang, stats.Runs),
+				Fields: []*discordgo.MessageEmbedField{
+					{
+						Name:   "Min",
+						Value:  stats.Min.Round(time.Millisecond).String(),
+						Inline: true,
+					},
+					{
+						Name:   "Avg",
+						Value:  stats.Avg().Round(time.Millisecond).String(),
+						Inline: true,
+					},
+					{
+						Name:   "Max",
+						Value:  stats.Max.Round(time.Millisecond).String(),
+						Inline: true,
+					},
+					{
+						Name:   "Avg CPU Time",
+						Value:  cpu,
+						Inline: true,
+					},
+					{
+						Name:   "Memory (Min / Avg / Max)",
+						Value:  memory,
+						Inline: true,
+					},
+					{
+						Name:   "Failed Runs",
+						Value:  fmt.Sprint(stats.Failures),
+						Inline: true,
+					},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Limits on the blocked patterns of a guild.
+const (
+	maxBlockedPatterns      = 50
+	maxBlockedPatternLength = 200
+)
+
+// Maximum length of the code shown in the mod log.
+const modLogCodeLimit = 900
+
+// Compiled blocked patterns, by pattern.
+var blockedRegexps sync.Map
+
+// compileBlockedPattern compiles a blocked pattern, reusing it if it was
+// compiled before.
+func compileBlockedPattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := blockedRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	blockedRegexps.Store(pattern, re)
+
+	return re, nil
+}
+
+// blockedPattern returns the first blocked pattern of a guild that the code
+// matches, or an empty string if it matches none.
+func blockedPattern(guildID string, files []piston.File) string {
+	for _, pattern := range guildConfigs.Get(guildID).BlockedPatterns {
+		re, err := compileBlockedPattern(pattern)
+		if err != nil {
+			continue
+		}
+
+		for _, f := range files {
+			if re.MatchString(f.Content) {
+				return pattern
+			}
+		}
+	}
+
+	return ""
+}
+
+// checkBlocked checks code against the blocked patterns of a guild before it
+// is run. If it matches one, the violation is logged and reported in the mod
+// log channel of the guild, and true is returned.
+func checkBlocked(s Discord, guildID string, channelID string, userID string, files []piston.File) bool {
+	pattern := blockedPattern(guildID, files)
+	if pattern == "" {
+		return false
+	}
+
+	log.Warn().
+		Str("pattern", pattern).
+		Str("user_id", userID).
+		Str("channel_id", channelID).
+		Str("guild_id", guildID).
+		Msg("Code matches a blocked pattern.")
+	blockedRuns.Inc()
+
+	modLog := guildConfigs.Get(guildID).ModLogChannel
+	if modLog == "" {
+		return true
+	}
+
+	code := ""
+	if len(files) > 0 {
+		code = truncate(files[0].Content, modLogCodeLimit)
+	}
+
+	_, err := s.ChannelMessageSendComplex(modLog, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "Blocked code",
+				Description: fmt.Sprintf("<@%v> tried to run code in <#%v> that matches `%v`.", userID, channelID, pattern),
+				Color:       colorFailure,
+				Fields: []*discordgo.MessageEmbedField{
+					{
+						Name:  "Code",
+						Value: "```\n" + sanitizeOutput(code) + "\n```",
+					},
+				},
+			},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("channel_id", modLog).
+			Msg("Error sending to mod log.")
+	}
+
+	return true
+}
+
+// Blocked checks code against the blocked patterns of the guild before it is
+// run, sending an error if it matches one.
+func (w *ResponseWriter) Blocked(files []piston.File) bool {
+	i := w.Interaction
+	if !checkBlocked(w.Session, i.GuildID, i.ChannelID, interactionUser(i).ID, files) {
+		return false
+	}
+
+	w.Error(tr(i.Locale, "error.blocked"))
+	return true
+}
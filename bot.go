@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"runtime"
 	"strings"
 	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/storage"
 	"github.com/bwmarrin/discordgo"
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
@@ -17,21 +24,93 @@ import (
 )
 
 var (
-	TOKEN            string
-	PISTON_URL       string
-	DOTENV           string
-	GUILD_ID         string
-	BuildVersion     string = "unknown"
-	BuildTime        string = "unknown"
-	GOOS             string = runtime.GOOS
-	ARCH             string = runtime.GOARCH
-	languages        []string
-	languageMappings map[string][]string
+	TOKEN                       string
+	ALLOW_DM_EXECUTION          bool
+	LOG_LEVEL                   string
+	LOG_FORMAT                  string
+	LOG_FILE                    string
+	LOG_FILE_MAX_SIZE           int
+	LOG_FILE_MAX_BACKUPS        int
+	PISTON_URL                  string
+	PISTON_API_KEY              string
+	GITHUB_TOKEN                string
+	PISTON_TIMEOUT              time.Duration
+	PISTON_MAX_RETRIES          int
+	EXECUTOR                    string
+	JUDGE0_URL                  string
+	JUDGE0_API_KEY              string
+	WASI_RUNTIME                string
+	WASI_MODULES_DIR            string
+	DOCKER_BINARY               string
+	DOCKER_IMAGES_FILE          string
+	DOCKER_CPUS                 string
+	DOCKER_MEMORY               int
+	DOTENV                      string
+	GUILD_IDS                   []string
+	DELETE_COMMANDS_ON_SHUTDOWN bool
+	SHARD_COUNT                 int
+	SHARD_ID                    int
+	ADMIN_IDS                   []string
+	USER_COOLDOWN               time.Duration
+	GUILD_CONCURRENCY           int
+	MAX_CONCURRENT_EXECUTIONS   int
+	BENCHMARK_MAX_RUNS          int
+	OUTPUT_FILE_THRESHOLD       int
+	MAX_OUTPUT_PAGES            int
+	DEFAULT_LIMITS              Limits
+	MAX_RUN_TIMEOUT             int    // seconds
+	MAX_INSTALL_TIMEOUT         int    // seconds
+	MAX_CODE_SIZE               int    // bytes; 0 allows code of any size
+	MAX_OUTPUT_SIZE             int    // bytes of each output stream kept by local executors; 0 keeps all
+	DATABASE_FILE               string // SQLite database; if empty, state is stored in the files below
+	REDIS_URL                   string // Redis server sharing state between replicas; if empty, it is kept in memory
+	GUILD_CONFIG_FILE           string
+	USER_PREFS_FILE             string
+	SNIPPETS_FILE               string
+	TAGS_FILE                   string
+	SCAN_DEPTH                  int
+	RUN_EMOJI                   string
+	HISTORY_FILE                string
+	CHALLENGE_FILE              string
+	TEMPLATE_FILE               string
+	REPL_IDLE_TIMEOUT           time.Duration
+	RESULT_CACHE_TTL            time.Duration
+	SHUTDOWN_TIMEOUT            time.Duration
+	HTTP_ADDR                   string
+	API_KEYS                    map[string]string // clients of the HTTP API, by name
+	SLACK_SIGNING_SECRET        string
+	TELEGRAM_TOKEN              string
+	PASTE_URL                   string
+	PASTE_DIR                   string
+	PASTE_RETENTION             time.Duration
+	LANGUAGE_REFRESH_INTERVAL   time.Duration
+	PISTON_PING_INTERVAL        time.Duration
+	STATUSES                    []string // templates of the statuses rotated through, see renderStatus
+	STATUS_INTERVAL             time.Duration
+	BuildVersion                string = "unknown"
+	BuildTime                   string = "unknown"
+	GOOS                        string = runtime.GOOS
+	ARCH                        string = runtime.GOARCH
+	rateLimiter                 *RateLimiter
+	execQueue                   *ExecQueue
+	resultCache                 *ResultCache
+	guildConfigs                *ConfigStore
+	userPrefs                   *PrefsStore
+	snippets                    *SnippetStore
+	tags                        *SnippetStore
+	history                     *HistoryStore
+	challenges                  *ChallengeStore
+	pastes                      *PasteStore // nil unless PASTE_URL is set
+	shutdown                    ShutdownCoordinator
 )
 
-func init() {
-	// Initialize zerolog
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+// loadConfig loads the settings from the environment and opens the stores
+// they name. It is called by main rather than init so that tests can set up
+// what they need themselves.
+func loadConfig() {
+	// Initialize zerolog. It is reconfigured by setupLogging once the
+	// environment has been loaded.
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	zerolog.TimeFieldFormat = time.RFC3339
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	consoleWriter := zerolog.ConsoleWriter{Out: os.Stdout}
@@ -46,7 +125,7 @@ func init() {
 		DOTENV = ".env"
 	}
 
-	err := godotenv.Load(".env")
+	err := godotenv.Load(DOTENV)
 	if err != nil {
 		log.Fatal().
 			Err(err).
@@ -54,6 +133,21 @@ func init() {
 			Msg("Error loading environment file.")
 	}
 
+	LOG_LEVEL = os.Getenv("LOG_LEVEL")
+	if LOG_LEVEL == "" {
+		LOG_LEVEL = "info"
+	}
+	LOG_FORMAT = os.Getenv("LOG_FORMAT")
+	if LOG_FORMAT == "" {
+		LOG_FORMAT = "console"
+	}
+	// Logs are also written to LOG_FILE if it is set, rotated once they reach
+	// LOG_FILE_MAX_SIZE megabytes.
+	LOG_FILE = os.Getenv("LOG_FILE")
+	LOG_FILE_MAX_SIZE = envInt("LOG_FILE_MAX_SIZE", 100)
+	LOG_FILE_MAX_BACKUPS = envInt("LOG_FILE_MAX_BACKUPS", 5)
+	setupLogging()
+
 	TOKEN = os.Getenv("TOKEN")
 	if TOKEN == "" {
 		log.Fatal().
@@ -64,42 +158,393 @@ func init() {
 	if PISTON_URL == "" {
 		log.Info().
 			Msg("PISTON_URL not found in .env file, using default API endpoint.")
-		PISTON_URL = "https://emkc.org/api/v2/piston/"
+		PISTON_URL = DEFAULT_PISTON_URL
 	}
 
-	GUILD_ID = os.Getenv("GUILD_ID")
-	if GUILD_ID == "" {
+	// Sent in the Authorization header, e.g. for instances behind an authenticating proxy.
+	PISTON_API_KEY = os.Getenv("PISTON_API_KEY")
+
+	// Used to fetch gists, which GitHub rate limits more without a token.
+	GITHUB_TOKEN = os.Getenv("GITHUB_TOKEN")
+
+	// A comma-separated list of guilds, or * for every guild the bot is in.
+	GUILD_IDS = parseGuildIDs(os.Getenv("GUILD_ID"))
+	if len(GUILD_IDS) == 0 {
 		log.Info().
 			Msg("GUILD_ID not found in .env file, registering commands globally.")
 	}
 
-	// Load languages.
-	runtimes, err := GetRuntimes()
+	// Keeping the commands on shutdown lets the bot start without creating
+	// them again.
+	DELETE_COMMANDS_ON_SHUTDOWN = envBool("DELETE_COMMANDS_ON_SHUTDOWN", true)
+
+	// Discord recommends the number of shards if SHARD_COUNT isn't set. The
+	// process runs every shard unless SHARD_ID is set.
+	SHARD_COUNT = envInt("SHARD_COUNT", 0)
+	SHARD_ID = envInt("SHARD_ID", -1)
+	if SHARD_ID >= 0 && (SHARD_COUNT == 0 || SHARD_ID >= SHARD_COUNT) {
+		log.Fatal().
+			Int("shard_id", SHARD_ID).
+			Int("shard_count", SHARD_COUNT).
+			Msg("SHARD_ID must be less than SHARD_COUNT, which must be set with it.")
+	}
+
+	if v := os.Getenv("ADMIN_IDS"); v != "" {
+		ADMIN_IDS = strings.Split(v, ",")
+	}
+
+	// Commands that run code can be used in direct messages unless this is false.
+	ALLOW_DM_EXECUTION = envBool("ALLOW_DM_EXECUTION", true)
+
+	USER_COOLDOWN = envDuration("USER_COOLDOWN", 5*time.Second)
+	GUILD_CONCURRENCY = envInt("GUILD_CONCURRENCY", 3)
+	rateLimiter = NewRateLimiter(USER_COOLDOWN, GUILD_CONCURRENCY)
+
+	MAX_CONCURRENT_EXECUTIONS = envInt("MAX_CONCURRENT_EXECUTIONS", 5)
+	execQueue = NewExecQueue(MAX_CONCURRENT_EXECUTIONS)
+
+	OUTPUT_FILE_THRESHOLD = envInt("OUTPUT_FILE_THRESHOLD", 1500)
+
+	// Pages of output in code blocks; guilds can only lower it.
+	MAX_OUTPUT_PAGES = envInt("MAX_OUTPUT_PAGES", 10)
+	// Discord returns at most 100 messages at a time.
+	SCAN_DEPTH = envInt("SCAN_DEPTH", 10)
+	if SCAN_DEPTH < 1 || SCAN_DEPTH > 100 {
+		log.Fatal().
+			Int("scan_depth", SCAN_DEPTH).
+			Msg("SCAN_DEPTH must be between 1 and 100.")
+	}
+
+	// Reacting with this emoji runs a code message. Set to "none" to disable.
+	RUN_EMOJI = os.Getenv("RUN_EMOJI")
+	switch RUN_EMOJI {
+	case "":
+		RUN_EMOJI = "▶️"
+	case "none":
+		RUN_EMOJI = ""
+	}
+
+	BENCHMARK_MAX_RUNS = envInt("BENCHMARK_MAX_RUNS", 10)
+
+	// Default resource limits; zero uses the Piston defaults.
+	DEFAULT_LIMITS = Limits{
+		CompileTimeout:     envInt("COMPILE_TIMEOUT", 0),
+		RunTimeout:         envInt("RUN_TIMEOUT", 0),
+		CompileMemoryLimit: envInt("COMPILE_MEMORY_LIMIT", 0),
+		RunMemoryLimit:     envInt("RUN_MEMORY_LIMIT", 0),
+	}
+
+	// Maximum of the timeout option of /run; guilds can only lower it.
+	MAX_RUN_TIMEOUT = envInt("MAX_RUN_TIMEOUT", 30)
+
+	// Maximum time for installing dependencies; guilds can only lower it.
+	MAX_INSTALL_TIMEOUT = envInt("MAX_INSTALL_TIMEOUT", 60)
+	MAX_CODE_SIZE = envInt("MAX_CODE_SIZE", 64*1024)
+	MAX_OUTPUT_SIZE = envInt("MAX_OUTPUT_SIZE", 64*1024)
+
+	SHUTDOWN_TIMEOUT = envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	REPL_IDLE_TIMEOUT = envDuration("REPL_IDLE_TIMEOUT", 10*time.Minute)
+
+	// Zero disables the cache.
+	RESULT_CACHE_TTL = envDuration("RESULT_CACHE_TTL", time.Minute)
+	resultCache = NewResultCache(RESULT_CACHE_TTL)
+
+	LANGUAGE_REFRESH_INTERVAL = envDuration("LANGUAGE_REFRESH_INTERVAL", 10*time.Minute)
+	PISTON_PING_INTERVAL = envDuration("PISTON_PING_INTERVAL", 30*time.Second)
+
+	// Statuses are separated by "|", e.g. "listening:/run|watching:{servers} servers".
+	if v := os.Getenv("STATUSES"); v != "" {
+		for _, status := range strings.Split(v, "|") {
+			if status = strings.TrimSpace(status); status != "" {
+				STATUSES = append(STATUSES, status)
+			}
+		}
+	}
+	// Zero shows the first status without rotating.
+	STATUS_INTERVAL = envDuration("STATUS_INTERVAL", 5*time.Minute)
+
+	HTTP_ADDR = os.Getenv("HTTP_ADDR")
+	if HTTP_ADDR == "" {
+		log.Info().
+			Msg("HTTP_ADDR not found in .env file, metrics and health checks will not be served.")
+	}
+
+	// The HTTP API is only served to clients with a key.
+	API_KEYS = parseAPIKeys(os.Getenv("API_KEYS"))
+	if len(API_KEYS) > 0 {
+		if HTTP_ADDR == "" {
+			log.Fatal().
+				Msg("API_KEYS requires HTTP_ADDR to serve the API.")
+		}
+
+		httpMux.HandleFunc("/api/run", apiRunHandler)
+	}
+
+	// Code can also be run from other chat platforms.
+	SLACK_SIGNING_SECRET = os.Getenv("SLACK_SIGNING_SECRET")
+	if SLACK_SIGNING_SECRET != "" {
+		if HTTP_ADDR == "" {
+			log.Fatal().
+				Msg("SLACK_SIGNING_SECRET requires HTTP_ADDR to receive commands.")
+		}
+
+		chatAdapters = append(chatAdapters, &SlackAdapter{SigningSecret: SLACK_SIGNING_SECRET})
+	}
+	TELEGRAM_TOKEN = os.Getenv("TELEGRAM_TOKEN")
+	if TELEGRAM_TOKEN != "" {
+		chatAdapters = append(chatAdapters, &TelegramAdapter{Token: TELEGRAM_TOKEN})
+	}
+
+	// Long output is pasted and linked instead of attached if PASTE_URL is
+	// the public URL of the HTTP server.
+	PASTE_URL = os.Getenv("PASTE_URL")
+	PASTE_DIR = os.Getenv("PASTE_DIR")
+	if PASTE_DIR == "" {
+		PASTE_DIR = "pastes"
+	}
+	// Zero keeps pastes forever.
+	PASTE_RETENTION = envDuration("PASTE_RETENTION", 7*24*time.Hour)
+	if PASTE_URL != "" {
+		if HTTP_ADDR == "" {
+			log.Fatal().
+				Msg("PASTE_URL requires HTTP_ADDR to serve pastes.")
+		}
+
+		pastes, err = NewPasteStore(PASTE_DIR, PASTE_URL, PASTE_RETENTION)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("paste_dir", PASTE_DIR).
+				Msg("Error opening paste directory.")
+		}
+		httpMux.Handle("/p/", pastes)
+	}
+
+	// The files are only used to import the existing data when there is a
+	// database.
+	DATABASE_FILE = os.Getenv("DATABASE_FILE")
+	if DATABASE_FILE != "" {
+		database, err = storage.Open(DATABASE_FILE)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("database_file", DATABASE_FILE).
+				Msg("Error opening database.")
+		}
+	}
+
+	REDIS_URL = os.Getenv("REDIS_URL")
+	if REDIS_URL != "" {
+		redisClient, err = connectRedis(REDIS_URL)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("Error connecting to Redis.")
+		}
+	}
+
+	GUILD_CONFIG_FILE = os.Getenv("GUILD_CONFIG_FILE")
+	if GUILD_CONFIG_FILE == "" {
+		GUILD_CONFIG_FILE = "guilds.json"
+	}
+
+	guildConfigs, err = LoadConfigStore(GUILD_CONFIG_FILE)
 	if err != nil {
 		log.Fatal().
 			Err(err).
-			Msg("Error loading languages.")
+			Str("database_file", DATABASE_FILE).
+			Str("guild_config_file", GUILD_CONFIG_FILE).
+			Msg("Error loading guild config file.")
+	}
+
+	USER_PREFS_FILE = os.Getenv("USER_PREFS_FILE")
+	if USER_PREFS_FILE == "" {
+		USER_PREFS_FILE = "prefs.json"
+	}
+
+	userPrefs, err = LoadPrefsStore(USER_PREFS_FILE)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("user_prefs_file", USER_PREFS_FILE).
+			Msg("Error loading user preferences file.")
+	}
+
+	SNIPPETS_FILE = os.Getenv("SNIPPETS_FILE")
+	if SNIPPETS_FILE == "" {
+		SNIPPETS_FILE = "snippets.json"
+	}
+
+	snippets, err = LoadSnippetStore(documentSnippets, SNIPPETS_FILE, maxSnippets)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("snippets_file", SNIPPETS_FILE).
+			Msg("Error loading snippets file.")
+	}
+
+	TAGS_FILE = os.Getenv("TAGS_FILE")
+	if TAGS_FILE == "" {
+		TAGS_FILE = "tags.json"
+	}
+
+	tags, err = LoadSnippetStore(documentTags, TAGS_FILE, maxTags)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("tags_file", TAGS_FILE).
+			Msg("Error loading tags file.")
+	}
+
+	HISTORY_FILE = os.Getenv("HISTORY_FILE")
+	if HISTORY_FILE == "" {
+		HISTORY_FILE = "history.jsonl"
+	}
+
+	history, err = LoadHistoryStore(HISTORY_FILE)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("history_file", HISTORY_FILE).
+			Msg("Error loading history file.")
+	}
+
+	CHALLENGE_FILE = os.Getenv("CHALLENGE_FILE")
+	if CHALLENGE_FILE == "" {
+		CHALLENGE_FILE = "challenges.json"
 	}
-	languages = make([]string, len(*runtimes))
-	languageMappings = make(map[string][]string, len(*runtimes))
 
-	for i, r := range *runtimes {
-		languages[i] = r.Language
-		languageMappings[r.Language] = r.Aliases
+	challenges, err = LoadChallengeStore(CHALLENGE_FILE)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("challenge_file", CHALLENGE_FILE).
+			Msg("Error loading challenge file.")
+	}
+
+	err = loadTranslations()
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Error loading translations.")
+	}
+
+	TEMPLATE_FILE = os.Getenv("TEMPLATE_FILE")
+	templates, err = loadTemplates(TEMPLATE_FILE)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("template_file", TEMPLATE_FILE).
+			Msg("Error loading template file.")
+	}
+
+	PISTON_TIMEOUT = envDuration("PISTON_TIMEOUT", piston.DefaultTimeout)
+	PISTON_MAX_RETRIES = envInt("PISTON_MAX_RETRIES", piston.DefaultMaxRetries)
+	pistonClient = newPistonClient()
+
+	// Choose the backend code is run on.
+	EXECUTOR = os.Getenv("EXECUTOR")
+	JUDGE0_URL = os.Getenv("JUDGE0_URL")
+	JUDGE0_API_KEY = os.Getenv("JUDGE0_API_KEY")
+	WASI_RUNTIME = os.Getenv("WASI_RUNTIME")
+	if WASI_RUNTIME == "" {
+		WASI_RUNTIME = "wasmtime"
+	}
+	WASI_MODULES_DIR = os.Getenv("WASI_MODULES_DIR")
+	if WASI_MODULES_DIR == "" {
+		WASI_MODULES_DIR = "wasm"
+	}
+	DOCKER_BINARY = os.Getenv("DOCKER_BINARY")
+	if DOCKER_BINARY == "" {
+		DOCKER_BINARY = "docker"
+	}
+	DOCKER_IMAGES_FILE = os.Getenv("DOCKER_IMAGES_FILE")
+	DOCKER_CPUS = os.Getenv("DOCKER_CPUS")
+	if DOCKER_CPUS == "" {
+		DOCKER_CPUS = "1"
+	}
+	DOCKER_MEMORY = envInt("DOCKER_MEMORY", 256*1024*1024)
+	executor, err = newExecutor(EXECUTOR)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Error creating executor.")
+	}
+
+	// Load languages.
+	err = loadLanguages()
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Error loading languages.")
 	}
 
 	log.Debug().
-		Strs("languages", languages).
+		Strs("languages", getLanguages()).
 		Str("env_file", DOTENV).
-		Str("token", TOKEN[:10]+strings.Repeat("*", len(TOKEN)-10)).
+		Str("log_level", LOG_LEVEL).
+		Str("log_format", LOG_FORMAT).
+		Str("log_file", LOG_FILE).
+		Int("log_file_max_size", LOG_FILE_MAX_SIZE).
+		Int("log_file_max_backups", LOG_FILE_MAX_BACKUPS).
 		Str("piston_url", PISTON_URL).
-		Str("guild_id", GUILD_ID).
+		Bool("piston_api_key", PISTON_API_KEY != "").
+		Bool("github_token", GITHUB_TOKEN != "").
+		Dur("piston_timeout", PISTON_TIMEOUT).
+		Int("piston_max_retries", PISTON_MAX_RETRIES).
+		Str("executor", EXECUTOR).
+		Str("judge0_url", JUDGE0_URL).
+		Str("wasi_runtime", WASI_RUNTIME).
+		Str("wasi_modules_dir", WASI_MODULES_DIR).
+		Str("docker_binary", DOCKER_BINARY).
+		Str("docker_images_file", DOCKER_IMAGES_FILE).
+		Str("docker_cpus", DOCKER_CPUS).
+		Int("docker_memory", DOCKER_MEMORY).
+		Strs("guild_ids", GUILD_IDS).
+		Int("shard_count", SHARD_COUNT).
+		Int("shard_id", SHARD_ID).
+		Strs("admin_ids", ADMIN_IDS).
+		Bool("allow_dm_execution", ALLOW_DM_EXECUTION).
+		Dur("user_cooldown", USER_COOLDOWN).
+		Int("guild_concurrency", GUILD_CONCURRENCY).
+		Int("max_concurrent_executions", MAX_CONCURRENT_EXECUTIONS).
+		Int("benchmark_max_runs", BENCHMARK_MAX_RUNS).
+		Int("scan_depth", SCAN_DEPTH).
+		Str("run_emoji", RUN_EMOJI).
+		Int("output_file_threshold", OUTPUT_FILE_THRESHOLD).
+		Int("max_output_pages", MAX_OUTPUT_PAGES).
+		Interface("default_limits", DEFAULT_LIMITS).
+		Int("max_run_timeout", MAX_RUN_TIMEOUT).
+		Int("max_install_timeout", MAX_INSTALL_TIMEOUT).
+		Int("max_code_size", MAX_CODE_SIZE).
+		Int("max_output_size", MAX_OUTPUT_SIZE).
+		Str("guild_config_file", GUILD_CONFIG_FILE).
+		Str("snippets_file", SNIPPETS_FILE).
+		Str("history_file", HISTORY_FILE).
+		Str("challenge_file", CHALLENGE_FILE).
+		Str("template_file", TEMPLATE_FILE).
+		Dur("repl_idle_timeout", REPL_IDLE_TIMEOUT).
+		Dur("result_cache_ttl", RESULT_CACHE_TTL).
+		Dur("shutdown_timeout", SHUTDOWN_TIMEOUT).
+		Str("http_addr", HTTP_ADDR).
+		Int("api_clients", len(API_KEYS)).
+		Bool("slack", SLACK_SIGNING_SECRET != "").
+		Bool("telegram", TELEGRAM_TOKEN != "").
+		Str("paste_url", PASTE_URL).
+		Str("paste_dir", PASTE_DIR).
+		Dur("paste_retention", PASTE_RETENTION).
+		Dur("piston_ping_interval", PISTON_PING_INTERVAL).
+		Dur("language_refresh_interval", LANGUAGE_REFRESH_INTERVAL).
+		Strs("statuses", STATUSES).
+		Dur("status_interval", STATUS_INTERVAL).
 		Str("build_version", BuildVersion).
 		Str("build_time", BuildTime).
 		Msg("Configured settings.")
 }
 
 func main() {
+	loadConfig()
+
 	// Create a new Discord session using the provided bot token.
 	dg, err := discordgo.New("Bot " + TOKEN)
 	if err != nil {
@@ -108,69 +553,158 @@ func main() {
 			Msg("Error creating Discord session.")
 	}
 
-	// Add a handler for the bot's status.
-	dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Ready) {
-		s.UpdateListeningStatus("/run")
-	},
-	)
+	count, err := shardCount(dg)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Error getting the number of shards.")
+	}
+
+	// Keep the supported languages up to date.
+	refreshLanguages(LANGUAGE_REFRESH_INTERVAL)
+
+	// Rotate the statuses of the bot.
+	rotateStatuses(STATUS_INTERVAL)
+
+	// Remove expired pastes.
+	if pastes != nil && PASTE_RETENTION > 0 {
+		cleanPastes(time.Hour)
+	}
+
+	// Receive commands from other chat platforms.
+	for _, a := range chatAdapters {
+		a.Start(httpMux)
+	}
+
+	// Serve metrics and health checks.
+	if HTTP_ADDR != "" {
+		health.watchPiston(PISTON_PING_INTERVAL)
+		startHTTPServer(HTTP_ADDR)
+	}
+
+	dispatcher.Use(shutdownMiddleware, recoverMiddleware, contextMiddleware, loggingMiddleware, metricsMiddleware, permissionsMiddleware, dispatcher.rateLimitMiddleware)
 
-	// Add guild messages intent.
-	dg.Identify.Intents = discordgo.IntentsGuildMessages
-
-	// Add handler to run the corresponding function when a command is run.
-	dg.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if h, ok := commandsHandlers[i.ApplicationCommandData().Name]; ok {
-			h(s, i)
-
-			log.Debug().
-				Str("command",
-					i.ApplicationCommandData().Name).
-				Str("user_id",
-					i.Member.User.ID).
-				Str("channel_id",
-					i.ChannelID).
-				Str("guild_id",
-					i.GuildID).
-				Msg("Command recieved.")
+	// Open a websocket connection to Discord for each shard and begin listening.
+	err = openShards(count, func(dg *discordgo.Session) {
+		// Count failed requests to the Discord API.
+		dg.Client.Transport = metricsTransport{base: http.DefaultTransport}
+
+		watchShard(dg)
+		if HTTP_ADDR != "" {
+			health.watchDiscord(dg)
 		}
-	})
 
-	// Open a websocket connection to Discord and begin listening.
-	err = dg.Open()
+		// Add a handler for the bot's status.
+		dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Ready) {
+			updateStatus(s, false)
+		},
+		)
+
+		// Add guild messages intent.
+		// Message content is needed to run edited code messages.
+		dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentMessageContent | discordgo.IntentsGuildMessageReactions
+
+		// Add handler to run the corresponding function when a command is run.
+		dg.AddHandler(dispatcher.Handle)
+
+		// Create the commands in guilds as the bot joins them.
+		dg.AddHandler(guildCreateHandler)
+		dg.AddHandler(guildDeleteHandler)
+
+		// Run code messages again when they are edited.
+		dg.AddHandler(messageUpdateHandler)
+
+		// Run code messages that are reacted to with RUN_EMOJI.
+		dg.AddHandler(reactionHandler)
+
+		// Run the messages posted in REPL threads.
+		dg.AddHandler(replMessageHandler)
+
+		// Offer to run code messages linked in chat.
+		dg.AddHandler(linkMessageHandler)
+
+		// Run code messages replied to with a mention of the bot, for
+		// servers without slash commands.
+		dg.AddHandler(mentionHandler)
+
+		// Run code messages with text commands, in guilds that set a prefix.
+		dg.AddHandler(prefixHandler)
+	})
 	if err != nil {
 		log.Fatal().
 			Err(err).
 			Msg("Error opening Disord connection.")
 	}
+	dg = shards[0]
+
+	// Announce the results of challenges when they end.
+	closeChallenges(dg, time.Minute)
 
-	// Create all commands.
-	createdCommands, err := dg.ApplicationCommandBulkOverwrite(dg.State.User.ID, GUILD_ID, commands)
+	// End idle REPLs.
+	endIdleRepls(dg, time.Minute)
 
+	_, err = registerCommands(dg)
 	if err != nil {
 		log.Fatal().
 			Err(err).
 			Msg("Error creating commands.")
 	}
 
-	// Wait here until CTRL-C or other term signal is received.
+	// Wait here until CTRL-C or other term signal is received, or an admin
+	// uses /shutdown or /restart.
 	log.Info().Msg("Bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sc
+	restart := false
+	select {
+	case <-sc:
+	case restart = <-stopRequests:
+	}
+
+	// Wait for in-flight executions and followups to finish.
+	log.Info().
+		Dur("timeout", SHUTDOWN_TIMEOUT).
+		Msg("Shutting down, waiting for in-flight interactions to finish.")
+
+	if !shutdown.Shutdown(SHUTDOWN_TIMEOUT) {
+		log.Warn().
+			Msg("Timed out waiting for in-flight interactions to finish.")
+	}
+
+	// Delete all commands on shutdown, unless they are kept.
+	unregisterCommands(dg)
+
+	// Cleanly close the Discord sessions.
+	closeShards()
 
-	// Delete all commands on shutdown.
-	for _, cmd := range createdCommands {
-		err := dg.ApplicationCommandDelete(dg.State.User.ID, GUILD_ID, cmd.ID)
+	if redisClient != nil {
+		err = redisClient.Close()
 		if err != nil {
 			log.Error().
 				Err(err).
-				Str("command", cmd.Name).
-				Msg("Error deleting command.")
+				Msg("Error closing Redis client.")
 		}
 	}
 
-	// Cleanly close the Discord session.
-	dg.Close()
+	if database != nil {
+		err = database.Close()
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error closing database.")
+		}
+	}
+
+	if restart {
+		log.Info().Msg("Restarting.")
+
+		err = restartProcess()
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("Error restarting.")
+		}
+	}
 }
 
 var (
@@ -183,14 +717,55 @@ var (
 		{
 			Name:        "run",
 			Description: "Runs code in a language. Run this command in a reply to a code message.",
-			Options: []*discordgo.ApplicationCommandOption{
+			Options: append([]*discordgo.ApplicationCommandOption{
 				{
 					Name:        "language",
 					Description: "The language to run the code in.",
 					Type:        discordgo.ApplicationCommandOptionString,
 					Required:    false,
 				},
-			},
+				{
+					Name:         "version",
+					Description:  "The version of the language to use. Defaults to the latest version.",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:        "message",
+					Description: "A link to or the ID of the message to run. Defaults to the latest code message.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:        "url",
+					Description: "A link to a gist or a file on GitHub to run instead of a message.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:        "raw",
+					Description: "Run the code as is, without wrapping bare statements in a main function.",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Required:    false,
+				},
+				{
+					Name:        "interactive",
+					Description: "Let you give the program input after it runs, running it again with the input.",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Required:    false,
+				},
+				{
+					Name:        "stderr_only",
+					Description: "Only show what the program writes to stderr, to debug noisy programs.",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Required:    false,
+				},
+				envOption,
+				requirementsOption,
+				timeoutOption,
+				collapseOption,
+			}, append(expectOptions, limitsOptions...)...),
 		},
 		{
 			Name:        "help",
@@ -200,24 +775,34 @@ var (
 			Name:        "build_info",
 			Description: "Shows the build info for the bot.",
 		},
+		benchmarkCommand,
+		duelCommand,
+		configCommand,
+		adminCommand,
+		prefsCommand,
+		shutdownCommand,
+		restartCommand,
+		historyCommand,
+		snippetCommand,
+		judgeCommand,
+		challengeCommand,
+		statsCommand,
+		languagesCommand,
+		exampleCommand,
+		tagCommand,
+		leaderboardCommand,
+		replCommand,
+		padCommand,
+		formatCommand,
+		lintCommand,
+		asmCommand,
+		diffCommand,
 	}
 
 	// CommandsHandlers map of all available commands and their corresponding handlers.
-	commandsHandlers = map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
-		"Run Code": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			// Send deferred message, telling the user that a response is coming shortly.
-			err := s.InteractionRespond(
-				i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-				},
-			)
-
-			if err != nil {
-				log.Error().
-					Err(err).
-					Msg("Error responding to interaction.")
-				return
-			}
+	commandsHandlers = map[string]HandlerFunc{
+		"Run Code": func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+			w := NewResponseWriter(ctx, s, i)
 
 			// Get message from ApplicationCommandData.
 			message := i.ApplicationCommandData().
@@ -226,82 +811,116 @@ var (
 
 			// Check if the message is a code message.
 			if !isCodeMessage(message) {
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: "Message is not a code message. Did you remember to wrap your code in backticks (```)?",
-				})
-
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
-
+				w.Error(tr(w.Interaction.Locale, "error.not_code_message"))
 				return
 			}
+			w.Source = message
 
-			// Get the language and code from the message.
-			lang, code := getLanguageAndCodeFromMessage(message)
-
-			if lang != "" {
-				log.Debug().
-					Str("language", lang).
-					Msg("Language found from message.")
-			} else {
-				log.Debug().
-					Msg("No language found from message.")
-
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: "No language provided. Did you remember to put a valid language after the opening backticks? (e.g. ```py)",
-				})
-
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
-
+			// Check that the user is allowed to run code.
+			release, ok := acquireRun(s, i)
+			if !ok {
 				return
 			}
+			defer release()
 
-			// Get output of executed code.
-			output, err := Exec(lang, "", code)
+			// Send deferred message, telling the user that a response is coming shortly.
+			if !w.Defer() {
+				return
+			}
 
-			if err != nil {
-				log.Error().
-					Err(err).
-					Msg("Error executing code.")
+			// Get the language and code from the message, checked and with
+			// its template applied like /run, or use the language the user
+			// prefers.
+			lang, version, files, ok := getCodeFromMessage(w, message, "", "", guildLimits(i.GuildID))
+			if !ok {
+				return
+			}
 
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: fmt.Sprintf("Error executing code.```\n%v\n```", err),
-				})
+			// Execute the code and send the output.
+			runCode(w, lang, version, files, guildLimits(i.GuildID))
+		},
+		"run": func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+			w := NewResponseWriter(ctx, s, i)
 
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
+			if !checkChannel(s, i) {
+				return
+			}
 
+			// Send deferred message, telling the user that a response is coming shortly.
+			if !w.Defer() {
 				return
 			}
 
-			// Split code output into chunks of 500 characters and send them as followup messages.
-			for _, message := range splitOutput(output, 500) {
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: message,
-				})
+			// Get the code to run from the channel.
+			lang, version, files, ok := getCodeFromChannel(w)
+			if !ok {
+				return
+			}
 
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
+			// Check that the user is allowed to run code. This is only done
+			// once the code is found, so asking the user to choose the code
+			// doesn't count as a run.
+			release, ok := acquireDeferredRun(w)
+			if !ok {
+				return
 			}
+			defer release()
+
+			// Execute the code and send the output.
+			runCode(w, lang, version, files, requestedLimits(i))
 		},
-		"run": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			// Send deferred message, telling the user that a response is coming shortly.
+		"help":        helpHandler,
+		"benchmark":   benchmarkHandler,
+		"duel":        duelHandler,
+		"config":      configHandler,
+		"admin":       adminHandler,
+		"prefs":       prefsHandler,
+		"shutdown":    shutdownHandler,
+		"restart":     restartHandler,
+		"history":     historyHandler,
+		"snippet":     snippetHandler,
+		"judge":       judgeHandler,
+		"challenge":   challengeHandler,
+		"stats":       statsHandler,
+		"languages":   languagesHandler,
+		"example":     exampleHandler,
+		"tag":         tagHandler,
+		"leaderboard": leaderboardHandler,
+		"repl":        replHandler,
+		"pad":         padHandler,
+		"format":      formatHandler,
+		"lint":        lintHandler,
+		"asm":         asmHandler,
+		"diff":        diffHandler,
+		"build_info": func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
 			err := s.InteractionRespond(
 				i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: &discordgo.InteractionResponseData{
+						Embeds: []*discordgo.MessageEmbed{
+							{
+								Title: "Build Info",
+								Fields: []*discordgo.MessageEmbedField{
+									{
+										Name:  "Version",
+										Value: BuildVersion,
+									},
+									{
+										Name:  "Time",
+										Value: BuildTime,
+									},
+									{
+										Name:  "Operating System",
+										Value: GOOS,
+									},
+									{
+										Name:  "Architecture",
+										Value: ARCH,
+									},
+								},
+							},
+						},
+					},
 				},
 			)
 
@@ -311,263 +930,749 @@ var (
 					Msg("Error responding to interaction.")
 				return
 			}
+		},
+	}
+)
 
-			// Get last 10 messages in channel.
-			messages, err := s.ChannelMessages(i.ChannelID, 10, "", "", "")
+// Dispatcher of every interaction to its handler.
+var dispatcher = &Dispatcher{
+	Commands:     commandsHandlers,
+	Autocomplete: autocompleteHandlers,
+	Components:   componentsHandlers,
+	Modals:       modalsHandlers,
+	RateLimited:  rateLimitedHandlers,
+}
 
-			if err != nil {
-				log.Error().
-					Err(err).
-					Msg("Error getting messages in channel.")
+// Commands and components that run code as soon as they are handled, which
+// rateLimitMiddleware reserves an execution for. Handlers that check the
+// interaction first, like /run, call acquireRun themselves.
+var rateLimitedHandlers = map[string]bool{
+	"benchmark":   true,
+	"format":      true,
+	"lint":        true,
+	"asm":         true,
+	"diff":        true,
+	"pad_run":     true,
+	"example_run": true,
+}
 
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: "Error getting messages in channel.",
-				})
+// AutocompleteHandlers map of commands with autocompleted options and their corresponding handlers.
+var autocompleteHandlers = map[string]HandlerFunc{
+	"run":       versionAutocomplete,
+	"benchmark": versionAutocomplete,
+	"judge":     versionAutocomplete,
+	"challenge": challengeAutocomplete,
+	"repl":      versionAutocomplete,
+	"prefs":     versionAutocomplete,
+	"snippet":   snippetAutocomplete,
+	"tag":       snippetAutocomplete,
+}
 
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
+// ComponentsHandlers map of all available message components and their corresponding handlers.
+var componentsHandlers = map[string]HandlerFunc{
+	"run_again":        runAgainHandler,
+	"confirm_language": runAgainHandler,
+	"duel_submit":      duelSubmitHandler,
+	"history_output":   historyOutputHandler,
+	"select_code":      selectCodeHandler,
+	"pad_run":          padRunHandler,
+	"page":             pageHandler,
+	"stdin":            stdinHandler,
+	"run_link":         runLinkHandler,
+	"delete_output":    deleteOutputHandler,
+	"example_run":      exampleRunHandler,
+}
 
-				return
-			}
+// ModalsHandlers map of all available modals and their corresponding handlers.
+var modalsHandlers = map[string]HandlerFunc{
+	"duel_solution":    duelSolutionHandler,
+	"judge_cases":      judgeCasesHandler,
+	"challenge_create": challengeCreateModalHandler,
+	"stdin_submit":     stdinSubmitHandler,
+}
 
-			// Check if any of those messages is a code message.
-			message := &discordgo.Message{}
+// versionAutocomplete suggests versions of the language chosen in the command options.
+func versionAutocomplete(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	options := commandOptions(i)
 
-			for _, m := range messages {
-				if isCodeMessage(m) {
-					message = m
-					break
-				}
-			}
+	// Versions can only be suggested once the language is known.
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	if lang, ok := options["language"]; ok {
+		typed := ""
+		if version, ok := options["version"]; ok {
+			typed = version.StringValue()
+		}
 
-			if message.Content == "" {
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: "No code messages found in the last 10 messages. Did you remember to wrap your code in backticks (```)?",
+		for _, v := range getLanguageVersions(lang.StringValue()) {
+			// Discord allows at most 25 choices.
+			if len(choices) == 25 {
+				break
+			}
+			if strings.HasPrefix(v, typed) {
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+					Name:  v,
+					Value: v,
 				})
-
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
-				return
 			}
+		}
+	}
 
-			// Get the language and code from the message.
-			lang, code := getLanguageAndCodeFromMessage(message)
-
-			if len(i.ApplicationCommandData().Options) > 0 {
-				lang = i.ApplicationCommandData().Options[0].StringValue()
-
-				log.Debug().
-					Str("language", lang).
-					Msg("Language found from options.")
-
-				if !stringInSlice(lang, languages) {
-					_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-						Content: fmt.Sprintf("Language %v is not supported. Supported languages are: %v", lang, languages),
-					})
-
-					if err != nil {
-						log.Error().
-							Err(err).
-							Msg("Error sending followup message.")
-					}
-
-					return
-				}
-			} else {
-				log.Debug().
-					Str("language", lang).
-					Msg("Language found from message.")
-			}
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{
+				Choices: choices,
+			},
+		},
+	)
 
-			if lang == "" {
-				log.Debug().
-					Msg("No language found from message.")
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to autocomplete interaction.")
+	}
+}
 
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: "No language provided. Did you remember to put a valid language after the opening backticks? (e.g. ```py)",
-				})
+// getCodeFromChannel finds the code message given in the command options, or
+// the latest code message in the channel of the interaction, and returns its
+// language, version, and files, with the language and version overridden by
+// the command options. If there are multiple code messages, the user of /run
+// is asked to choose one, while other commands use the latest. If no code
+// can be run yet, an error or the choice is sent and ok is false.
+func getCodeFromChannel(w *ResponseWriter) (lang string, version string, files []piston.File, ok bool) {
+	i := w.Interaction
+	options := commandOptions(i)
+
+	if option, found := options["language"]; found {
+		lang = option.StringValue()
+	}
+	if option, found := options["version"]; found {
+		version = option.StringValue()
+	}
+	if option, found := options["raw"]; found && option.BoolValue() {
+		w.Raw = true
+	}
+	if option, found := options["spoiler"]; found {
+		w.Collapse = option.StringValue()
+	}
+	if option, found := options["interactive"]; found && option.BoolValue() {
+		w.Interactive = true
+	}
+	if option, found := options["expect"]; found {
+		w.Expect = option.StringValue()
+	}
+	if option, found := options["compare"]; found {
+		w.Compare = option.StringValue()
+	}
+	if option, found := options["stderr_only"]; found && option.BoolValue() {
+		w.StderrOnly = true
+	}
+	if option, found := options["env"]; found {
+		env, err := parseEnv(option.StringValue())
+		if err != nil {
+			w.Error(fmt.Sprintf("Invalid environment variables: %v.", err))
+			return "", "", nil, false
+		}
+		w.Env = env
+	}
+	if option, found := options["requirements"]; found {
+		if !guildConfigs.Get(i.GuildID).Dependencies {
+			w.Error("Installing packages isn't enabled in this server.")
+			return "", "", nil, false
+		}
 
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
+		deps, err := parseDependencies(option.StringValue())
+		if err != nil {
+			w.Error(fmt.Sprintf("Invalid requirements: %v.", err))
+			return "", "", nil, false
+		}
+		w.Deps = deps
+	}
 
-				return
-			}
+	if option, found := options["url"]; found {
+		return getCodeFromURL(w, option.StringValue(), lang, version, requestedLimits(i))
+	}
 
-			// Get output of executed code.
-			output, err := Exec(lang, "", code)
+	if option, found := options["message"]; found {
+		message, ok := getTargetMessage(w, option.StringValue(), lang)
+		if !ok {
+			return "", "", nil, false
+		}
+		return getCodeFromMessage(w, message, lang, version, requestedLimits(i))
+	}
 
-			if err != nil {
-				log.Error().
-					Err(err).
-					Msg("Error executing code.")
+	messages, ok := getCodeMessages(w, lang)
+	if !ok {
+		return "", "", nil, false
+	}
 
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: fmt.Sprintf("Error executing code.```\n%v\n```", err),
-				})
+	// Choosing a message runs it, so only /run offers the choice.
+	if len(messages) > 1 && i.ApplicationCommandData().Name == "run" {
+		askCodeSelection(w, messages, &codeSelection{
+			UserID:      interactionUser(i).ID,
+			Language:    lang,
+			Version:     version,
+			Raw:         w.Raw,
+			Collapse:    w.Collapse,
+			Interactive: w.Interactive,
+			Expect:      w.Expect,
+			Compare:     w.Compare,
+			StderrOnly:  w.StderrOnly,
+			Env:         w.Env,
+			Deps:        w.Deps,
+			Limits:      requestedLimits(i),
+		})
+		return "", "", nil, false
+	}
 
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
+	return getCodeFromMessage(w, messages[0], lang, version, requestedLimits(i))
+}
 
-				return
-			}
+// getCodeFromMessage returns the language, version, and files of a code
+// message, with the language and version overridden if they are not empty.
+// If no code can be run, an error is sent and ok is false.
+func getCodeFromMessage(w *ResponseWriter, message *discordgo.Message, langOverride string, versionOverride string, limits Limits) (lang string, version string, files []piston.File, ok bool) {
+	w.Source = message
 
-			// Split code output into chunks of 500 characters and send them as followup messages.
-			for _, message := range splitOutput(output, 500) {
-				_, err := s.FollowupMessageCreate(s.State.User.ID, i.Interaction, false, &discordgo.WebhookParams{
-					Content: message,
-				})
+	// Get the language and code from the message.
+	lang, files = getLanguageAndFilesFromMessage(message, w.Interaction.GuildID)
 
-				if err != nil {
-					log.Error().
-						Err(err).
-						Msg("Error sending followup message.")
-				}
-			}
-		},
-		"help": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			err := s.InteractionRespond(
-				i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Embeds: []*discordgo.MessageEmbed{
-							{
-								Title: "Help",
-								Fields: []*discordgo.MessageEmbedField{
-									{
-										Name:  "Run Code",
-										Value: "Right click on any message to run it, if that message is a code message.",
-									},
-									{
-										Name: "`/run [language]`",
-										Value: strings.Join([]string{
-											"Looks for a code message in the last 10 messages in the channel and executes it.",
-											"If the language is not specified, it will try to detect the language from the language specified after the backticks (e.g. \\`\\`\\`py).",
-										}, "\n"),
-									},
-									{
-										Name:  "Supported Languages",
-										Value: strings.Join(languages, ", "),
-									},
-								},
-							},
-						},
-					},
-				},
-			)
+	// Without a code block, inline code is run in the given language.
+	if len(files) == 0 && langOverride != "" {
+		if code := parseInlineCode(message.Content); code != "" {
+			files = []piston.File{{Content: code}}
+		}
+	}
 
-			if err != nil {
-				log.Error().
-					Err(err).
-					Msg("Error responding to interaction.")
-				return
-			}
-		},
-		"build_info": func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-			err := s.InteractionRespond(
-				i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Embeds: []*discordgo.MessageEmbed{
-							{
-								Title: "Build Info",
-								Fields: []*discordgo.MessageEmbedField{
-									{
-										Name:  "Version",
-										Value: BuildVersion,
-									},
-									{
-										Name:  "Time",
-										Value: BuildTime,
-									},
-									{
-										Name:  "Operating System",
-										Value: GOOS,
-									},
-									{
-										Name:  "Architecture",
-										Value: ARCH,
-									},
-								},
-							},
-						},
-					},
-				},
-			)
+	return checkCode(w, lang, files, langOverride, versionOverride, limits)
+}
 
-			if err != nil {
-				log.Error().
-					Err(err).
-					Msg("Error responding to interaction.")
-				return
-			}
-		},
+// getCodeFromURL returns the language, version, and files of a gist or a
+// file on GitHub, like getCodeFromMessage.
+func getCodeFromURL(w *ResponseWriter, url string, langOverride string, versionOverride string, limits Limits) (lang string, version string, files []piston.File, ok bool) {
+	if !isCodeURL(url) {
+		w.Error(tr(w.Interaction.Locale, "error.invalid_url"))
+		return "", "", nil, false
 	}
-)
 
-func isCodeMessage(m *discordgo.Message) bool {
-	// Split on newlines.
-	c := strings.Split(strings.ReplaceAll(m.Content, "\r\n", "\n"), "\n")
+	lang, files, err := fetchCode(w.Context(), url)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("url", url).
+			Msg("Error fetching code.")
 
-	// Check if the number of lines is greater than 1.
-	if len(c) < 2 {
-		return false
+		w.Error(tr(w.Interaction.Locale, "error.fetch_url", err))
+		return "", "", nil, false
 	}
 
-	// Check if the first line starts with 3 backticks, and the last line is 3 backticks.
-	return c[0][:3] == "```" && c[len(c)-1] == "```"
+	return checkCode(w, lang, files, langOverride, versionOverride, limits)
 }
 
-func getLanguageAndCodeFromMessage(m *discordgo.Message) (string, string) {
-	// Split on newlines.
-	c := strings.Split(strings.ReplaceAll(m.Content, "\r\n", "\n"), "\n")
-
-	// Get language from first line.
-	for i, j := range languageMappings {
-		test := c[0][3:]
-		code := strings.Join(c[1:len(c)-1], "\n")
-		if strings.EqualFold(test, i) {
-			return i, code
-		}
-		for _, k := range j {
-			// Check if the language in the first line is a valid language.
-			if strings.EqualFold(k, test) {
-				return i, code
-			}
+// checkCode checks that code in a language can be run, with the language and
+// version overridden if they are not empty, and returns the files to run.
+// If it can't be run, an error is sent and ok is false.
+func checkCode(w *ResponseWriter, lang string, files []piston.File, langOverride string, versionOverride string, limits Limits) (string, string, []piston.File, bool) {
+	var version string
+
+	if langOverride != "" {
+		lang = langOverride
+		if resolved := resolveGuildLanguage(w.Interaction.GuildID, langOverride); resolved != "" {
+			lang = resolved
+		}
+
+		log.Debug().
+			Str("language", lang).
+			Msg("Language found from options.")
+
+		if !stringInSlice(lang, getLanguages()) {
+			w.Error(tr(w.Interaction.Locale, "error.language_unsupported", lang, getLanguages()))
+
+			return "", "", nil, false
 		}
+	} else {
+		log.Debug().
+			Str("language", lang).
+			Msg("Language found from code.")
+	}
+
+	// Use the language the user prefers, and their version of it.
+	preferredLang, preferredVersion := preferredLanguage(interactionUser(w.Interaction).ID)
+	if lang == "" {
+		lang = preferredLang
+	}
+	if versionOverride == "" && lang == preferredLang {
+		versionOverride = preferredVersion
+	}
+
+	if lang == "" {
+		log.Debug().
+			Msg("No language found from code.")
+
+		// Suggest a language detected from the code.
+		if suggestLanguage(w, files, limits) {
+			return "", "", nil, false
+		}
+
+		w.Error(tr(w.Interaction.Locale, "error.no_language"))
+
+		return "", "", nil, false
 	}
 
-	return "", strings.Join(c[1:len(c)-1], "\n")
+	// Use the latest version, unless a version is specified.
+	version = versionOverride
+	if version != "" && !stringInSlice(version, getLanguageVersions(lang)) {
+		w.Error(tr(w.Interaction.Locale, "error.version_unsupported", version, lang, getLanguageVersions(lang)))
+
+		return "", "", nil, false
+	}
+
+	if w.Blocked(files) {
+		return "", "", nil, false
+	}
+
+	// Wrap bare statements in a complete program, unless the code is run as is.
+	if !w.Raw {
+		files = applyTemplate(lang, files)
+	}
+
+	return lang, version, files, true
+}
+
+// getCodeMessages finds the code messages in the last SCAN_DEPTH messages in
+// the channel of the interaction, newest first. Messages with inline code
+// are included if the language is given. If there are none, an error is
+// sent and ok is false.
+func getCodeMessages(w *ResponseWriter, lang string) ([]*discordgo.Message, bool) {
+	if !checkHistoryChannel(w) {
+		return nil, false
+	}
+
+	// Get the last messages in channel.
+	scanDepth := getScanDepth()
+	messages, err := w.Session.ChannelMessages(w.Interaction.ChannelID, scanDepth, "", "", "", discordgo.WithContext(w.Context()))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error getting messages in channel.")
+
+		w.Error(tr(w.Interaction.Locale, "error.channel_messages"))
+		return nil, false
+	}
+
+	// Keep the code messages, including the message a thread was started from.
+	var code []*discordgo.Message
+	for _, m := range messages {
+		m = resolveStarterMessage(w.Session, m)
+		if canRunMessage(m, lang) {
+			code = append(code, m)
+		}
+	}
+
+	if len(code) == 0 {
+		w.Error(tr(w.Interaction.Locale, "error.no_code_messages", scanDepth))
+		return nil, false
+	}
+
+	return code, true
+}
+
+// Matches a message link, e.g. "https://discord.com/channels/<guild>/<channel>/<message>".
+var messageLinkRegex = regexp.MustCompile(`^https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(\d+|@me)/(\d+)/(\d+)$`)
+
+// Matches a message ID.
+var messageIDRegex = regexp.MustCompile(`^\d+$`)
+
+// getTargetMessage fetches the code message referenced by a link or an ID in
+// the channel of the interaction. Links must point to the same server, to a
+// channel the user can read and code can be run from. If the message can't
+// be run in the language, which may be empty, an error is sent and ok is
+// false.
+func getTargetMessage(w *ResponseWriter, ref string, lang string) (*discordgo.Message, bool) {
+	ref = strings.TrimSpace(ref)
+	channelID, messageID := w.Interaction.ChannelID, ref
+
+	if match := messageLinkRegex.FindStringSubmatch(ref); match != nil {
+		// Links to messages in direct messages have @me instead of a guild ID.
+		if match[1] != w.Interaction.GuildID && !(match[1] == "@me" && w.Interaction.GuildID == "") {
+			w.Error(tr(w.Interaction.Locale, "error.other_server"))
+			return nil, false
+		}
+		channelID, messageID = match[2], match[3]
+	} else if !messageIDRegex.MatchString(ref) {
+		w.Error(tr(w.Interaction.Locale, "error.invalid_message"))
+		return nil, false
+	}
+
+	// The bot can read channels the user can't, so code from other channels
+	// is only run for users who could see it, like linked code.
+	if channelID != w.Interaction.ChannelID {
+		i := w.Interaction
+		if i.GuildID == "" || !canReadChannel(w.Session, interactionUser(i).ID, channelID) {
+			w.Error(tr(i.Locale, "error.hidden_channel"))
+			return nil, false
+		}
+		if !guildConfigs.Get(i.GuildID).ChannelAllowed(channelID, threadParent(w.Session, channelID)) {
+			w.Error(tr(i.Locale, "error.target_channel_disabled"))
+			return nil, false
+		}
+	}
+
+	message, err := w.Session.ChannelMessage(channelID, messageID, discordgo.WithContext(w.Context()))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("channel_id", channelID).
+			Str("message_id", messageID).
+			Msg("Error getting message.")
+
+		w.Error(tr(w.Interaction.Locale, "error.message_not_found"))
+		return nil, false
+	}
+
+	message = resolveStarterMessage(w.Session, message)
+	if !canRunMessage(message, lang) {
+		w.Error(tr(w.Interaction.Locale, "error.not_code_message"))
+		return nil, false
+	}
+
+	return message, true
+}
+
+// runCode executes the code and sends the output as the response to the
+// interaction, with followup messages for output that doesn't fit. A button
+// to run the code again is attached to the last message.
+func runCode(w *ResponseWriter, lang string, version string, files []piston.File, limits Limits) {
+	s, i := w.Session, w.Interaction
+
+	// Wait for an execution slot, showing the queue position in the deferred response.
+	queued := false
+	release, err := execQueue.Acquire(w.Context(), func(position int) {
+		queued = true
+
+		content := tr(i.Locale, "status.queued", position)
+		_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error editing interaction response.")
+		}
+	})
+	if err != nil {
+		// The interaction can no longer be responded to.
+		log.Warn().
+			Err(err).
+			Str("interaction_id", i.ID).
+			Msg("Interaction expired while waiting for an execution slot.")
+		return
+	}
+
+	if queued {
+		content := tr(i.Locale, "status.running")
+		_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error editing interaction response.")
+		}
+	}
+
+	// Tell the user when the executor is busy and the request is retried.
+	ctx := piston.WithRetryFunc(w.Context(), func(retry int, wait time.Duration) {
+		content := tr(i.Locale, "status.retrying", wait.Round(time.Second/10), retry, PISTON_MAX_RETRIES)
+		_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error editing interaction response.")
+		}
+	})
+
+	// Get output of executed code.
+	result, err := Execute(ctx, ExecRequest{
+		Language: lang,
+		Version:  version,
+		Files:    files,
+		Stdin:    w.Stdin,
+		Env:      w.Env,
+		Limits:   limits,
+
+		Dependencies:   w.Deps,
+		Install:        guildConfigs.Get(i.GuildID).Dependencies,
+		InstallTimeout: guildInstallTimeout(i.GuildID) * 1000,
+	})
+	release()
+	recordExecution(i.ID, interactionUser(i).ID, i.GuildID, lang, version, files, result, err)
+	auditExecution(w.Session, i.ChannelID, interactionUser(i).ID, i.GuildID, executionID(result, err), lang, files, executionStatus(result, err))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+
+		w.Error(execErrorMessage("code", err))
+		return
+	}
+
+	// Store the code so that it can be run again from the button.
+	storeRun(i.ID, storedRun{
+		Language: lang,
+		Version:  version,
+		Files:    files,
+		Env:      w.Env,
+		Deps:     w.Deps,
+		Limits:   limits,
+	})
+
+	collapse := outputCollapse(i.GuildID, w.Collapse)
+	spoiler := collapse == OutputCollapseSpoiler
+	shown := result
+	if w.StderrOnly {
+		shown = stderrOnly(result)
+	}
+	messages := renderOutput(shown, i.ID, interactionUser(i).ID, i.GuildID, limits, spoiler)
+
+	// Check the output against the expected output once the output is sent.
+	if w.Expect != "" {
+		defer w.Send(expectedOutputMessage(result, w.Expect, w.Compare))
+	}
+
+	// Let the user give more input to programs that wait for it.
+	if w.Interactive || awaitsInput(result) {
+		storeInteractiveRun(i.ID, interactiveRun{
+			UserID:      interactionUser(i).ID,
+			Stdin:       w.Stdin,
+			Interactive: w.Interactive,
+		})
+		addInputButton(messages, i.ID)
+	}
+
+	// Post the output in a thread off the response, below how the code exited.
+	if collapse == OutputCollapseThread {
+		m := w.Send(&discordgo.WebhookParams{
+			Content: resultFooter(result),
+		})
+		if m != nil && postInThread(w.Session, m.ChannelID, m.ID, outputThreadName(lang), messages) {
+			scheduleCleanup(w.Session, i.GuildID, i.ChannelID, []string{m.ID})
+			return
+		}
+	}
+
+	// Send the output, keeping track of the messages so they can be updated.
+	var sent []string
+	for _, params := range messages {
+		if m := w.Send(params); m != nil {
+			sent = append(sent, m.ID)
+		}
+	}
+	scheduleCleanup(w.Session, i.GuildID, i.ChannelID, sent)
+
+	// Run the code again when its message is edited.
+	if w.Source != nil {
+		watchEdits(w.Source, i.Interaction, sent, lang, version, limits, spoiler)
+	}
+}
+
+// runEmojiHelp describes running code with a reaction, if it is enabled.
+func runEmojiHelp(locale discordgo.Locale) string {
+	runEmoji := getRunEmoji()
+	if runEmoji == "" {
+		return ""
+	}
+	return tr(locale, "help.run_emoji", runEmoji)
 }
 
+// respondEphemeral responds to an interaction with a message only visible to its user.
+func respondEphemeral(s Discord, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// isCodeMessage checks if a message has a fenced code block, anywhere in it.
+func isCodeMessage(m *discordgo.Message) bool {
+	return len(parseCodeBlocks(m.Content)) > 0
+}
+
+// canRunMessage checks if the code of a message can be run in a language.
+// Inline code can only be run when the language is given.
+func canRunMessage(m *discordgo.Message, lang string) bool {
+	return isCodeMessage(m) || (lang != "" && parseInlineCode(m.Content) != "")
+}
+
+// splitOutput splits output into code blocks of at most limit characters
+// each, fences included. Chunks are split at the end of a line if they can
+// be, otherwise between characters, keeping combining marks and emoji
+// sequences whole, and no output is lost.
 func splitOutput(output string, limit int) []string {
-	// Initialize slice of messages.
+	// Make sure the output can't break out of the code blocks.
+	output = sanitizeOutput(output)
+
+	// Leave room for the fences and the newlines around each chunk.
+	size := limit - len("```\n\n```")
+
 	var messages []string
+	for {
+		chunk, rest := splitChunk(output, size)
+		messages = append(messages, "```\n"+chunk+"\n```")
+		if rest == "" {
+			return messages
+		}
+		output = rest
+	}
+}
+
+// splitChunk splits at most size characters off a string, at the last line
+// break in the second half of the chunk, which is dropped since the chunks
+// are on separate lines. Long lines are split, moving the split back to keep
+// characters joined to the previous one together.
+func splitChunk(s string, size int) (chunk string, rest string) {
+	if size < 1 {
+		size = 1
+	}
+
+	// Find the byte offset of the character after the chunk.
+	end, n := 0, 0
+	for end < len(s) && n < size {
+		_, width := utf8.DecodeRuneInString(s[end:])
+		end += width
+		n++
+	}
+	if end == len(s) {
+		return s, ""
+	}
+
+	// Avoid short chunks by only splitting at a line break past the middle.
+	// The line break can be right after the chunk, since it is dropped.
+	if nl := strings.LastIndex(s[:end+1], "\n"); nl >= end/2 && nl > 0 {
+		return s[:nl], s[nl+1:]
+	}
+
+	for split := end; split > 0; {
+		next, _ := utf8.DecodeRuneInString(s[split:])
+		previous, width := utf8.DecodeLastRuneInString(s[:split])
+		if !joinsPrevious(next) && previous != zeroWidthJoiner {
+			return s[:split], s[split:]
+		}
+		split -= width
+	}
+
+	// The chunk is a single sequence of joined characters, so it is split
+	// anyway.
+	return s[:end], s[end:]
+}
+
+// Joins emoji into a single emoji, e.g. in family emoji.
+const zeroWidthJoiner = '\u200d'
+
+// joinsPrevious checks if a character is displayed as part of the character
+// before it, like accents and emoji modifiers.
+func joinsPrevious(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me) ||
+		r == zeroWidthJoiner ||
+		(r >= 0xfe00 && r <= 0xfe0f) || // variation selectors
+		(r >= 0x1f3fb && r <= 0x1f3ff) // skin tones
+}
+
+// fullOutput returns all output of the code, with the compiler output in its own section.
+func fullOutput(result *piston.ExecuteResponse) string {
+	if result.Compile == nil || result.Compile.Output == "" {
+		return result.Run.Output
+	}
 
-	// Remove the 6 backticks and 2 newlines from the limit.
-	codeLimit := limit - 8
+	full := "Compilation:\n" + result.Compile.Output
+	if result.Compile.Code == 0 {
+		full += "\n\nOutput:\n" + result.Run.Output
+	}
+	return full
+}
+
+// labelOutput adds a bold label before the first chunk of output.
+func labelOutput(label string, chunks []string) []string {
+	chunks[0] = "**" + label + "**\n" + chunks[0]
+	return chunks
+}
+
+// resultFooter describes how the code exited, how long it took, and the
+// resources it used, to be posted below the output.
+func resultFooter(result *piston.ExecuteResponse) string {
+	return "`" + resultStats(result) + "`"
+}
+
+// resultSummary describes how the code exited and how long it took.
+func resultSummary(result *piston.ExecuteResponse) string {
+	stage := result.Run
+	if result.Compile != nil && result.Compile.Code != 0 {
+		stage = *result.Compile
+	}
+
+	var status string
+	switch {
+	case stage.Status == "TO":
+		status = "Timed out"
+	case stage.Signal != "":
+		status = "Killed by " + stage.Signal
+	default:
+		status = fmt.Sprintf("Exit code %d", stage.Code)
+	}
+
+	if result.Compile != nil && result.Compile.Code != 0 {
+		status = "Compilation failed: " + strings.ToLower(status[:1]) + status[1:]
+	}
 
-	// While the output is larger than the limit, add limit-sized chunks to the slice.
-	for len(output) > limit {
-		messages = append(messages, "```\n"+output[:codeLimit]+"\n```")
-		output = output[limit:]
+	duration := result.Duration
+	if stage.WallTime > 0 {
+		duration = time.Duration(stage.WallTime) * time.Millisecond
 	}
 
-	// Add the remaining output to the slice.
-	messages = append(messages, "```\n"+output+"\n```")
+	summary := fmt.Sprintf("%v | %v", status, duration.Round(time.Millisecond))
+	if result.Cached {
+		summary += " | Cached"
+	}
+	return summary
+}
 
-	return messages
+// optionMap maps command options by their name.
+func optionMap(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	m := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, option := range options {
+		m[option.Name] = option
+	}
+	return m
+}
+
+// commandOptions maps the options of a command by name, looking inside its
+// subcommand if it has one.
+func commandOptions(i *discordgo.InteractionCreate) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	options := i.ApplicationCommandData().Options
+	for len(options) == 1 && (options[0].Type == discordgo.ApplicationCommandOptionSubCommand || options[0].Type == discordgo.ApplicationCommandOptionSubCommandGroup) {
+		options = options[0].Options
+	}
+	return optionMap(options)
 }
 
 func stringInSlice(s string, a []string) bool {
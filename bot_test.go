@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog"
+)
+
+// fakeExecutor runs Python, printing the code it was given.
+type fakeExecutor struct {
+	mu       sync.Mutex
+	requests []piston.ExecuteRequest
+}
+
+func (e *fakeExecutor) Runtimes(ctx context.Context) ([]piston.Runtime, error) {
+	return []piston.Runtime{{Language: "python", Version: "3.10.0", Aliases: []string{"py"}}}, nil
+}
+
+func (e *fakeExecutor) Execute(ctx context.Context, req piston.ExecuteRequest) (*piston.ExecuteResponse, error) {
+	e.mu.Lock()
+	e.requests = append(e.requests, req)
+	e.mu.Unlock()
+
+	output := req.Files[0].Content + "\n"
+	return &piston.ExecuteResponse{
+		Language: req.Language,
+		Version:  req.Version,
+		Run: piston.ExecuteResults{
+			Stdout: output,
+			Output: output,
+		},
+	}, nil
+}
+
+var testExecutor = &fakeExecutor{}
+
+// TestMain sets up the bot like loadConfig does, with its stores in a
+// temporary directory and code run by testExecutor.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "coderunner-test-")
+	if err != nil {
+		panic(err)
+	}
+
+	code := func() int {
+		defer os.RemoveAll(dir)
+
+		setupTest(dir)
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+func setupTest(dir string) {
+	var err error
+
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	ALLOW_DM_EXECUTION = true
+	SCAN_DEPTH = 10
+	OUTPUT_FILE_THRESHOLD = 1500
+	MAX_OUTPUT_PAGES = 10
+	MAX_RUN_TIMEOUT = 30
+	MAX_CODE_SIZE = 64 * 1024
+
+	rateLimiter = NewRateLimiter(0, 100)
+	execQueue = NewExecQueue(1)
+	resultCache = NewResultCache(0)
+
+	guildConfigs, err = LoadConfigStore(filepath.Join(dir, "guilds.json"))
+	if err == nil {
+		userPrefs, err = LoadPrefsStore(filepath.Join(dir, "prefs.json"))
+	}
+	if err == nil {
+		history, err = LoadHistoryStore(filepath.Join(dir, "history.jsonl"))
+	}
+	if err == nil {
+		err = loadTranslations()
+	}
+	if err == nil {
+		templates, err = loadTemplates("")
+	}
+	if err == nil {
+		executor = testExecutor
+		err = loadLanguages()
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// newCommand returns the interaction of a command used in a guild channel
+// where the bot has every permission.
+func newCommand(name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			ID:             "1000",
+			Type:           discordgo.InteractionApplicationCommand,
+			GuildID:        "guild",
+			ChannelID:      "channel",
+			AppPermissions: discordgo.PermissionAdministrator,
+			Member: &discordgo.Member{
+				User: &discordgo.User{ID: "user"},
+			},
+			Data: discordgo.ApplicationCommandInteractionData{
+				Name:    name,
+				Options: options,
+			},
+		},
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	s := newFakeDiscord(
+		&discordgo.Message{ID: "2", Content: "no code here"},
+		&discordgo.Message{ID: "1", Content: "```py\nprint('hi')\n```", Author: &discordgo.User{ID: "user"}},
+	)
+
+	commandsHandlers["run"](context.Background(), s, newCommand("run"))
+
+	if len(s.responses) != 1 || s.responses[0].Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Fatalf("expected a deferred response, got %+v", s.responses)
+	}
+
+	output := strings.Join(s.contents(), "\n")
+	if !strings.Contains(output, "print('hi')") {
+		t.Errorf("expected the output of the code message, got %q", output)
+	}
+
+	testExecutor.mu.Lock()
+	defer testExecutor.mu.Unlock()
+	last := testExecutor.requests[len(testExecutor.requests)-1]
+	if last.Language != "python" || last.Version != "3.10.0" {
+		t.Errorf("expected python 3.10.0 to be run, got %v %v", last.Language, last.Version)
+	}
+}
+
+func TestRunCommandWithoutCode(t *testing.T) {
+	s := newFakeDiscord(&discordgo.Message{ID: "1", Content: "no code here"})
+
+	commandsHandlers["run"](context.Background(), s, newCommand("run"))
+
+	output := strings.Join(s.contents(), "\n")
+	if want := tr("", "error.no_code_messages", SCAN_DEPTH); !strings.Contains(output, want) {
+		t.Errorf("expected %q, got %q", want, output)
+	}
+}
+
+func TestSplitChunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		size  int
+		chunk string
+		rest  string
+	}{
+		{"fits", "abc", 5, "abc", ""},
+		{"exact size", "abcde", 5, "abcde", ""},
+		{"line break past the middle", "abc\ndef", 5, "abc", "def"},
+		{"line break after the chunk", "abcde\nfg", 5, "abcde", "fg"},
+		{"line break before the middle", "a\nbcdefgh", 6, "a\nbcde", "fgh"},
+		{"line longer than the size", "abcdefgh", 3, "abc", "defgh"},
+		{"size counts characters", "héllo wörld", 4, "héll", "o wörld"},
+		{"multi-byte character at the split", "ab😀cd", 3, "ab😀", "cd"},
+		{"accent after the split", "abe\u0301cd", 3, "ab", "e\u0301cd"},
+		{"skin tone after the split", "ab\U0001F44D\U0001F3FDcd", 3, "ab", "\U0001F44D\U0001F3FDcd"},
+		{"joined emoji at the split", "a\U0001F468\u200d\U0001F469cd", 3, "a", "\U0001F468\u200d\U0001F469cd"},
+		{"only joined characters", "e\u0301\u0301\u0301", 2, "e\u0301", "\u0301\u0301"},
+		{"size below 1", "ab", 0, "a", "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk, rest := splitChunk(tt.s, tt.size)
+			if chunk != tt.chunk || rest != tt.rest {
+				t.Errorf("splitChunk(%q, %d) = %q, %q, expected %q, %q", tt.s, tt.size, chunk, rest, tt.chunk, tt.rest)
+			}
+		})
+	}
+}
+
+func TestSplitOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		limit  int
+		want   []string
+	}{
+		{
+			name:   "fits",
+			output: "hello",
+			limit:  20,
+			want:   []string{"```\nhello\n```"},
+		},
+		{
+			name:   "lines",
+			output: "aaaa\nbbbb\ncccc",
+			limit:  len("```\n\n```") + 10,
+			want:   []string{"```\naaaa\nbbbb\n```", "```\ncccc\n```"},
+		},
+		{
+			name:   "line longer than the limit",
+			output: strings.Repeat("x", 25),
+			limit:  len("```\n\n```") + 10,
+			want: []string{
+				"```\n" + strings.Repeat("x", 10) + "\n```",
+				"```\n" + strings.Repeat("x", 10) + "\n```",
+				"```\n" + strings.Repeat("x", 5) + "\n```",
+			},
+		},
+		{
+			name:   "multi-byte characters",
+			output: strings.Repeat("é", 15),
+			limit:  len("```\n\n```") + 10,
+			want: []string{
+				"```\n" + strings.Repeat("é", 10) + "\n```",
+				"```\n" + strings.Repeat("é", 5) + "\n```",
+			},
+		},
+		{
+			name:   "fences in the output",
+			output: "```\nhi\n```",
+			limit:  100,
+			want:   []string{"```\n`" + zeroWidthSpace + "`" + zeroWidthSpace + "`\nhi\n`" + zeroWidthSpace + "`" + zeroWidthSpace + "`\n```"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitOutput(tt.output, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitOutput(%q, %d) = %q, expected %q", tt.output, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSplitOutputMessages checks that every message of long output fits the
+// limit, is valid UTF-8, and is one code block, wherever it is split.
+func TestSplitOutputMessages(t *testing.T) {
+	output := strings.Repeat("héllo \U0001F44B\U0001F3FD wörld ```\n", 50) + strings.Repeat("界", 300)
+
+	for limit := 20; limit <= 200; limit += 7 {
+		messages := splitOutput(output, limit)
+		for _, m := range messages {
+			if n := utf8.RuneCountInString(m); n > limit {
+				t.Errorf("limit %d: message of %d characters", limit, n)
+			}
+			if !utf8.ValidString(m) {
+				t.Errorf("limit %d: message isn't valid UTF-8: %q", limit, m)
+			}
+			if !strings.HasPrefix(m, "```\n") || !strings.HasSuffix(m, "\n```") || strings.Count(m, "```") != 2 {
+				t.Errorf("limit %d: message isn't one code block: %q", limit, m)
+			}
+		}
+	}
+}
+
+func TestRunCommandMessageLink(t *testing.T) {
+	err := guildConfigs.Update("100", func(g *GuildConfig) {
+		g.DeniedChannels = []string{"400"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readable := int64(discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory)
+	tests := []struct {
+		name    string
+		channel string
+		perms   int64
+		want    string
+	}{
+		{"readable channel", "300", readable, "print('linked')"},
+		{"hidden channel", "200", 0, tr("", "error.hidden_channel")},
+		{"unknown channel", "500", -1, tr("", "error.hidden_channel")},
+		{"disabled channel", "400", readable, tr("", "error.target_channel_disabled")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeDiscord(&discordgo.Message{
+				ID:        "5",
+				ChannelID: tt.channel,
+				Content:   "```py\nprint('linked')\n```",
+				Author:    &discordgo.User{ID: "author"},
+			})
+			if tt.perms >= 0 {
+				s.perms[tt.channel] = tt.perms
+			}
+
+			i := newCommand("run", &discordgo.ApplicationCommandInteractionDataOption{
+				Name:  "message",
+				Type:  discordgo.ApplicationCommandOptionString,
+				Value: "https://discord.com/channels/100/" + tt.channel + "/5",
+			})
+			i.GuildID = "100"
+			commandsHandlers["run"](context.Background(), s, i)
+
+			output := strings.Join(s.contents(), "\n")
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, output)
+			}
+		})
+	}
+}
+
+// TestRunCommandSelection checks that choosing which code message to run
+// after /run isn't refused by the cooldown, which starts once code runs.
+func TestRunCommandSelection(t *testing.T) {
+	defer func(r *RateLimiter) { rateLimiter = r }(rateLimiter)
+	rateLimiter = NewRateLimiter(time.Minute, 100)
+
+	s := newFakeDiscord(
+		&discordgo.Message{ID: "2", Content: "```py\nprint('second')\n```", Author: &discordgo.User{ID: "user"}},
+		&discordgo.Message{ID: "1", Content: "```py\nprint('first')\n```", Author: &discordgo.User{ID: "user"}},
+	)
+	commandsHandlers["run"](context.Background(), s, newCommand("run"))
+
+	if len(s.edits) != 1 || len(*s.edits[0].Components) != 1 {
+		t.Fatalf("expected to be asked which code message to run, got %q", s.contents())
+	}
+
+	s = newFakeDiscord(s.messages...)
+	i := newCommand("run")
+	i.Type = discordgo.InteractionMessageComponent
+	i.Data = discordgo.MessageComponentInteractionData{
+		CustomID: "select_code:1000",
+		Values:   []string{"1"},
+	}
+	componentsHandlers["select_code"](context.Background(), s, i)
+
+	output := strings.Join(s.contents(), "\n")
+	if !strings.Contains(output, "print('first')") {
+		t.Errorf("expected the output of the chosen code message, got %q", output)
+	}
+
+	// The choice ran code, so the user is now on cooldown.
+	s = newFakeDiscord(s.messages...)
+	componentsHandlers["select_code"](context.Background(), s, i)
+
+	output = strings.Join(s.contents(), "\n")
+	if !strings.Contains(output, "Slow down!") {
+		t.Errorf("expected the user to be on cooldown, got %q", output)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// Maximum number of results kept in the cache.
+const resultCacheSize = 1000
+
+type cachedResult struct {
+	Result  *piston.ExecuteResponse
+	Created time.Time
+}
+
+// ResultCache keeps the results of executions for a while, so running the
+// same code with the same input again returns instantly. The results are
+// shared between replicas in Redis if it is used.
+type ResultCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	results map[string]cachedResult
+}
+
+func NewResultCache(ttl time.Duration) *ResultCache {
+	return &ResultCache{
+		ttl:     ttl,
+		results: make(map[string]cachedResult),
+	}
+}
+
+// resultCacheKey returns the key of an execution request: the language,
+// version, hash of the code, stdin, arguments, environment, dependencies,
+// and limits.
+func resultCacheKey(req piston.ExecuteRequest) string {
+	key := struct {
+		Language string
+		Version  string
+		CodeHash string
+		Stdin    string
+		Args     []string          `json:",omitempty"`
+		Env      map[string]string `json:",omitempty"`
+		Deps     []string          `json:",omitempty"`
+		Install  bool              `json:",omitempty"`
+		Limits   [4]int
+	}{
+		req.Language,
+		req.Version,
+		hashFiles(req.Files),
+		req.Stdin,
+		req.Args,
+		req.Env,
+		req.Dependencies,
+		req.Install,
+		[4]int{req.CompileTimeout, req.RunTimeout, req.CompileMemoryLimit, req.RunMemoryLimit},
+	}
+
+	data, _ := json.Marshal(key)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// SetTTL changes how long results are kept, including the results already
+// cached.
+func (c *ResultCache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl = ttl
+}
+
+// TTL returns how long results are kept.
+func (c *ResultCache) TTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ttl
+}
+
+// Get returns a copy of the cached result of a request, marked as cached.
+func (c *ResultCache) Get(req piston.ExecuteRequest) (*piston.ExecuteResponse, bool) {
+	ttl := c.TTL()
+	if ttl <= 0 {
+		return nil, false
+	}
+
+	if redisClient != nil {
+		var result piston.ExecuteResponse
+		if !getShared("result", resultCacheKey(req), &result) {
+			return nil, false
+		}
+		result.Cached = true
+		return &result, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.results[resultCacheKey(req)]
+	if !ok || time.Since(cached.Created) > ttl {
+		return nil, false
+	}
+
+	result := *cached.Result
+	result.Cached = true
+	return &result, true
+}
+
+// Add caches the result of a request, removing expired results.
+func (c *ResultCache) Add(req piston.ExecuteRequest, result *piston.ExecuteResponse) {
+	ttl := c.TTL()
+	if ttl <= 0 {
+		return
+	}
+
+	if redisClient != nil {
+		setShared("result", resultCacheKey(req), result, ttl)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, cached := range c.results {
+		if time.Since(cached.Created) > ttl {
+			delete(c.results, k)
+		}
+	}
+
+	// Make room by removing the oldest result if the cache is full.
+	if len(c.results) >= resultCacheSize {
+		oldest := ""
+		for k, cached := range c.results {
+			if oldest == "" || cached.Created.Before(c.results[oldest].Created) {
+				oldest = k
+			}
+		}
+		delete(c.results, oldest)
+	}
+
+	c.results[resultCacheKey(req)] = cachedResult{
+		Result:  result,
+		Created: time.Now(),
+	}
+}
+
+type noCacheKey struct{}
+
+// withoutCache returns a context whose executions always run the code, e.g.
+// for benchmarks, where every run has to be measured.
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// cacheDisabled checks if executions with a context skip the cache.
+func cacheDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCacheKey{}).(bool)
+	return disabled
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of users shown on a leaderboard.
+const leaderboardSize = 20
+
+// Challenge is a problem users solve before a deadline, judged against test cases.
+type Challenge struct {
+	ID                   string                         `json:"id"`
+	GuildID              string                         `json:"guild_id"`
+	ChannelID            string                         `json:"channel_id"` // where the leaderboard is posted
+	LeaderboardMessageID string                         `json:"leaderboard_message_id"`
+	Name                 string                         `json:"name"`
+	Statement            string                         `json:"statement"`
+	Cases                []TestCase                     `json:"cases"`
+	Deadline             time.Time                      `json:"deadline"`
+	Submissions          map[string]ChallengeSubmission `json:"submissions"` // user ID -> best submission
+	Closed               bool                           `json:"closed"`
+	CreatedBy            string                         `json:"created_by"`
+}
+
+// ChallengeSubmission is the result of a user's submission to a challenge.
+type ChallengeSubmission struct {
+	Language  string        `json:"language"`
+	Passed    int           `json:"passed"`
+	Runtime   time.Duration `json:"runtime"` // total runtime of the passed test cases
+	Submitted time.Time     `json:"submitted"`
+}
+
+// Better checks if a submission ranks above another: more test cases passed,
+// then a faster runtime, then an earlier submission.
+func (c ChallengeSubmission) Better(o ChallengeSubmission) bool {
+	if c.Passed != o.Passed {
+		return c.Passed > o.Passed
+	}
+	if c.Runtime != o.Runtime {
+		return c.Runtime < o.Runtime
+	}
+	return c.Submitted.Before(o.Submitted)
+}
+
+// Open checks if submissions to a challenge are accepted.
+func (c *Challenge) Open() bool {
+	return !c.Closed && time.Now().Before(c.Deadline)
+}
+
+// Standings returns the user IDs of the submissions, best first.
+func (c *Challenge) Standings() []string {
+	users := make([]string, 0, len(c.Submissions))
+	for id := range c.Submissions {
+		users = append(users, id)
+	}
+	sort.Slice(users, func(a, b int) bool {
+		return c.Submissions[users[a]].Better(c.Submissions[users[b]])
+	})
+	return users
+}
+
+// ChallengeStore stores challenges in a JSON file, or in the database if
+// there is one.
+type ChallengeStore struct {
+	mu         sync.RWMutex
+	path       string
+	challenges map[string]*Challenge
+}
+
+// LoadChallengeStore loads the challenges from a file, which is created when
+// the first challenge is added.
+func LoadChallengeStore(path string) (*ChallengeStore, error) {
+	c := &ChallengeStore{
+		path:       path,
+		challenges: make(map[string]*Challenge),
+	}
+
+	if database != nil {
+		return c, loadDocuments(documentChallenge, path, &c.challenges)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &c.challenges)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// save writes a changed challenge to the database, or every challenge to
+// the file. The lock must be held.
+func (c *ChallengeStore) save(id string) error {
+	if database != nil {
+		return saveDocument(documentChallenge, id, c.challenges[id])
+	}
+
+	data, err := json.MarshalIndent(c.challenges, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.path, data, 0o600)
+}
+
+// copyChallenge returns a copy of a challenge that can be used without the lock.
+func copyChallenge(ch *Challenge) Challenge {
+	cp := *ch
+	cp.Submissions = make(map[string]ChallengeSubmission, len(ch.Submissions))
+	for k, v := range ch.Submissions {
+		cp.Submissions[k] = v
+	}
+	return cp
+}
+
+// Add adds a challenge and saves it to the file.
+func (c *ChallengeStore) Add(ch *Challenge) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.challenges[ch.ID] = ch
+	return c.save(ch.ID)
+}
+
+// Get returns a copy of a challenge.
+func (c *ChallengeStore) Get(id string) (Challenge, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ch, ok := c.challenges[id]
+	if !ok {
+		return Challenge{}, false
+	}
+	return copyChallenge(ch), true
+}
+
+// List returns copies of the challenges matching a filter, by deadline.
+func (c *ChallengeStore) List(filter func(ch *Challenge) bool) []Challenge {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var list []Challenge
+	for _, ch := range c.challenges {
+		if filter(ch) {
+			list = append(list, copyChallenge(ch))
+		}
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Deadline.Before(list[b].Deadline)
+	})
+	return list
+}
+
+// Update changes a challenge and saves it to the file, returning a copy of the
+// changed challenge.
+func (c *ChallengeStore) Update(id string, update func(ch *Challenge)) (Challenge, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.challenges[id]
+	if !ok {
+		return Challenge{}, errors.New("challenge not found")
+	}
+	update(ch)
+
+	return copyChallenge(ch), c.save(id)
+}
+
+// parseDeadline parses a deadline given as a duration from now, e.g. "48h",
+// or a UTC time, e.g. "2021-11-20 18:00".
+func parseDeadline(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+	if t, err := time.Parse("2006-01-02 15:04", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a duration like 48h or a time like 2021-11-20 18:00", s)
+}
+
+// Challenge command definition.
+var challengeCommand = &discordgo.ApplicationCommand{
+	Name:        "challenge",
+	Description: "Code challenges with a deadline and a leaderboard.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "create",
+			Description: "Creates a challenge. Only server managers can create challenges.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "channel",
+					Description:  "The channel to post the challenge and leaderboard in. Defaults to this channel.",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					Required:     false,
+				},
+			},
+		},
+		{
+			Name:        "submit",
+			Description: "Submits the latest code message as a solution to a challenge.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "challenge",
+					Description:  "The challenge to submit to.",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
+				},
+				{
+					Name:        "language",
+					Description: "The language to run the code in.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:         "version",
+					Description:  "The version of the language to use. Defaults to the latest version.",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:        "message",
+					Description: "A link to or the ID of the message to submit. Defaults to the latest code message.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "list",
+			Description: "Lists the open challenges.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+	},
+}
+
+func challengeHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	cmd := i.ApplicationCommandData().Options[0]
+	switch cmd.Name {
+	case "create":
+		challengeCreateHandler(s, i, optionMap(cmd.Options))
+	case "submit":
+		challengeSubmitHandler(ctx, s, i, optionMap(cmd.Options))
+	case "list":
+		challengeListHandler(ctx, s, i)
+	}
+}
+
+// challengeCreateHandler opens the modal for creating a challenge.
+func challengeCreateHandler(s Discord, i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	if !canManageGuild(i) {
+		respondEphemeral(s, i, "You need the Manage Server permission to create challenges.")
+		return
+	}
+
+	channelID := i.ChannelID
+	if option, ok := options["channel"]; ok {
+		channelID = option.ChannelValue(nil).ID
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: "challenge_create:" + channelID,
+				Title:    "Create Challenge",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:  "name",
+								Label:     "Name",
+								Style:     discordgo.TextInputShort,
+								Required:  true,
+								MaxLength: 100,
+							},
+						},
+					},
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:    "deadline",
+								Label:       "Deadline (duration or UTC time)",
+								Style:       discordgo.TextInputShort,
+								Placeholder: "48h or 2021-11-20 18:00",
+								Required:    true,
+								MaxLength:   50,
+							},
+						},
+					},
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:  "statement",
+								Label:     "Problem Statement",
+								Style:     discordgo.TextInputParagraph,
+								Required:  true,
+								MaxLength: 4000,
+							},
+						},
+					},
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:    "cases",
+								Label:       "Test Cases",
+								Style:       discordgo.TextInputParagraph,
+								Placeholder: "1 2\n===\n3\n---\n2 2\n===\n4",
+								Required:    true,
+								MaxLength:   4000,
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// challengeCreateModalHandler creates a challenge from the submitted modal,
+// posting it with its leaderboard.
+func challengeCreateModalHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	data := i.ModalSubmitData()
+	values := modalValues(data)
+
+	deadline, err := parseDeadline(values["deadline"])
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("Invalid deadline: %v.", err))
+		return
+	}
+	if deadline.Before(time.Now()) {
+		respondEphemeral(s, i, "The deadline has already passed.")
+		return
+	}
+
+	cases, err := parseTestCases(values["cases"])
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("Invalid test cases: %v. %v", err, testCaseFormat))
+		return
+	}
+
+	ch := &Challenge{
+		ID:          i.ID,
+		GuildID:     i.GuildID,
+		ChannelID:   strings.TrimPrefix(data.CustomID, "challenge_create:"),
+		Name:        values["name"],
+		Statement:   values["statement"],
+		Cases:       cases,
+		Deadline:    deadline,
+		Submissions: make(map[string]ChallengeSubmission),
+		CreatedBy:   interactionUser(i).ID,
+	}
+
+	m, err := s.ChannelMessageSendEmbeds(ch.ChannelID, challengeEmbeds(ch))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending challenge.")
+
+		respondEphemeral(s, i, fmt.Sprintf("Error posting the challenge.```\n%v\n```", err))
+		return
+	}
+	ch.LeaderboardMessageID = m.ID
+
+	err = challenges.Add(ch)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error saving challenge.")
+
+		respondEphemeral(s, i, fmt.Sprintf("Error saving the challenge.```\n%v\n```", err))
+		return
+	}
+
+	log.Info().
+		Str("challenge_id", ch.ID).
+		Str("guild_id", ch.GuildID).
+		Time("deadline", ch.Deadline).
+		Msg("Challenge created.")
+
+	respondEphemeral(s, i, fmt.Sprintf("Created the challenge %v in <#%v>.", ch.Name, ch.ChannelID))
+}
+
+// challengeSubmitHandler judges the code of a user against a challenge and
+// updates the leaderboard.
+func challengeSubmitHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	w := NewResponseWriter(ctx, s, i)
+	w.Ephemeral = true
+
+	ch, ok := challenges.Get(options["challenge"].StringValue())
+	if !ok || ch.GuildID != i.GuildID {
+		w.Error("That challenge doesn't exist.")
+		return
+	}
+	if !ch.Open() {
+		w.Error("That challenge has ended.")
+		return
+	}
+
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	lang, version, files, ok := getCodeFromChannel(w)
+	if !ok {
+		return
+	}
+
+	runID := newExecutionID()
+	results := judgeCases(w.Context(), runID, lang, version, files, guildLimits(i.GuildID), ch.Cases)
+	auditExecution(w.Session, i.ChannelID, interactionUser(i).ID, i.GuildID, runID, lang, files, judgeStatus(results))
+
+	submission := ChallengeSubmission{
+		Language:  lang,
+		Submitted: time.Now(),
+	}
+	for _, r := range results {
+		if r.Passed {
+			submission.Passed++
+			submission.Runtime += r.Result.RunTime()
+		}
+	}
+
+	// Keep the best submission of every user.
+	userID := interactionUser(i).ID
+	ch, err := challenges.Update(ch.ID, func(ch *Challenge) {
+		if best, ok := ch.Submissions[userID]; !ok || submission.Better(best) {
+			ch.Submissions[userID] = submission
+		}
+	})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("challenge_id", ch.ID).
+			Msg("Error saving challenge submission.")
+	}
+
+	updateLeaderboard(s, &ch)
+
+	best := ch.Submissions[userID]
+	w.Send(&discordgo.WebhookParams{
+		Content: fmt.Sprintf("Your best submission passed %d/%d test cases in %v.", best.Passed, len(ch.Cases), best.Runtime.Round(time.Millisecond)),
+		Embeds:  []*discordgo.MessageEmbed{judgeEmbed(runID, lang, results, true)},
+	})
+}
+
+// challengeListHandler lists the open challenges of a guild.
+func challengeListHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	open := challenges.List(func(ch *Challenge) bool {
+		return ch.GuildID == i.GuildID && ch.Open()
+	})
+
+	if len(open) == 0 {
+		respondEphemeral(s, i, "There are no open challenges.")
+		return
+	}
+
+	lines := make([]string, len(open))
+	for n, ch := range open {
+		lines[n] = fmt.Sprintf("**%v** in <#%v>, ends <t:%d:R> (%d submissions)", ch.Name, ch.ChannelID, ch.Deadline.Unix(), len(ch.Submissions))
+	}
+
+	respondEphemeral(s, i, strings.Join(lines, "\n"))
+}
+
+// challengeAutocomplete suggests the open challenges of a guild, or versions
+// of the chosen language.
+func challengeAutocomplete(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	options := commandOptions(i)
+	if option, ok := options["version"]; ok && option.Focused {
+		versionAutocomplete(ctx, s, i)
+		return
+	}
+
+	typed := ""
+	if option, ok := options["challenge"]; ok {
+		typed = strings.ToLower(option.StringValue())
+	}
+
+	open := challenges.List(func(ch *Challenge) bool {
+		return ch.GuildID == i.GuildID && ch.Open() && strings.Contains(strings.ToLower(ch.Name), typed)
+	})
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, ch := range open {
+		// Discord allows at most 25 choices.
+		if len(choices) == 25 {
+			break
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  ch.Name,
+			Value: ch.ID,
+		})
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{
+				Choices: choices,
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to autocomplete interaction.")
+	}
+}
+
+// challengeEmbeds renders a challenge and its leaderboard.
+func challengeEmbeds(ch *Challenge) []*discordgo.MessageEmbed {
+	status := fmt.Sprintf("<t:%d:F> (<t:%d:R>)", ch.Deadline.Unix(), ch.Deadline.Unix())
+	if !ch.Open() {
+		status = "Ended " + status
+	}
+
+	standings := ch.Standings()
+	lines := make([]string, 0, leaderboardSize)
+	for n, userID := range standings {
+		if n == leaderboardSize {
+			break
+		}
+		sub := ch.Submissions[userID]
+		lines = append(lines, fmt.Sprintf(
+			"**%d.** <@%v> %d/%d passed in %v (%v)",
+			n+1, userID, sub.Passed, len(ch.Cases), sub.Runtime.Round(time.Millisecond), sub.Language,
+		))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No submissions yet. Submit with `/challenge submit`.")
+	}
+
+	return []*discordgo.MessageEmbed{
+		{
+			Title:       ch.Name,
+			Description: ch.Statement,
+			Fields: []*discordgo.MessageEmbedField{
+				{
+					Name:   "Deadline",
+					Value:  status,
+					Inline: true,
+				},
+				{
+					Name:   "Test Cases",
+					Value:  fmt.Sprint(len(ch.Cases)),
+					Inline: true,
+				},
+			},
+		},
+		{
+			Title:       "🏆 Leaderboard",
+			Description: strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// updateLeaderboard updates the posted challenge with its current leaderboard.
+func updateLeaderboard(s Discord, ch *Challenge) {
+	_, err := s.ChannelMessageEditEmbeds(ch.ChannelID, ch.LeaderboardMessageID, challengeEmbeds(ch))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("challenge_id", ch.ID).
+			Msg("Error updating leaderboard.")
+	}
+}
+
+// closeChallenges periodically closes challenges whose deadline has passed,
+// announcing the winner.
+func closeChallenges(s *discordgo.Session, interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			ended := challenges.List(func(ch *Challenge) bool {
+				return !ch.Closed && !ch.Open()
+			})
+
+			for _, ch := range ended {
+				ch, err := challenges.Update(ch.ID, func(ch *Challenge) {
+					ch.Closed = true
+				})
+				if err != nil {
+					log.Error().
+						Err(err).
+						Str("challenge_id", ch.ID).
+						Msg("Error closing challenge.")
+					continue
+				}
+
+				updateLeaderboard(s, &ch)
+
+				content := fmt.Sprintf("The challenge **%v** has ended with no submissions.", ch.Name)
+				if standings := ch.Standings(); len(standings) > 0 {
+					content = fmt.Sprintf("The challenge **%v** has ended! 🏆 <@%v> wins!", ch.Name, standings[0])
+				}
+
+				_, err = s.ChannelMessageSendReply(ch.ChannelID, content, &discordgo.MessageReference{
+					MessageID: ch.LeaderboardMessageID,
+					ChannelID: ch.ChannelID,
+					GuildID:   ch.GuildID,
+				})
+				if err != nil {
+					log.Error().
+						Err(err).
+						Str("challenge_id", ch.ID).
+						Msg("Error announcing challenge results.")
+				}
+
+				log.Info().
+					Str("challenge_id", ch.ID).
+					Msg("Challenge closed.")
+			}
+		}
+	}()
+}
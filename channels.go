@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// channelType returns the type of a channel, or false if it couldn't be
+// found, in which case it is assumed to support everything.
+func channelType(s Discord, channelID string) (discordgo.ChannelType, bool) {
+	channel, err := getChannel(s, channelID)
+	if err != nil {
+		return 0, false
+	}
+	return channel.Type, true
+}
+
+// canReadHistory checks if the messages sent before in a type of channel can
+// be read. The text chats of voice and stage channels only keep messages
+// for people in them.
+func canReadHistory(t discordgo.ChannelType) bool {
+	switch t {
+	case discordgo.ChannelTypeGuildVoice, discordgo.ChannelTypeGuildStageVoice:
+		return false
+	}
+	return true
+}
+
+// canStartThreads checks if threads can be started in a type of channel.
+func canStartThreads(t discordgo.ChannelType) bool {
+	return t == discordgo.ChannelTypeGuildText || t == discordgo.ChannelTypeGuildNews
+}
+
+// checkHistoryChannel checks that the earlier messages in the channel of an
+// interaction can be read, sending an error if they can't.
+func checkHistoryChannel(w *ResponseWriter) bool {
+	if t, ok := channelType(w.Session, w.Interaction.ChannelID); ok && !canReadHistory(t) {
+		w.Error(tr(w.Interaction.Locale, "error.channel_history"))
+		return false
+	}
+	return true
+}
+
+// checkThreadChannel checks that threads can be started in the channel of an
+// interaction, sending an ephemeral message if they can't.
+func checkThreadChannel(s Discord, i *discordgo.InteractionCreate) bool {
+	if t, ok := channelType(s, i.ChannelID); ok && !canStartThreads(t) {
+		respondEphemeral(s, i, tr(i.Locale, "error.channel_threads"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum length of the output in a reply on another chat platform.
+const chatOutputLimit = 3000
+
+// ChatAdapter connects a chat platform to the execution core. Discord is
+// served by the gateway and the interaction handlers.
+type ChatAdapter interface {
+	// Name is the name of the platform, used in logs and rate limits.
+	Name() string
+	// Start begins receiving commands, adding the endpoints of the platform
+	// to the HTTP server if it sends them there.
+	Start(mux *http.ServeMux)
+}
+
+// Chat platforms other than Discord that code can be run from.
+var chatAdapters []ChatAdapter
+
+// ChatRun is code to run from a chat platform.
+type ChatRun struct {
+	Platform string
+	UserID   string
+	GroupID  string // workspace or group of the user, limiting concurrent executions
+	Text     string // an optional language, followed by the code, in a code block or not
+}
+
+// parseChatCode splits the text of a chat command or message into the
+// language and the code. The language is the first word of the text if it
+// is the name of a language, or the language of its code block.
+func parseChatCode(text string) (lang string, code string) {
+	text = strings.TrimSpace(text)
+
+	fields := strings.Fields(text)
+	if len(fields) > 0 && !strings.HasPrefix(fields[0], "`") {
+		if l := resolveLanguage(fields[0]); l != "" {
+			lang = l
+			text = strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+		}
+	}
+
+	blocks := parseCodeBlocks(text)
+	if len(blocks) == 0 {
+		return lang, strings.Trim(text, "`")
+	}
+
+	if lang == "" {
+		lang = resolveLanguage(blocks[0].Language)
+	}
+	return lang, blocks[0].Code
+}
+
+// runChatCode runs the code of a chat command through the same pipeline as
+// Discord commands: language detection, templates, rate limits, the queue
+// and the cache. The reply is returned as Markdown.
+func runChatCode(ctx context.Context, run ChatRun) string {
+	lang, code := parseChatCode(run.Text)
+	if strings.TrimSpace(code) == "" {
+		return "No code given. Give a language followed by the code, e.g. `python print(1)`."
+	}
+	if lang == "" {
+		lang = detectLanguage(code)
+	}
+	if lang == "" {
+		return fmt.Sprintf("The language could not be detected. Give it before the code. Supported languages are: %v", strings.Join(getLanguages(), ", "))
+	}
+
+	files := applyTemplate(lang, []piston.File{{Content: code}})
+
+	release, wait, ok := rateLimiter.Acquire(run.Platform+":"+run.UserID, run.Platform+":"+run.GroupID)
+	if !ok {
+		if wait > 0 {
+			return tr("", "error.slow_down", wait.Round(time.Second/10))
+		}
+		return tr("", "error.server_busy")
+	}
+	defer release()
+
+	commandsReceived.WithLabelValues(run.Platform, "").Inc()
+
+	var result *piston.ExecuteResponse
+	releaseSlot, err := execQueue.Acquire(ctx, nil)
+	if err == nil {
+		result, err = Execute(ctx, ExecRequest{
+			Language: lang,
+			Files:    files,
+			Limits:   getDefaultLimits(),
+		})
+		releaseSlot()
+	}
+
+	log.Info().
+		Str("platform", run.Platform).
+		Str("user_id", run.UserID).
+		Str("language", lang).
+		Str("status", executionStatus(result, err)).
+		Msg("Chat execution.")
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+
+		return execErrorMessage("code", err)
+	}
+
+	output := fullOutput(result)
+	stopped := terminationMessage(result, getDefaultLimits())
+	if strings.TrimSpace(output) == "" && stopped != "" {
+		return fmt.Sprintf("%v\n%v", stopped, resultFooter(result))
+	}
+	if strings.TrimSpace(output) == "" {
+		output = "No output."
+	}
+
+	reply := splitOutput(truncate(output, chatOutputLimit), chatOutputLimit+100)[0]
+	if stopped != "" {
+		reply += "\n" + stopped
+	}
+	return fmt.Sprintf("%v\n%v", reply, resultFooter(result))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Longest time a guild can keep output before it is deleted, in minutes.
+const maxCleanupMinutes = 24 * 60
+
+// deleteOutputButton is a button that deletes the message it is on, for the
+// user who ran the code and moderators.
+func deleteOutputButton(userID string) discordgo.Button {
+	return discordgo.Button{
+		Label:    "Delete",
+		Style:    discordgo.SecondaryButton,
+		CustomID: "delete_output:" + userID,
+	}
+}
+
+// canModerate checks if the user of an interaction can delete messages of
+// others in its channel.
+func canModerate(i *discordgo.InteractionCreate) bool {
+	return canManageGuild(i) || (i.Member != nil && i.Member.Permissions&discordgo.PermissionManageMessages != 0)
+}
+
+// deleteOutputHandler deletes a message with output, if the user ran the
+// code or is a moderator.
+func deleteOutputHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	userID := strings.TrimPrefix(i.MessageComponentData().CustomID, "delete_output:")
+	if interactionUser(i).ID != userID && !canModerate(i) {
+		respondEphemeral(s, i, "Only the user who ran this code and moderators can delete its output.")
+		return
+	}
+
+	if i.Message.Flags&discordgo.MessageFlagsEphemeral != 0 {
+		respondEphemeral(s, i, "Only you can see this output. Use **Dismiss message** below it to remove it.")
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+		return
+	}
+
+	err = s.ChannelMessageDelete(i.ChannelID, i.Message.ID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("channel_id", i.ChannelID).
+			Str("message_id", i.Message.ID).
+			Msg("Error deleting output.")
+	}
+}
+
+// scheduleCleanup deletes messages with output once the time the guild keeps
+// output in their channel has passed, if it set one. Output in threads and
+// forum posts is kept as long as in the channel they are in.
+func scheduleCleanup(s Discord, guildID string, channelID string, messageIDs []string) {
+	if len(messageIDs) == 0 {
+		return
+	}
+
+	channels := guildConfigs.Get(guildID).CleanupChannels
+	minutes, ok := channels[channelID]
+	if !ok && len(channels) > 0 {
+		minutes = channels[threadParent(s, channelID)]
+	}
+	if minutes <= 0 {
+		return
+	}
+
+	time.AfterFunc(time.Duration(minutes)*time.Minute, func() {
+		for _, id := range messageIDs {
+			err := s.ChannelMessageDelete(channelID, id)
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("channel_id", channelID).
+					Str("message_id", id).
+					Msg("Error cleaning up output.")
+			}
+		}
+	})
+}
+
+// describeCleanup formats the channels output is deleted in for a message.
+func describeCleanup(g GuildConfig) string {
+	if len(g.CleanupChannels) == 0 {
+		return "**Cleanup**\nOutput is kept"
+	}
+
+	lines := make([]string, 0, len(g.CleanupChannels))
+	for channelID, minutes := range g.CleanupChannels {
+		lines = append(lines, fmt.Sprintf("<#%v>: deleted after %v minutes", channelID, minutes))
+	}
+	sort.Strings(lines)
+
+	return "**Cleanup**\n" + strings.Join(lines, "\n")
+}
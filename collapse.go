@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Output collapse option of commands that run code.
+var collapseOption = &discordgo.ApplicationCommandOption{
+	Name:        "spoiler",
+	Description: "Hide the output behind spoiler tags or post it in a thread. Defaults to the server setting.",
+	Type:        discordgo.ApplicationCommandOptionString,
+	Required:    false,
+	Choices: []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "none", Value: OutputCollapseNone},
+		{Name: "spoiler", Value: OutputCollapseSpoiler},
+		{Name: "thread", Value: OutputCollapseThread},
+	},
+}
+
+// outputCollapse returns how output is collapsed in a guild, using requested
+// if it is set.
+func outputCollapse(guildID string, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	if collapse := guildConfigs.Get(guildID).OutputCollapse; collapse != "" {
+		return collapse
+	}
+	return OutputCollapseNone
+}
+
+// postInThread starts a thread off a message and posts messages in it. In a
+// thread or forum post, which can't have threads of their own, the messages
+// are posted in it instead. False is returned if the thread couldn't be
+// started, e.g. in direct messages or voice channels, so the messages can be
+// posted elsewhere.
+func postInThread(s Discord, channelID string, messageID string, name string, messages []*discordgo.WebhookParams) bool {
+	thread := getThread(s, channelID)
+	if thread == nil {
+		if t, ok := channelType(s, channelID); ok && !canStartThreads(t) {
+			return false
+		}
+
+		var err error
+		thread, err = s.MessageThreadStart(channelID, messageID, name, 60)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("channel_id", channelID).
+				Str("message_id", messageID).
+				Msg("Error starting output thread.")
+			return false
+		}
+	}
+
+	for _, params := range messages {
+		_, err := s.ChannelMessageSendComplex(thread.ID, &discordgo.MessageSend{
+			Content:         params.Content,
+			Embeds:          params.Embeds,
+			Components:      params.Components,
+			Files:           params.Files,
+			AllowedMentions: params.AllowedMentions,
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("thread_id", thread.ID).
+				Msg("Error sending message.")
+		}
+	}
+
+	return true
+}
+
+// outputThreadName names the thread output of a language is posted in.
+func outputThreadName(lang string) string {
+	return fmt.Sprintf("Output of %v", lang)
+}
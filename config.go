@@ -0,0 +1,1311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// envInt returns an integer from the environment, or def if it isn't set.
+func envInt(name string, def int) int {
+	n, err := parseEnvInt(name, def)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Invalid " + name + ".")
+	}
+
+	return n
+}
+
+// parseEnvInt is like envInt, but returns an error instead of exiting.
+func parseEnvInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %w", name, err)
+	}
+
+	return n, nil
+}
+
+// envBool returns a boolean from the environment, or def if it isn't set.
+func envBool(name string, def bool) bool {
+	b, err := parseEnvBool(name, def)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Invalid " + name + ".")
+	}
+
+	return b
+}
+
+// parseEnvBool is like envBool, but returns an error instead of exiting.
+func parseEnvBool(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %v: %w", name, err)
+	}
+
+	return b, nil
+}
+
+// envDuration returns a duration from the environment, or def if it isn't set.
+func envDuration(name string, def time.Duration) time.Duration {
+	d, err := parseEnvDuration(name, def)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Invalid " + name + ".")
+	}
+
+	return d
+}
+
+// parseEnvDuration is like envDuration, but returns an error instead of exiting.
+func parseEnvDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %w", name, err)
+	}
+
+	return d, nil
+}
+
+// Limits are the resource limits for executing code. Zero values use the
+// defaults of the Piston instance.
+type Limits struct {
+	CompileTimeout     int `json:"compile_timeout,omitempty"`      // MS
+	RunTimeout         int `json:"run_timeout,omitempty"`          // MS
+	CompileMemoryLimit int `json:"compile_memory_limit,omitempty"` // bytes
+	RunMemoryLimit     int `json:"run_memory_limit,omitempty"`     // bytes
+}
+
+// Override returns the limits with the non-zero limits of o replacing them.
+func (l Limits) Override(o Limits) Limits {
+	return Limits{
+		CompileTimeout:     override(l.CompileTimeout, o.CompileTimeout),
+		RunTimeout:         override(l.RunTimeout, o.RunTimeout),
+		CompileMemoryLimit: override(l.CompileMemoryLimit, o.CompileMemoryLimit),
+		RunMemoryLimit:     override(l.RunMemoryLimit, o.RunMemoryLimit),
+	}
+}
+
+// Cap returns the limits of o, lowered to the non-zero limits of l.
+func (l Limits) Cap(o Limits) Limits {
+	return Limits{
+		CompileTimeout:     limit(o.CompileTimeout, l.CompileTimeout),
+		RunTimeout:         limit(o.RunTimeout, l.RunTimeout),
+		CompileMemoryLimit: limit(o.CompileMemoryLimit, l.CompileMemoryLimit),
+		RunMemoryLimit:     limit(o.RunMemoryLimit, l.RunMemoryLimit),
+	}
+}
+
+func override(v int, o int) int {
+	if o != 0 {
+		return o
+	}
+	return v
+}
+
+func limit(v int, max int) int {
+	if max != 0 && (v == 0 || v > max) {
+		return max
+	}
+	return v
+}
+
+// Maximum length of an alias of a language added by a guild.
+const maxAliasLength = 32
+
+// GuildConfig is the configuration of a guild, overriding the global configuration.
+type GuildConfig struct {
+	Limits          Limits   `json:"limits"`
+	AllowedChannels []string `json:"allowed_channels,omitempty"` // if set, code can only be run in these channels
+	DeniedChannels  []string `json:"denied_channels,omitempty"`  // code can't be run in these channels
+	PublicErrors    bool     `json:"public_errors,omitempty"`    // errors are visible to everyone instead of only the user
+	OutputStyle     string   `json:"output_style,omitempty"`     // OutputStyleEmbed (default) or OutputStyleText
+	OutputCollapse  string   `json:"output_collapse,omitempty"`  // OutputCollapseNone (default), OutputCollapseSpoiler or OutputCollapseThread
+	MaxTimeout      int      `json:"max_timeout,omitempty"`      // maximum of the timeout option of /run, in seconds; 0 uses MAX_RUN_TIMEOUT
+	LinkDetection   bool     `json:"link_detection,omitempty"`   // offer to run code messages linked in chat
+	Prefix          string   `json:"prefix,omitempty"`           // prefix of text commands, e.g. "!" for "!run"; empty disables them
+	Dependencies    bool     `json:"dependencies,omitempty"`     // packages can be installed before running code
+	InstallTimeout  int      `json:"install_timeout,omitempty"`  // maximum time for installing packages, in seconds; 0 uses MAX_INSTALL_TIMEOUT
+	OutputPageSize  int      `json:"output_page_size,omitempty"` // characters of output on each page of code blocks; 0 fills a message
+	OutputMaxPages  int      `json:"output_max_pages,omitempty"` // pages of code blocks output is cut off after; 0 uses MAX_OUTPUT_PAGES
+
+	// Minutes output is kept in each channel before it is deleted, by
+	// channel ID. Output in other channels is kept.
+	CleanupChannels map[string]int `json:"cleanup_channels,omitempty"`
+
+	// Code matching any of these regular expressions isn't run.
+	BlockedPatterns []string `json:"blocked_patterns,omitempty"`
+	ModLogChannel   string   `json:"mod_log_channel,omitempty"` // blocked code is reported here
+	AuditChannel    string   `json:"audit_channel,omitempty"`   // every execution is mirrored here
+
+	// Aliases of languages added by the guild, by lowercase alias. They are
+	// used along with the aliases of the Piston runtimes.
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// Roles needed to use each command, by command name. A member needs one
+	// of the roles; commands without roles can be used by everyone.
+	CommandRoles map[string][]string `json:"command_roles,omitempty"`
+}
+
+// ChannelAllowed checks if code can be run in a channel. Threads and forum
+// posts are also allowed or denied with the channel they are in, given as
+// parentID.
+func (g GuildConfig) ChannelAllowed(channelID string, parentID string) bool {
+	if stringInSlice(channelID, g.DeniedChannels) || (parentID != "" && stringInSlice(parentID, g.DeniedChannels)) {
+		return false
+	}
+	return len(g.AllowedChannels) == 0 || stringInSlice(channelID, g.AllowedChannels) || (parentID != "" && stringInSlice(parentID, g.AllowedChannels))
+}
+
+// ConfigStore stores the configuration of every guild in a JSON file, or in
+// the database if there is one.
+type ConfigStore struct {
+	mu     sync.RWMutex
+	path   string
+	guilds map[string]*GuildConfig
+}
+
+// LoadConfigStore loads the guild configurations from a file, which is
+// created when the configuration is first changed.
+func LoadConfigStore(path string) (*ConfigStore, error) {
+	c := &ConfigStore{
+		path:   path,
+		guilds: make(map[string]*GuildConfig),
+	}
+
+	if database != nil {
+		return c, loadDocuments(documentGuildConfig, path, &c.guilds)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &c.guilds)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Get returns a copy of the configuration of a guild. Its maps are shared
+// with the store, so updates must replace them instead of changing them.
+func (c *ConfigStore) Get(guildID string) GuildConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if g, ok := c.guilds[guildID]; ok {
+		return *g
+	}
+	return GuildConfig{}
+}
+
+// Update changes the configuration of a guild and saves it to the file. The
+// configuration is left unchanged if it can't be saved.
+func (c *ConfigStore) Update(guildID string, update func(g *GuildConfig)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The update is made to a copy, which replaces the configuration only
+	// once it is saved.
+	old, ok := c.guilds[guildID]
+	g := &GuildConfig{}
+	if ok {
+		*g = *old
+	}
+	update(g)
+
+	if database != nil {
+		if err := saveDocument(documentGuildConfig, guildID, g); err != nil {
+			return err
+		}
+		c.guilds[guildID] = g
+		return nil
+	}
+
+	c.guilds[guildID] = g
+	data, err := json.MarshalIndent(c.guilds, "", "  ")
+	if err == nil {
+		err = os.WriteFile(c.path, data, 0o600)
+	}
+	if err != nil {
+		if ok {
+			c.guilds[guildID] = old
+		} else {
+			delete(c.guilds, guildID)
+		}
+	}
+	return err
+}
+
+// guildLimits returns the resource limits of a guild. Limits saved before
+// they were checked are capped like /config limits does.
+func guildLimits(guildID string) Limits {
+	max := maxGuildLimits()
+	g := guildConfigs.Get(guildID).Limits
+	return getDefaultLimits().Override(Limits{
+		CompileTimeout:     capGuildLimit(g.CompileTimeout, max.CompileTimeout),
+		RunTimeout:         capGuildLimit(g.RunTimeout, max.RunTimeout),
+		CompileMemoryLimit: capGuildLimit(g.CompileMemoryLimit, max.CompileMemoryLimit),
+		RunMemoryLimit:     capGuildLimit(g.RunMemoryLimit, max.RunMemoryLimit),
+	})
+}
+
+// maxGuildLimits returns the highest limits a guild can set: DEFAULT_LIMITS,
+// or executorDefaultLimits where it sets none.
+func maxGuildLimits() Limits {
+	return executorDefaultLimits.Override(getDefaultLimits())
+}
+
+// capGuildLimit returns a limit of a guild between 0, for the default, and max.
+func capGuildLimit(v int, max int) int {
+	if v < 0 {
+		return 0
+	}
+	if max > 0 && v > max {
+		return max
+	}
+	return v
+}
+
+// Limits requested in command options can't exceed when neither the guild
+// nor DEFAULT_LIMITS set one, so a request is never unlimited. The timeouts
+// are Piston's defaults; Piston has no memory limit by default, so memory is
+// kept to the default of the Docker executor.
+var executorDefaultLimits = Limits{
+	CompileTimeout:     10000,
+	RunTimeout:         3000,
+	CompileMemoryLimit: 256 * 1024 * 1024,
+	RunMemoryLimit:     256 * 1024 * 1024,
+}
+
+// requestedLimits returns the resource limits requested in the command
+// options, capped to the limits of the guild, or to executorDefaultLimits
+// where it has none.
+func requestedLimits(i *discordgo.InteractionCreate) Limits {
+	options := commandOptions(i)
+
+	var requested Limits
+	if option, ok := options["compile_timeout"]; ok {
+		requested.CompileTimeout = int(option.IntValue())
+	}
+	if option, ok := options["run_timeout"]; ok {
+		requested.RunTimeout = int(option.IntValue())
+	}
+	if option, ok := options["compile_memory_limit"]; ok {
+		requested.CompileMemoryLimit = int(option.IntValue())
+	}
+	if option, ok := options["run_memory_limit"]; ok {
+		requested.RunMemoryLimit = int(option.IntValue())
+	}
+
+	// Limits that weren't requested are the guild's, which may be left to
+	// the executor.
+	guild := guildLimits(i.GuildID)
+	limits := Limits{
+		CompileTimeout:     clampLimit(requested.CompileTimeout, guild.CompileTimeout, executorDefaultLimits.CompileTimeout),
+		RunTimeout:         clampLimit(requested.RunTimeout, guild.RunTimeout, executorDefaultLimits.RunTimeout),
+		CompileMemoryLimit: clampLimit(requested.CompileMemoryLimit, guild.CompileMemoryLimit, executorDefaultLimits.CompileMemoryLimit),
+		RunMemoryLimit:     clampLimit(requested.RunMemoryLimit, guild.RunMemoryLimit, executorDefaultLimits.RunMemoryLimit),
+	}
+
+	// The timeout option can raise the run timeout above the limit of the
+	// guild, up to its maximum timeout.
+	if option, ok := options["timeout"]; ok && option.IntValue() > 0 {
+		max := guildMaxTimeout(i.GuildID)
+		if max <= 0 {
+			max = executorDefaultLimits.RunTimeout / 1000
+		}
+		limits.RunTimeout = limit(int(option.IntValue()), max) * 1000
+	}
+
+	return limits
+}
+
+// clampLimit returns a requested limit lowered to max, or to fallback if there
+// is no max. Without a request, max is returned, which is 0 to leave the limit
+// to the executor.
+func clampLimit(requested int, max int, fallback int) int {
+	if requested <= 0 {
+		return max
+	}
+	if max <= 0 {
+		max = fallback
+	}
+	if requested > max {
+		return max
+	}
+	return requested
+}
+
+// guildMaxTimeout returns the maximum of the timeout option of /run in a
+// guild, in seconds.
+func guildMaxTimeout(guildID string) int {
+	return limit(guildConfigs.Get(guildID).MaxTimeout, MAX_RUN_TIMEOUT)
+}
+
+// Option for running code for longer than the run timeout of the guild.
+var timeoutOption = &discordgo.ApplicationCommandOption{
+	Name:        "timeout",
+	Description: "Maximum time for running, in seconds. Can be longer than the run timeout, up to the server's maximum.",
+	Type:        discordgo.ApplicationCommandOptionInteger,
+	Required:    false,
+}
+
+// minLimit is the lowest value of the limit options. Piston takes negative
+// limits as unlimited.
+var minLimit = 0.0
+
+// Options for setting resource limits, used by /run and /config.
+var limitsOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "compile_timeout",
+		Description: "Maximum time for compiling, in milliseconds.",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minLimit,
+		Required:    false,
+	},
+	{
+		Name:        "run_timeout",
+		Description: "Maximum time for running, in milliseconds.",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minLimit,
+		Required:    false,
+	},
+	{
+		Name:        "compile_memory_limit",
+		Description: "Maximum memory for compiling, in bytes.",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minLimit,
+		Required:    false,
+	},
+	{
+		Name:        "run_memory_limit",
+		Description: "Maximum memory for running, in bytes.",
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		MinValue:    &minLimit,
+		Required:    false,
+	},
+}
+
+// canManageGuild checks if the user of an interaction can change the configuration of the guild.
+func canManageGuild(i *discordgo.InteractionCreate) bool {
+	if isAdmin(interactionUser(i).ID) {
+		return true
+	}
+	// There is no server to manage in direct messages.
+	return i.Member != nil && i.Member.Permissions&discordgo.PermissionManageServer != 0
+}
+
+// removeString returns a slice without any occurrences of s.
+func removeString(slice []string, s string) []string {
+	var result []string
+	for _, v := range slice {
+		if v != s {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Config command definition.
+var configCommand = &discordgo.ApplicationCommand{
+	Name:        "config",
+	Description: "Configures the bot for this server.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "show",
+			Description: "Shows the configuration of this server.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+		{
+			Name:        "limits",
+			Description: "Sets the resource limits for running code. Use 0 to reset a limit to the default.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: append(append([]*discordgo.ApplicationCommandOption(nil), limitsOptions...), &discordgo.ApplicationCommandOption{
+				Name:        "max_timeout",
+				Description: "Maximum of the timeout option of /run, in seconds.",
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				MinValue:    &minLimit,
+				Required:    false,
+			}),
+		},
+		{
+			Name:        "channel",
+			Description: "Allows or denies running code in a channel.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "channel",
+					Description:  "The channel to configure.",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildForum},
+					Required:     true,
+				},
+				{
+					Name:        "mode",
+					Description: "Add the channel to the allow list or the deny list, or remove it from both.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "allow", Value: "allow"},
+						{Name: "deny", Value: "deny"},
+						{Name: "reset", Value: "reset"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "cleanup",
+			Description: "Deletes the output of code in a channel after some time, to keep it tidy.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "channel",
+					Description:  "The channel to configure.",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildForum},
+					Required:     true,
+				},
+				{
+					Name:        "minutes",
+					Description: "Minutes output is kept before it is deleted. Use 0 to keep output.",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "errors",
+			Description: "Sets who can see error messages, like code that couldn't be found.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "visibility",
+					Description: "Show errors only to the user who ran the command, or to everyone.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "private", Value: "private"},
+						{Name: "public", Value: "public"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "links",
+			Description: "Sets whether the bot offers to run code messages whose links are posted in chat.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "enabled",
+					Description: "Offer a button to run linked code messages.",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "prefix",
+			Description: "Sets the prefix of text commands like !run, for members used to them.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "prefix",
+					Description: "The prefix, e.g. !. Leave it out to disable text commands.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "dependencies",
+			Description: "Sets whether packages can be installed before running code, if the executor supports it.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "enabled",
+					Description: "Allow the requirements option of /run and dependency files like go.mod.",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Required:    true,
+				},
+				{
+					Name:        "install_timeout",
+					Description: "Maximum time for installing packages, in seconds. Use 0 to reset it to the default.",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "output",
+			Description: "Sets how the output of code is shown.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "style",
+					Description: "An embed with a field for each output stream, or plain code blocks.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "embed", Value: OutputStyleEmbed},
+						{Name: "text", Value: OutputStyleText},
+					},
+				},
+				{
+					Name:        "collapse",
+					Description: "Hide output behind spoiler tags or post it in a thread by default, so it doesn't flood the channel.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices:     collapseOption.Choices,
+				},
+				{
+					Name:        "page_size",
+					Description: "Characters of output on each page of code blocks. Use 0 to fill a message.",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    false,
+				},
+				{
+					Name:        "max_pages",
+					Description: "Pages of code blocks output is cut off after. Use 0 to reset it to the default.",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "roles",
+			Description: "Requires a role to use a command.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "command",
+					Description: "The name of the command, e.g. run.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+				{
+					Name:        "role",
+					Description: "The role that can use the command.",
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Required:    true,
+				},
+				{
+					Name:        "mode",
+					Description: "Add the role to the roles that can use the command, or remove it.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "add", Value: "add"},
+						{Name: "remove", Value: "remove"},
+					},
+				},
+			},
+		},
+		{
+			Name:        "blocklist",
+			Description: "Manages regular expressions that code isn't allowed to match.",
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "add",
+					Description: "Blocks code matching a regular expression, e.g. :\\(\\)\\s*\\{ for fork bombs.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "pattern",
+							Description: "The regular expression, in Go syntax.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							MaxLength:   maxBlockedPatternLength,
+						},
+					},
+				},
+				{
+					Name:        "remove",
+					Description: "Allows code matching a regular expression again.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "pattern",
+							Description: "The regular expression to remove.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "modlog",
+			Description: "Sets the channel blocked code is reported in.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "channel",
+					Description:  "The channel to report in. Leave empty to stop reporting.",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					Required:     false,
+				},
+			},
+		},
+		{
+			Name:        "audit",
+			Description: "Sets the private channel every execution is mirrored in.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:         "channel",
+					Description:  "The channel to mirror executions in. Leave empty to stop mirroring.",
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+					Required:     false,
+				},
+			},
+		},
+		{
+			Name:        "alias",
+			Description: "Manages extra names for languages in this server.",
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "add",
+					Description: "Adds a name for a language, e.g. py3 for python.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "alias",
+							Description: "The new name, without spaces.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							MaxLength:   maxAliasLength,
+						},
+						{
+							Name:        "language",
+							Description: "The language or one of its aliases.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "remove",
+					Description: "Removes a name added for a language.",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "alias",
+							Description: "The name to remove.",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+func configHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	if !canManageGuild(i) {
+		respondEphemeral(s, i, "You need the Manage Server permission to configure the bot.")
+		return
+	}
+
+	cmd := i.ApplicationCommandData().Options[0]
+	switch cmd.Name {
+	case "show":
+		g := guildConfigs.Get(i.GuildID)
+		respondEphemeral(s, i, strings.Join([]string{
+			describeLimits(guildLimits(i.GuildID), guildMaxTimeout(i.GuildID)),
+			describeChannels(g),
+			describeCleanup(g),
+			describeErrors(g),
+			describeLinks(g),
+			describePrefix(g),
+			describeDependencies(g),
+			describeOutput(g),
+			describeRoles(g),
+			describeBlocklist(g),
+			describeAliases(g),
+		}, "\n\n"))
+	case "limits":
+		max := maxGuildLimits()
+		maxValues := map[string]int{
+			"compile_timeout":      max.CompileTimeout,
+			"run_timeout":          max.RunTimeout,
+			"compile_memory_limit": max.CompileMemoryLimit,
+			"run_memory_limit":     max.RunMemoryLimit,
+			"max_timeout":          MAX_RUN_TIMEOUT,
+		}
+		for _, option := range cmd.Options {
+			value := option.IntValue()
+			if value < 0 {
+				respondEphemeral(s, i, fmt.Sprintf("`%v` can't be negative.", option.Name))
+				return
+			}
+			if maxValue := maxValues[option.Name]; maxValue > 0 && value > int64(maxValue) {
+				respondEphemeral(s, i, fmt.Sprintf("`%v` can be at most %d.", option.Name, maxValue))
+				return
+			}
+		}
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			for _, option := range cmd.Options {
+				value := int(option.IntValue())
+				switch option.Name {
+				case "compile_timeout":
+					g.Limits.CompileTimeout = value
+				case "run_timeout":
+					g.Limits.RunTimeout = value
+				case "compile_memory_limit":
+					g.Limits.CompileMemoryLimit = value
+				case "run_memory_limit":
+					g.Limits.RunMemoryLimit = value
+				case "max_timeout":
+					g.MaxTimeout = value
+				}
+			}
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated the resource limits.\n"+describeLimits(guildLimits(i.GuildID), guildMaxTimeout(i.GuildID)))
+	case "channel":
+		options := optionMap(cmd.Options)
+		channelID := options["channel"].ChannelValue(nil).ID
+		mode := options["mode"].StringValue()
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			g.AllowedChannels = removeString(g.AllowedChannels, channelID)
+			g.DeniedChannels = removeString(g.DeniedChannels, channelID)
+			switch mode {
+			case "allow":
+				g.AllowedChannels = append(g.AllowedChannels, channelID)
+			case "deny":
+				g.DeniedChannels = append(g.DeniedChannels, channelID)
+			}
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated the channels.\n"+describeChannels(guildConfigs.Get(i.GuildID)))
+	case "cleanup":
+		options := optionMap(cmd.Options)
+		channelID := options["channel"].ChannelValue(nil).ID
+		minutes := int(options["minutes"].IntValue())
+		if minutes < 0 || minutes > maxCleanupMinutes {
+			respondEphemeral(s, i, fmt.Sprintf("Output can be kept for at most %v minutes.", maxCleanupMinutes))
+			return
+		}
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			// The map is read after every run, so it is replaced instead
+			// of changed.
+			channels := make(map[string]int, len(g.CleanupChannels)+1)
+			for k, v := range g.CleanupChannels {
+				channels[k] = v
+			}
+
+			if minutes == 0 {
+				delete(channels, channelID)
+			} else {
+				channels[channelID] = minutes
+			}
+			g.CleanupChannels = channels
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated the cleanup of output.\n"+describeCleanup(guildConfigs.Get(i.GuildID)))
+	case "errors":
+		public := cmd.Options[0].StringValue() == "public"
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			g.PublicErrors = public
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated the error visibility.\n"+describeErrors(guildConfigs.Get(i.GuildID)))
+	case "links":
+		enabled := cmd.Options[0].BoolValue()
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			g.LinkDetection = enabled
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated link detection.\n"+describeLinks(guildConfigs.Get(i.GuildID)))
+	case "prefix":
+		prefix := ""
+		if option, ok := optionMap(cmd.Options)["prefix"]; ok {
+			prefix = strings.TrimSpace(option.StringValue())
+		}
+		if len(prefix) > maxPrefixLength || strings.ContainsAny(prefix, " \t\n") {
+			respondEphemeral(s, i, fmt.Sprintf("The prefix can be at most %v characters, without spaces.", maxPrefixLength))
+			return
+		}
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			g.Prefix = prefix
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated text commands.\n"+describePrefix(guildConfigs.Get(i.GuildID)))
+	case "dependencies":
+		options := optionMap(cmd.Options)
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			g.Dependencies = options["enabled"].BoolValue()
+			if option, ok := options["install_timeout"]; ok && option.IntValue() >= 0 {
+				g.InstallTimeout = int(option.IntValue())
+			}
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated dependency installation.\n"+describeDependencies(guildConfigs.Get(i.GuildID)))
+	case "output":
+		options := optionMap(cmd.Options)
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			if option, ok := options["style"]; ok {
+				g.OutputStyle = option.StringValue()
+			}
+			if option, ok := options["collapse"]; ok {
+				g.OutputCollapse = option.StringValue()
+			}
+			if option, ok := options["page_size"]; ok {
+				// Pages must fit in a message, and hold more than the fences.
+				g.OutputPageSize = int(option.IntValue())
+				if g.OutputPageSize != 0 && g.OutputPageSize < minOutputPageSize {
+					g.OutputPageSize = minOutputPageSize
+				}
+			}
+			if option, ok := options["max_pages"]; ok && option.IntValue() >= 0 {
+				g.OutputMaxPages = int(option.IntValue())
+			}
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated the output settings.\n"+describeOutput(guildConfigs.Get(i.GuildID)))
+	case "roles":
+		options := optionMap(cmd.Options)
+		command := options["command"].StringValue()
+		roleID := options["role"].RoleValue(nil, "").ID
+		mode := options["mode"].StringValue()
+
+		if !isCommand(command) {
+			respondEphemeral(s, i, fmt.Sprintf("There is no command named %v.", command))
+			return
+		}
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			// The map is read by every interaction, so it is replaced
+			// instead of changed.
+			commandRoles := make(map[string][]string, len(g.CommandRoles)+1)
+			for k, v := range g.CommandRoles {
+				commandRoles[k] = v
+			}
+
+			roles := removeString(commandRoles[command], roleID)
+			if mode == "add" {
+				roles = append(roles, roleID)
+			}
+
+			if len(roles) == 0 {
+				delete(commandRoles, command)
+			} else {
+				commandRoles[command] = roles
+			}
+			g.CommandRoles = commandRoles
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated the roles.\n"+describeRoles(guildConfigs.Get(i.GuildID)))
+	case "blocklist":
+		configBlocklistHandler(s, i, cmd.Options[0])
+	case "modlog", "audit":
+		channelID := ""
+		if len(cmd.Options) > 0 {
+			channelID = cmd.Options[0].ChannelValue(nil).ID
+		}
+
+		err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+			if cmd.Name == "audit" {
+				g.AuditChannel = channelID
+			} else {
+				g.ModLogChannel = channelID
+			}
+		})
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("guild_id", i.GuildID).
+				Msg("Error saving guild config.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+			return
+		}
+
+		respondEphemeral(s, i, "Updated the log channels.\n"+describeBlocklist(guildConfigs.Get(i.GuildID)))
+	case "alias":
+		configAliasHandler(s, i, cmd.Options[0])
+	}
+}
+
+// configBlocklistHandler adds or removes a blocked pattern in a guild.
+func configBlocklistHandler(s Discord, i *discordgo.InteractionCreate, cmd *discordgo.ApplicationCommandInteractionDataOption) {
+	pattern := cmd.Options[0].StringValue()
+	g := guildConfigs.Get(i.GuildID)
+
+	switch cmd.Name {
+	case "add":
+		if stringInSlice(pattern, g.BlockedPatterns) {
+			respondEphemeral(s, i, "That pattern is already blocked.")
+			return
+		}
+		if len(g.BlockedPatterns) >= maxBlockedPatterns {
+			respondEphemeral(s, i, fmt.Sprintf("At most %d patterns can be blocked.", maxBlockedPatterns))
+			return
+		}
+
+		_, err := compileBlockedPattern(pattern)
+		if err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("That isn't a valid regular expression.```\n%v\n```", err))
+			return
+		}
+	case "remove":
+		if !stringInSlice(pattern, g.BlockedPatterns) {
+			respondEphemeral(s, i, "That pattern isn't blocked.")
+			return
+		}
+	}
+
+	err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+		g.BlockedPatterns = removeString(g.BlockedPatterns, pattern)
+		if cmd.Name == "add" {
+			g.BlockedPatterns = append(g.BlockedPatterns, pattern)
+		}
+	})
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("guild_id", i.GuildID).
+			Msg("Error saving guild config.")
+
+		respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+		return
+	}
+
+	respondEphemeral(s, i, "Updated the blocked patterns.\n"+describeBlocklist(guildConfigs.Get(i.GuildID)))
+}
+
+// describeBlocklist formats the blocked patterns and log channels of a guild
+// for a message.
+func describeBlocklist(g GuildConfig) string {
+	patterns := "None"
+	if len(g.BlockedPatterns) > 0 {
+		quoted := make([]string, len(g.BlockedPatterns))
+		for n, p := range g.BlockedPatterns {
+			quoted[n] = "`" + strings.ReplaceAll(p, "`", "'") + "`"
+		}
+		patterns = strings.Join(quoted, ", ")
+	}
+
+	modLog := "None"
+	if g.ModLogChannel != "" {
+		modLog = "<#" + g.ModLogChannel + ">"
+	}
+
+	audit := "None"
+	if g.AuditChannel != "" {
+		audit = "<#" + g.AuditChannel + ">"
+	}
+
+	return fmt.Sprintf("**Blocked Patterns**\n%v\nMod log: %v\nAudit log: %v", patterns, modLog, audit)
+}
+
+// configAliasHandler adds or removes an alias of a language in a guild.
+func configAliasHandler(s Discord, i *discordgo.InteractionCreate, cmd *discordgo.ApplicationCommandInteractionDataOption) {
+	options := optionMap(cmd.Options)
+	alias := strings.ToLower(strings.TrimSpace(options["alias"].StringValue()))
+
+	var lang string
+	switch cmd.Name {
+	case "add":
+		if alias == "" || strings.ContainsAny(alias, " \t`") {
+			respondEphemeral(s, i, "Aliases can't be empty or contain spaces or backticks.")
+			return
+		}
+		if resolveLanguage(alias) != "" {
+			respondEphemeral(s, i, fmt.Sprintf("`%v` is already a language or one of its aliases.", alias))
+			return
+		}
+
+		lang = resolveLanguage(options["language"].StringValue())
+		if lang == "" {
+			respondEphemeral(s, i, tr(i.Locale, "error.language_unsupported", options["language"].StringValue(), getLanguages()))
+			return
+		}
+	case "remove":
+		if _, ok := guildConfigs.Get(i.GuildID).Aliases[alias]; !ok {
+			respondEphemeral(s, i, fmt.Sprintf("`%v` isn't an alias added in this server.", alias))
+			return
+		}
+	}
+
+	err := guildConfigs.Update(i.GuildID, func(g *GuildConfig) {
+		// Copies of the configuration share the map, so it is replaced
+		// instead of changed while it may be read.
+		aliases := make(map[string]string, len(g.Aliases)+1)
+		for k, v := range g.Aliases {
+			aliases[k] = v
+		}
+
+		if lang == "" {
+			delete(aliases, alias)
+		} else {
+			aliases[alias] = lang
+		}
+		g.Aliases = aliases
+	})
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("guild_id", i.GuildID).
+			Msg("Error saving guild config.")
+
+		respondEphemeral(s, i, fmt.Sprintf("Error saving configuration.```\n%v\n```", err))
+		return
+	}
+
+	respondEphemeral(s, i, "Updated the aliases.\n"+describeAliases(guildConfigs.Get(i.GuildID)))
+}
+
+// describeAliases formats the aliases added in a guild for a message.
+func describeAliases(g GuildConfig) string {
+	if len(g.Aliases) == 0 {
+		return "**Aliases**\nNone"
+	}
+
+	lines := make([]string, 0, len(g.Aliases))
+	for alias, lang := range g.Aliases {
+		lines = append(lines, fmt.Sprintf("`%v` → %v", alias, lang))
+	}
+	sort.Strings(lines)
+
+	return "**Aliases**\n" + strings.Join(lines, "\n")
+}
+
+// checkChannel checks that code can be run in the channel of an interaction,
+// sending an ephemeral message if it can't.
+func checkChannel(s Discord, i *discordgo.InteractionCreate) bool {
+	g := guildConfigs.Get(i.GuildID)
+	if g.ChannelAllowed(i.ChannelID, threadParent(s, i.ChannelID)) {
+		return true
+	}
+
+	content := tr(i.Locale, "error.channel_disabled")
+	if len(g.AllowedChannels) > 0 {
+		content += tr(i.Locale, "error.channel_suggestion", mentionChannels(g.AllowedChannels))
+	}
+	respondEphemeral(s, i, content)
+
+	return false
+}
+
+// describeChannels formats the channels code can be run in for a message.
+func describeChannels(g GuildConfig) string {
+	allowed := "All channels"
+	if len(g.AllowedChannels) > 0 {
+		allowed = mentionChannels(g.AllowedChannels)
+	}
+
+	denied := "None"
+	if len(g.DeniedChannels) > 0 {
+		denied = mentionChannels(g.DeniedChannels)
+	}
+
+	return fmt.Sprintf("**Channels**\nAllowed: %v\nDenied: %v", allowed, denied)
+}
+
+// describeErrors formats who can see error messages for a message.
+func describeErrors(g GuildConfig) string {
+	if g.PublicErrors {
+		return "**Errors**\nVisible to everyone"
+	}
+	return "**Errors**\nOnly visible to the user"
+}
+
+// describeLinks formats whether linked code messages can be run for a message.
+func describeLinks(g GuildConfig) string {
+	if g.LinkDetection {
+		return "**Message Links**\nLinked code messages can be run"
+	}
+	return "**Message Links**\nNot detected"
+}
+
+// describeOutput formats how output is shown for a message.
+func describeOutput(g GuildConfig) string {
+	style := "Embeds"
+	if g.OutputStyle == OutputStyleText {
+		style = "Code blocks"
+	}
+
+	switch g.OutputCollapse {
+	case OutputCollapseSpoiler:
+		style += ", behind spoiler tags"
+	case OutputCollapseThread:
+		style += ", in a thread"
+	}
+
+	size, maxPages := guildOutputPages(g)
+	style += fmt.Sprintf("\nCode blocks have pages of %v characters, cut off after %v pages", size, maxPages)
+
+	return "**Output**\n" + style
+}
+
+// mentionChannels formats channel IDs as mentions.
+func mentionChannels(ids []string) string {
+	mentions := make([]string, len(ids))
+	for n, id := range ids {
+		mentions[n] = "<#" + id + ">"
+	}
+	return strings.Join(mentions, ", ")
+}
+
+// describeLimits formats resource limits for a message.
+func describeLimits(l Limits, maxTimeout int) string {
+	value := func(v int, unit string) string {
+		if v == 0 {
+			return "Piston default"
+		}
+		return fmt.Sprintf("%d %v", v, unit)
+	}
+
+	return fmt.Sprintf(
+		"**Resource Limits**\nCompile timeout: %v\nRun timeout: %v\nCompile memory limit: %v\nRun memory limit: %v\nMaximum timeout option: %v",
+		value(l.CompileTimeout, "ms"),
+		value(l.RunTimeout, "ms"),
+		value(l.CompileMemoryLimit, "bytes"),
+		value(l.RunMemoryLimit, "bytes"),
+		value(maxTimeout, "s"),
+	)
+}
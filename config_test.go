@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestConfigLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		option string
+		value  int
+		want   string
+		saved  int
+	}{
+		{"negative", "run_timeout", -1, "`run_timeout` can't be negative.", 0},
+		{"above the executor default", "run_timeout", executorDefaultLimits.RunTimeout + 1, "`run_timeout` can be at most 3000.", 0},
+		{"above the maximum timeout", "max_timeout", MAX_RUN_TIMEOUT + 1, "`max_timeout` can be at most 30.", 0},
+		{"allowed", "run_timeout", 2000, "Updated the resource limits.", 2000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guildID := "limits " + tt.name
+			s := newFakeDiscord()
+			i := newCommand("config", &discordgo.ApplicationCommandInteractionDataOption{
+				Name: "limits",
+				Type: discordgo.ApplicationCommandOptionSubCommand,
+				Options: []*discordgo.ApplicationCommandInteractionDataOption{{
+					Name:  tt.option,
+					Type:  discordgo.ApplicationCommandOptionInteger,
+					Value: float64(tt.value),
+				}},
+			})
+			i.GuildID = guildID
+			i.Member.Permissions = discordgo.PermissionManageServer
+
+			configHandler(context.Background(), s, i)
+
+			output := strings.Join(s.contents(), "\n")
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, output)
+			}
+
+			g := guildConfigs.Get(guildID)
+			if g.Limits.RunTimeout != tt.saved || g.MaxTimeout != 0 {
+				t.Errorf("expected a run timeout of %d to be saved, got %+v", tt.saved, g)
+			}
+		})
+	}
+}
+
+func TestConfigStoreUpdateFailed(t *testing.T) {
+	c, err := LoadConfigStore(filepath.Join(t.TempDir(), "missing", "guilds.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.guilds["guild"] = &GuildConfig{Prefix: "!"}
+
+	err = c.Update("guild", func(g *GuildConfig) {
+		g.Prefix = "?"
+	})
+	if err == nil {
+		t.Fatal("expected the configuration not to be saved")
+	}
+	if g := c.Get("guild"); g.Prefix != "!" {
+		t.Errorf("expected the configuration to be unchanged, got prefix %q", g.Prefix)
+	}
+
+	err = c.Update("new", func(g *GuildConfig) {
+		g.Prefix = "?"
+	})
+	if err == nil {
+		t.Fatal("expected the configuration not to be saved")
+	}
+	if _, ok := c.guilds["new"]; ok {
+		t.Error("expected no configuration for the new guild")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord accepts responses and followups to an interaction for 15 minutes
+// after it is created.
+const interactionLifetime = 15 * time.Minute
+
+// contextMiddleware gives an interaction a context that is cancelled once
+// Discord no longer accepts responses to it, or once it has been handled, so
+// that requests made for it don't outlive it.
+func contextMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		created, err := discordgo.SnowflakeTimestamp(i.ID)
+		if err != nil {
+			created = time.Now()
+		}
+
+		ctx, cancel := context.WithDeadline(ctx, created.Add(interactionLifetime))
+		defer cancel()
+
+		next(ctx, s, i)
+	}
+}
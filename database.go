@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/storage"
+)
+
+// Database storing the configuration, preferences, history and challenges,
+// or nil if they are stored in files.
+var database *storage.DB
+
+// Kinds of documents stored in the database.
+const (
+	documentGuildConfig = "guild_config"
+	documentUserPrefs   = "user_prefs"
+	documentChallenge   = "challenge"
+	documentSnippets    = "snippets"
+	documentTags        = "tags"
+)
+
+// loadDocuments loads the documents of a kind from the database into v, a
+// pointer to a map by key. If the database has none, they are imported from
+// the JSON file at path, if it exists, so that switching to the database
+// keeps the existing data.
+func loadDocuments(kind string, path string, v interface{}) error {
+	documents, err := database.Documents(kind)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]json.RawMessage, len(documents))
+	for key, data := range documents {
+		values[key] = data
+	}
+
+	if len(values) == 0 {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(data, &values)
+		if err != nil {
+			return err
+		}
+
+		for key, data := range values {
+			err := database.PutDocument(kind, key, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// saveDocument saves a value as a document in the database.
+func saveDocument(kind string, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return database.PutDocument(kind, key, data)
+}
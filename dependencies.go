@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Maximum number of packages that can be installed before running code.
+const maxDependencies = 10
+
+// Matches a package to install, with an optional version, e.g. "requests",
+// "numpy==1.26", or "lodash@4".
+var dependencyRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/@=<>~^:+-]{0,99}$`)
+
+// Option for installing packages before running code.
+var requirementsOption = &discordgo.ApplicationCommandOption{
+	Name:        "requirements",
+	Description: "Packages to install before running, separated by spaces, if the server allows it.",
+	Type:        discordgo.ApplicationCommandOptionString,
+	Required:    false,
+}
+
+// parseDependencies parses packages to install, separated by spaces or
+// commas.
+func parseDependencies(v string) ([]string, error) {
+	deps := strings.FieldsFunc(v, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(deps) > maxDependencies {
+		return nil, fmt.Errorf("at most %v packages can be installed", maxDependencies)
+	}
+
+	for _, dep := range deps {
+		if !dependencyRegex.MatchString(dep) {
+			return nil, fmt.Errorf("%q is not a valid package", dep)
+		}
+	}
+
+	return deps, nil
+}
+
+// guildInstallTimeout returns the maximum time for installing dependencies in
+// a guild, in seconds.
+func guildInstallTimeout(guildID string) int {
+	return limit(guildConfigs.Get(guildID).InstallTimeout, MAX_INSTALL_TIMEOUT)
+}
+
+// describeDependencies formats whether dependencies can be installed for a
+// message.
+func describeDependencies(g GuildConfig) string {
+	if g.Dependencies {
+		return fmt.Sprintf("**Dependencies**\nInstalled for up to %v seconds", limit(g.InstallTimeout, MAX_INSTALL_TIMEOUT))
+	}
+	return "**Dependencies**\nNot installed"
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Matches a shebang, e.g. "#!/usr/bin/env python3" or "#!/bin/bash".
+var shebangRegex = regexp.MustCompile(`^#!\s*\S*?(?:/env\s+)?(?:.*/)?([a-z]+)[0-9.]*\b`)
+
+// Interpreters named in shebangs, mapped to their languages.
+var shebangLanguages = map[string]string{
+	"python": "python",
+	"node":   "javascript",
+	"deno":   "typescript",
+	"bash":   "bash",
+	"sh":     "bash",
+	"ruby":   "ruby",
+	"perl":   "perl",
+	"php":    "php",
+	"lua":    "lua",
+}
+
+// languageHint is a pattern that suggests code is written in a language.
+type languageHint struct {
+	Language string
+	Pattern  *regexp.Regexp
+	Weight   int
+}
+
+func hint(lang string, weight int, pattern string) languageHint {
+	return languageHint{
+		Language: lang,
+		Pattern:  regexp.MustCompile(`(?m)` + pattern),
+		Weight:   weight,
+	}
+}
+
+// Patterns used to guess the language of code. Distinctive patterns have a
+// higher weight than ones shared between languages.
+var languageHints = []languageHint{
+	hint("python", 3, `^\s*def \w+\(.*\)\s*(->.*)?:\s*$`),
+	hint("python", 3, `^\s*from [\w.]+ import `),
+	hint("python", 3, `if __name__ == ['"]__main__['"]:`),
+	hint("python", 2, `^\s*(elif|for .+ in .+|while .+|if .+|else)\s*:\s*$`),
+	hint("python", 1, `^\s*import \w+\s*$`),
+	hint("python", 1, `\bprint\(`),
+	hint("javascript", 3, `\bconsole\.log\(`),
+	hint("javascript", 2, `\bfunction\s*\w*\s*\(`),
+	hint("javascript", 2, `\brequire\(['"]`),
+	hint("javascript", 1, `\b(const|let)\s+\w+\s*=`),
+	hint("javascript", 1, `=>`),
+	hint("typescript", 2, `\b(const|let)\s+\w+\s*:\s*(string|number|boolean|any)\b`),
+	hint("typescript", 2, `\binterface\s+\w+\s*\{`),
+	hint("typescript", 2, `\)\s*:\s*(string|number|boolean|void)\s*\{`),
+	hint("go", 4, `^package main\s*$`),
+	hint("go", 3, `\bfmt\.Print`),
+	hint("go", 2, `\bfunc\s+(\(\w+ \*?\w+\)\s*)?\w+\(`),
+	hint("go", 1, `:=`),
+	hint("c", 3, `#include\s*<(stdio|stdlib|string)\.h>`),
+	hint("c", 2, `\bprintf\(`),
+	hint("c", 1, `\bint main\(`),
+	hint("c++", 4, `#include\s*<(iostream|vector|string|bits/stdc\+\+\.h)>`),
+	hint("c++", 3, `\bstd::`),
+	hint("c++", 2, `\b(cout|cin)\s*(<<|>>)`),
+	hint("c++", 2, `\busing namespace std;`),
+	hint("c++", 1, `\bint main\(`),
+	hint("java", 4, `\bpublic static void main\(`),
+	hint("java", 3, `\bSystem\.out\.print`),
+	hint("java", 1, `\bpublic class\b`),
+	hint("csharp", 4, `\bConsole\.Write`),
+	hint("csharp", 3, `\busing System;`),
+	hint("csharp", 1, `\bstatic void Main\(`),
+	hint("rust", 4, `\bfn main\(\)`),
+	hint("rust", 3, `\bprintln!\(`),
+	hint("rust", 2, `\blet mut\b`),
+	hint("kotlin", 4, `\bfun main\(`),
+	hint("kotlin", 1, `\bval \w+\s*=`),
+	hint("ruby", 3, `^\s*puts\b`),
+	hint("ruby", 2, `^\s*def \w+(\(.*\))?\s*$`),
+	hint("ruby", 1, `^\s*end\s*$`),
+	hint("lua", 3, `\blocal\s+\w+\s*=`),
+	hint("lua", 2, `\bthen\s*$`),
+	hint("lua", 1, `^\s*end\s*$`),
+	hint("php", 5, `<\?php`),
+	hint("php", 1, `\$\w+\s*=`),
+	hint("bash", 3, `^\s*(fi|done|esac)\s*$`),
+	hint("bash", 2, `^\s*echo\s`),
+	hint("bash", 1, `\$\{?\w+\}?`),
+	hint("haskell", 4, `\bputStrLn\b`),
+	hint("haskell", 3, `^\w+\s*::\s*.+$`),
+}
+
+// Minimum score for a guess to be suggested.
+const minDetectionScore = 3
+
+// detectLanguage guesses the language of code from its shebang, or from
+// patterns common in each language. An empty string is returned if no
+// supported language is a good enough guess.
+func detectLanguage(code string) string {
+	code = strings.TrimSpace(code)
+
+	if match := shebangRegex.FindStringSubmatch(code); match != nil {
+		if lang, ok := shebangLanguages[match[1]]; ok {
+			return resolveLanguage(lang)
+		}
+	}
+
+	scores := make(map[string]int)
+	for _, h := range languageHints {
+		if h.Pattern.MatchString(code) {
+			scores[h.Language] += h.Weight
+		}
+	}
+
+	best, bestScore := "", 0
+	for _, h := range languageHints {
+		if scores[h.Language] > bestScore {
+			best, bestScore = h.Language, scores[h.Language]
+		}
+	}
+
+	if bestScore < minDetectionScore {
+		return ""
+	}
+
+	return resolveLanguage(best)
+}
+
+// suggestLanguage guesses the language of code without one, and asks the user
+// to confirm it with a button that runs the code. If there is no guess,
+// nothing is sent and false is returned.
+func suggestLanguage(w *ResponseWriter, files []piston.File, limits Limits) bool {
+	params := languageSuggestion(w.Interaction.ID, files, limits)
+	if params == nil {
+		return false
+	}
+
+	w.Send(params)
+	return true
+}
+
+// languageSuggestion guesses the language of code without one, and returns a
+// message asking to run it as that language, storing the code under an ID
+// for the button. If there is no guess, nil is returned.
+func languageSuggestion(id string, files []piston.File, limits Limits) *discordgo.WebhookParams {
+	if len(files) == 0 {
+		return nil
+	}
+
+	lang := detectLanguage(files[0].Content)
+	if lang == "" {
+		return nil
+	}
+
+	log.Debug().
+		Str("language", lang).
+		Msg("Language detected from code.")
+
+	storeRun(id, storedRun{
+		Language: lang,
+		Files:    applyTemplate(lang, files),
+		Limits:   limits,
+	})
+
+	return &discordgo.WebhookParams{
+		Content: fmt.Sprintf("No language provided, but this looks like **%v**. Run it as %v? (Put the language after the opening backticks to skip this, e.g. ```py)", lang, lang),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Run as " + lang,
+						Style:    discordgo.SuccessButton,
+						CustomID: "confirm_language:" + id,
+					},
+				},
+			},
+		},
+	}
+}
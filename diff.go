@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of lines of each output that are compared, since the diff
+// takes time proportional to the product of their lengths.
+const diffMaxLines = 1000
+
+// Number of unchanged lines shown around each change in a diff.
+const diffContext = 3
+
+// diffOp is a line of a diff: ' ' if unchanged, '-' if removed, '+' if added.
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// diffLines returns the changes from a to b, using their longest common subsequence.
+func diffLines(a []string, b []string) []diffOp {
+	// lcs[x][y] is the length of the longest common subsequence of a[x:] and b[y:].
+	lcs := make([][]int, len(a)+1)
+	for x := range lcs {
+		lcs[x] = make([]int, len(b)+1)
+	}
+	for x := len(a) - 1; x >= 0; x-- {
+		for y := len(b) - 1; y >= 0; y-- {
+			if a[x] == b[y] {
+				lcs[x][y] = lcs[x+1][y+1] + 1
+			} else if lcs[x+1][y] >= lcs[x][y+1] {
+				lcs[x][y] = lcs[x+1][y]
+			} else {
+				lcs[x][y] = lcs[x][y+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	x, y := 0, 0
+	for x < len(a) && y < len(b) {
+		switch {
+		case a[x] == b[y]:
+			ops = append(ops, diffOp{' ', a[x]})
+			x++
+			y++
+		case lcs[x+1][y] >= lcs[x][y+1]:
+			ops = append(ops, diffOp{'-', a[x]})
+			x++
+		default:
+			ops = append(ops, diffOp{'+', b[y]})
+			y++
+		}
+	}
+	for ; x < len(a); x++ {
+		ops = append(ops, diffOp{'-', a[x]})
+	}
+	for ; y < len(b); y++ {
+		ops = append(ops, diffOp{'+', b[y]})
+	}
+	return ops
+}
+
+// unifiedDiff formats the changes from a to b as a unified diff with hunk
+// headers, or returns an empty string if they are the same.
+func unifiedDiff(a []string, b []string, nameA string, nameB string) string {
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %v\n+++ %v\n", nameA, nameB)
+
+	changed := false
+	for start := 0; start < len(ops); {
+		// Find the next change.
+		for start < len(ops) && ops[start].Kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		changed = true
+
+		// Extend the hunk until there are more unchanged lines than fit in
+		// the context of two hunks.
+		end := start
+		for end < len(ops) {
+			if ops[end].Kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].Kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+
+		from, to := start-diffContext, end+diffContext
+		if from < 0 {
+			from = 0
+		}
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		// Line numbers of the hunk in a and b, which start at 1.
+		lineA, lineB := 1, 1
+		for _, op := range ops[:from] {
+			if op.Kind != '+' {
+				lineA++
+			}
+			if op.Kind != '-' {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		for _, op := range ops[from:to] {
+			if op.Kind != '+' {
+				countA++
+			}
+			if op.Kind != '-' {
+				countB++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", lineA, countA, lineB, countB)
+		for _, op := range ops[from:to] {
+			out.WriteByte(op.Kind)
+			out.WriteString(op.Line)
+			out.WriteByte('\n')
+		}
+
+		start = to
+	}
+
+	if !changed {
+		return ""
+	}
+	return out.String()
+}
+
+// Diff command definition.
+var diffCommand = &discordgo.ApplicationCommand{
+	Name:        "diff",
+	Description: "Runs two code messages with the same input and shows how their outputs differ.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "reference",
+			Description: "A link to or the ID of the message with the reference solution.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+		},
+		{
+			Name:        "solution",
+			Description: "A link to or the ID of the message with the solution to compare.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+		},
+		{
+			Name:        "stdin",
+			Description: "The input given to both solutions.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+	},
+}
+
+func diffHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+	options := optionMap(i.ApplicationCommandData().Options)
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	stdin := ""
+	if option, ok := options["stdin"]; ok {
+		stdin = option.StringValue()
+	}
+
+	limits := guildLimits(i.GuildID)
+	var outputs [2][]string
+	footers := [2]string{"Reference", "Solution"}
+	for n, name := range []string{"reference", "solution"} {
+		message, ok := getTargetMessage(w, options[name].StringValue(), "")
+		if !ok {
+			return
+		}
+
+		lang, version, files, ok := getCodeFromMessage(w, message, "", "", limits)
+		if !ok {
+			return
+		}
+
+		result, ok := runDiffSide(w, name, lang, version, files, stdin, limits)
+		if !ok {
+			return
+		}
+
+		outputs[n] = normalizeOutput(stripControlSequences(fullOutput(result)))
+		if len(outputs[n]) > diffMaxLines {
+			outputs[n] = outputs[n][:diffMaxLines]
+		}
+		footers[n] += ": " + resultFooter(result)
+	}
+
+	diff := unifiedDiff(outputs[0], outputs[1], "reference", "solution")
+	summary := strings.Join(footers[:], "\n")
+	if diff == "" {
+		w.Send(&discordgo.WebhookParams{
+			Content: "Both outputs are the same.\n" + summary,
+		})
+		return
+	}
+
+	content := fmt.Sprintf("```diff\n%v```\n%v", sanitizeOutput(diff), summary)
+
+	// Long diffs are attached as a file.
+	if len(content) > 2000 {
+		link, files := attachLong("output.diff", diff)
+		content := "The outputs differ. The diff is attached.\n" + summary
+		if link != "" {
+			content = fmt.Sprintf("The outputs differ. The diff is at %v\n%v", link, summary)
+		}
+		w.Send(&discordgo.WebhookParams{
+			Content: content,
+			Files:   files,
+		})
+		return
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Content: content,
+	})
+}
+
+// runDiffSide runs one of the solutions being compared. If it can't be run,
+// an error is sent and ok is false.
+func runDiffSide(w *ResponseWriter, name string, lang string, version string, files []piston.File, stdin string, limits Limits) (*piston.ExecuteResponse, bool) {
+	var result *piston.ExecuteResponse
+	release, err := execQueue.Acquire(w.Context(), nil)
+	if err == nil {
+		result, err = Execute(w.Context(), ExecRequest{
+			Language: lang,
+			Version:  version,
+			Files:    files,
+			Stdin:    stdin,
+			Limits:   limits,
+		})
+		release()
+	}
+	i := w.Interaction
+	auditExecution(w.Session, i.ChannelID, interactionUser(i).ID, i.GuildID, executionID(result, err), lang, files, executionStatus(result, err))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+
+		w.Error(execErrorMessage("the "+name, err))
+		return nil, false
+	}
+
+	return result, true
+}
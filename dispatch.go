@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// HandlerFunc handles an interaction.
+type HandlerFunc func(ctx context.Context, s Discord, i *discordgo.InteractionCreate)
+
+// Middleware wraps a handler, e.g. to check the interaction before it is
+// handled or to record it afterwards.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Dispatcher routes interactions to their handlers by the name of the
+// command, or the prefix of the custom ID of components and modals.
+type Dispatcher struct {
+	Commands     map[string]HandlerFunc
+	Autocomplete map[string]HandlerFunc
+	Components   map[string]HandlerFunc
+	Modals       map[string]HandlerFunc
+
+	// Commands and components that are rate limited, by the name they are
+	// handled by.
+	RateLimited map[string]bool
+
+	middleware []Middleware
+}
+
+// Use adds middleware that wraps every handler. Middleware added first runs
+// first.
+func (d *Dispatcher) Use(middleware ...Middleware) {
+	d.middleware = append(d.middleware, middleware...)
+}
+
+// Handle runs the handler of an interaction with the middleware. Interactions
+// without a handler are ignored.
+func (d *Dispatcher) Handle(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var handlers map[string]HandlerFunc
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		handlers = d.Commands
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		handlers = d.Autocomplete
+	case discordgo.InteractionMessageComponent:
+		handlers = d.Components
+	case discordgo.InteractionModalSubmit:
+		handlers = d.Modals
+	}
+
+	h, ok := handlers[interactionName(i)]
+	if !ok {
+		return
+	}
+
+	withMiddleware(h, d.middleware...)(context.Background(), s, i)
+}
+
+// withMiddleware wraps a handler with middleware, with the first middleware
+// running first.
+func withMiddleware(h HandlerFunc, middleware ...Middleware) HandlerFunc {
+	for n := len(middleware) - 1; n >= 0; n-- {
+		h = middleware[n](h)
+	}
+	return h
+}
+
+// interactionName returns the name an interaction is handled by: the name of
+// the command, or the prefix of the custom ID of a component or modal.
+func interactionName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		return i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		// Component custom IDs are of the form "<name>:<data>".
+		return strings.SplitN(i.MessageComponentData().CustomID, ":", 2)[0]
+	case discordgo.InteractionModalSubmit:
+		// Modal custom IDs are of the form "<name>:<data>".
+		return strings.SplitN(i.ModalSubmitData().CustomID, ":", 2)[0]
+	}
+	return ""
+}
+
+// interactionUser returns the user of an interaction, which is only a member
+// in guilds.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// interactionCommand returns the command an interaction belongs to, which
+// decides who can use it.
+func interactionCommand(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionMessageComponent, discordgo.InteractionModalSubmit:
+		return componentCommands[interactionName(i)]
+	}
+	return interactionName(i)
+}
+
+// recoverMiddleware recovers from panics in handlers, logging the stack and
+// telling the user something went wrong instead of leaving the interaction
+// unanswered.
+func recoverMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			log.Error().
+				Str("panic", fmt.Sprint(r)).
+				Str("stack", string(debug.Stack())).
+				Str("interaction", interactionName(i)).
+				Str("user_id", interactionUser(i).ID).
+				Str("guild_id", i.GuildID).
+				Int("shard", shardID(s)).
+				Msg("Panic while handling interaction.")
+			handlerPanics.Inc()
+
+			if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+				return
+			}
+			reportInternalError(s, i)
+		}()
+
+		next(ctx, s, i)
+	}
+}
+
+// reportInternalError tells the user of an interaction that it failed. If the
+// interaction was already responded to or deferred, a followup is sent, which
+// also replaces a deferred "thinking" message.
+func reportInternalError(s Discord, i *discordgo.InteractionCreate) {
+	content := tr(i.Locale, "error.internal")
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		},
+	)
+	if err == nil {
+		return
+	}
+
+	_, err = s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending followup message.")
+	}
+}
+
+// recoverEvent recovers from a panic in an event handler, logging the stack.
+// It must be deferred.
+func recoverEvent(event string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	log.Error().
+		Str("panic", fmt.Sprint(r)).
+		Str("stack", string(debug.Stack())).
+		Str("event", event).
+		Msg("Panic while handling event.")
+	handlerPanics.Inc()
+}
+
+// loggingMiddleware logs interactions once they have been handled.
+func loggingMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		next(ctx, s, i)
+
+		var event = log.Debug()
+		switch i.Type {
+		case discordgo.InteractionApplicationCommand:
+			event.Str("command", i.ApplicationCommandData().Name)
+		case discordgo.InteractionMessageComponent:
+			event.Str("component", i.MessageComponentData().CustomID)
+		case discordgo.InteractionModalSubmit:
+			event.Str("modal", i.ModalSubmitData().CustomID)
+		default:
+			return
+		}
+
+		event.
+			Str("user_id",
+				interactionUser(i).ID).
+			Str("channel_id",
+				i.ChannelID).
+			Str("guild_id",
+				i.GuildID).
+			Int("shard",
+				shardID(s)).
+			Msg("Interaction recieved.")
+	}
+}
+
+// metricsMiddleware counts the interactions received, except autocompletion.
+func metricsMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		if i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+			commandsReceived.WithLabelValues(interactionName(i), strconv.Itoa(shardID(s))).Inc()
+		}
+		next(ctx, s, i)
+	}
+}
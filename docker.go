@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// DockerImage is a language that the Docker executor can run.
+type DockerImage struct {
+	Language string   `json:"language"`
+	Version  string   `json:"version"`
+	Aliases  []string `json:"aliases"`
+	Image    string   `json:"image"`
+	Main     string   `json:"main"`    // name of the main file if it isn't named
+	Compile  string   `json:"compile"` // shell command compiling the code, if any
+	Run      string   `json:"run"`     // shell command running the code
+
+	// Shell command installing dependencies into /deps, with network access,
+	// before the code is compiled. The packages to install are given in
+	// $DEPENDENCIES. If it is empty, dependencies can't be installed.
+	Install string `json:"install,omitempty"`
+	// Files listing dependencies, e.g. go.mod, that are installed whenever
+	// one of them is given.
+	Manifests []string `json:"manifests,omitempty"`
+}
+
+// Images used by the Docker executor when no images file is given. Compiled
+// programs are written to /tmp, since the code directory is read-only.
+var defaultDockerImages = []DockerImage{
+	{
+		Language: "python", Version: "3.12", Aliases: []string{"py", "python3"}, Image: "python:3.12-alpine", Main: "main.py", Run: "PYTHONPATH=/deps python3 main.py",
+		Install:   "pip install --quiet --no-cache-dir --target /deps $DEPENDENCIES $([ -f requirements.txt ] && echo -r requirements.txt)",
+		Manifests: []string{"requirements.txt"},
+	},
+	{
+		Language: "javascript", Version: "20", Aliases: []string{"js", "node"}, Image: "node:20-alpine", Main: "main.js", Run: "NODE_PATH=/deps/node_modules node main.js",
+		Install:   "cp package.json /deps 2>/dev/null; cd /deps && HOME=/tmp npm install --silent --no-audit --no-fund $DEPENDENCIES",
+		Manifests: []string{"package.json"},
+	},
+	{
+		Language: "go", Version: "1.22", Aliases: []string{"golang"}, Image: "golang:1.22-alpine", Main: "main.go",
+		Compile:   "if [ -f go.mod ]; then cp -r . /tmp/src && cd /tmp/src && GOCACHE=/tmp/.cache GOPATH=/deps/go GOPROXY=off GONOSUMDB=* GOFLAGS=-mod=mod go build -o /tmp/main .; else GOCACHE=/tmp/.cache GOPATH=/tmp/go go build -o /tmp/main main.go; fi",
+		Run:       "/tmp/main",
+		Install:   "[ -z \"$DEPENDENCIES\" ] || { echo 'Give the dependencies of Go code in a go.mod file.' >&2; exit 1; }; cp -r . /tmp/src && cd /tmp/src && GOPATH=/deps/go GOFLAGS=-mod=mod go mod download",
+		Manifests: []string{"go.mod"},
+	},
+	{Language: "c", Version: "13", Aliases: []string{"gcc"}, Image: "gcc:13", Main: "main.c", Compile: "gcc -O2 -o /tmp/main *.c -lm", Run: "/tmp/main"},
+	{Language: "c++", Version: "13", Aliases: []string{"cpp", "g++"}, Image: "gcc:13", Main: "main.cpp", Compile: "g++ -O2 -o /tmp/main *.cpp", Run: "/tmp/main"},
+	{Language: "rust", Version: "1.77", Aliases: []string{"rs"}, Image: "rust:1.77-slim", Main: "main.rs", Compile: "rustc -O -o /tmp/main main.rs", Run: "/tmp/main"},
+	{Language: "java", Version: "21", Image: "eclipse-temurin:21", Main: "Main.java", Run: "java Main.java"},
+	{Language: "bash", Version: "5", Aliases: []string{"sh"}, Image: "bash:5", Main: "main.sh", Run: "bash main.sh"},
+}
+
+// DockerExecutor runs code locally in ephemeral Docker containers without
+// network access, with the CPU and memory of each container limited.
+type DockerExecutor struct {
+	Binary string // Docker CLI binary, e.g. docker
+	Images []DockerImage
+	CPUs   string // CPUs of each container, e.g. 0.5
+	Memory int    // bytes of memory of each container; requests can only lower it
+}
+
+func NewDockerExecutor(binary string, images []DockerImage, cpus string, memory int) *DockerExecutor {
+	return &DockerExecutor{
+		Binary: binary,
+		Images: images,
+		CPUs:   cpus,
+		Memory: memory,
+	}
+}
+
+// loadDockerImages loads the images of the Docker executor from a JSON file,
+// or returns the default images if no path is given.
+func loadDockerImages(path string) ([]DockerImage, error) {
+	if path == "" {
+		return defaultDockerImages, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []DockerImage
+	err = json.Unmarshal(data, &images)
+	return images, err
+}
+
+func (d *DockerExecutor) Runtimes(ctx context.Context) ([]piston.Runtime, error) {
+	runtimes := make([]piston.Runtime, len(d.Images))
+	for n, img := range d.Images {
+		runtimes[n] = piston.Runtime{
+			Language: img.Language,
+			Version:  img.Version,
+			Aliases:  img.Aliases,
+		}
+	}
+	return runtimes, nil
+}
+
+func (d *DockerExecutor) Execute(ctx context.Context, req piston.ExecuteRequest) (*piston.ExecuteResponse, error) {
+	var img *DockerImage
+	for n := range d.Images {
+		if d.Images[n].Language == req.Language && d.Images[n].Version == req.Version {
+			img = &d.Images[n]
+			break
+		}
+	}
+	if img == nil {
+		return nil, fmt.Errorf("no Docker image for %v %v: %w", req.Language, req.Version, piston.ErrUnsupportedLanguage)
+	}
+
+	// Write the files to a directory mounted in the container.
+	dir, err := os.MkdirTemp("", "coderunner-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// The container doesn't run as the bot's user, so it needs to be able to read the files.
+	err = os.Chmod(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	for n, f := range req.Files {
+		name := f.Name
+		if name == "" && n == 0 {
+			name = img.Main
+		} else if name == "" {
+			name = fmt.Sprintf("file%d", n)
+		}
+		if filepath.Base(name) != name {
+			return nil, errors.New("invalid file name " + name)
+		}
+
+		err := os.WriteFile(filepath.Join(dir, name), []byte(f.Content), 0o644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Requests can lower the memory of the container, but not raise it
+	// above DOCKER_MEMORY.
+	memory := d.Memory
+	if req.RunMemoryLimit > 0 && (memory <= 0 || req.RunMemoryLimit < memory) {
+		memory = req.RunMemoryLimit
+	}
+
+	// Install the dependencies into a directory mounted in the container.
+	deps, err := d.install(ctx, img, dir, req)
+	if err != nil {
+		return nil, err
+	}
+	if deps != "" {
+		defer os.RemoveAll(deps)
+	}
+
+	// Start a container that sleeps, so the code can be compiled and run in it separately.
+	args := []string{"run", "--detach", "--rm",
+		"--network", "none",
+		"--cpus", d.CPUs,
+		"--memory", fmt.Sprint(memory),
+		"--memory-swap", fmt.Sprint(memory),
+		"--pids-limit", "64",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--read-only",
+		"--tmpfs", "/tmp:exec,size=64m",
+		"--volume", dir + ":/code:ro",
+		"--workdir", "/code",
+	}
+	if deps != "" {
+		args = append(args, "--volume", deps+":/deps:ro")
+	}
+	for name, value := range req.Env {
+		args = append(args, "--env", name+"="+value)
+	}
+	args = append(args, img.Image, "sleep", "infinity")
+
+	out, err := exec.CommandContext(ctx, d.Binary, args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("starting container: %v: %s", err, bytes.TrimSpace(out))
+	}
+	container := strings.TrimSpace(string(out))
+
+	// Remove the container even if the request was cancelled.
+	defer func() {
+		_ = exec.Command(d.Binary, "rm", "--force", container).Run()
+	}()
+
+	start := time.Now()
+	res := &piston.ExecuteResponse{
+		Language: req.Language,
+		Version:  req.Version,
+	}
+
+	if img.Compile != "" {
+		compile, err := d.stage(ctx, container, img.Compile, "", req.CompileTimeout)
+		if err != nil {
+			return nil, err
+		}
+		res.Compile = compile
+
+		if compile.Code != 0 || compile.Signal != "" {
+			res.Duration = time.Since(start)
+			return res, nil
+		}
+	}
+
+	cpuBefore, _ := d.usage(ctx, container)
+	run, err := d.stage(ctx, container, img.Run, req.Stdin, req.RunTimeout)
+	if err != nil {
+		return nil, err
+	}
+	res.Run = *run
+
+	// Containers that timed out have been killed.
+	if run.Status != "TO" {
+		if cpu, memory := d.usage(ctx, container); cpu > 0 {
+			res.Run.CPUTime = int((cpu - cpuBefore).Milliseconds())
+			res.Run.Memory = memory
+		}
+	}
+	res.Duration = time.Since(start)
+
+	return res, nil
+}
+
+// install installs the dependencies of the code in a separate container with
+// network access, returning the directory they were installed into. It is
+// empty if there are no dependencies to install.
+func (d *DockerExecutor) install(ctx context.Context, img *DockerImage, dir string, req piston.ExecuteRequest) (string, error) {
+	manifest := false
+	for _, f := range req.Files {
+		manifest = manifest || (req.Install && stringInSlice(f.Name, img.Manifests))
+	}
+	if len(req.Dependencies) == 0 && !manifest {
+		return "", nil
+	}
+	if img.Install == "" {
+		return "", fmt.Errorf("dependencies of %v can't be installed: %w", img.Language, piston.ErrUnsupportedFeature)
+	}
+
+	deps, err := os.MkdirTemp("", "coderunner-deps-")
+	if err != nil {
+		return "", err
+	}
+
+	// The container doesn't run as the bot's user, so it needs to be able to write the dependencies.
+	err = os.Chmod(deps, 0o777)
+	if err != nil {
+		os.RemoveAll(deps)
+		return "", err
+	}
+
+	timeout := time.Duration(req.InstallTimeout) * time.Millisecond
+	if timeout == 0 {
+		timeout = PISTON_TIMEOUT
+	}
+	installCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The container is named, so that it can be removed if it times out.
+	name := filepath.Base(deps)
+	defer func() {
+		_ = exec.Command(d.Binary, "rm", "--force", name).Run()
+	}()
+
+	out, err := exec.CommandContext(installCtx, d.Binary, "run", "--rm",
+		"--name", name,
+		"--cpus", d.CPUs,
+		"--memory", fmt.Sprint(d.Memory),
+		"--pids-limit", "256",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--volume", dir+":/code:ro",
+		"--volume", deps+":/deps",
+		"--workdir", "/code",
+		"--env", "DEPENDENCIES="+strings.Join(req.Dependencies, " "),
+		img.Image, "sh", "-c", img.Install,
+	).CombinedOutput()
+
+	switch {
+	case installCtx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("installing dependencies took longer than %v", timeout)
+	case err != nil:
+		err = fmt.Errorf("installing dependencies failed: %v: %s", err, truncate(string(bytes.TrimSpace(out)), 1000))
+	}
+	if err != nil {
+		os.RemoveAll(deps)
+		return "", err
+	}
+
+	return deps, nil
+}
+
+// stage runs a shell command in a container, killing it after the timeout in
+// milliseconds.
+func (d *DockerExecutor) stage(ctx context.Context, container string, command string, stdin string, timeoutMS int) (*piston.ExecuteResults, error) {
+	timeout := time.Duration(timeoutMS) * time.Millisecond
+	if timeout == 0 {
+		timeout = PISTON_TIMEOUT
+	}
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Programs printing more than MAX_OUTPUT_SIZE are stopped.
+	capture := newOutputCapture(MAX_OUTPUT_SIZE, cancel)
+	cmd := exec.CommandContext(stageCtx, d.Binary, "exec", "--interactive", container, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = capture.Stdout()
+	cmd.Stderr = capture.Stderr()
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start)
+
+	res := &piston.ExecuteResults{
+		WallTime: int(duration.Milliseconds()),
+	}
+	capture.fill(res)
+
+	var exitErr *exec.ExitError
+	switch {
+	case res.Status == "OL":
+		res.Signal = "SIGKILL"
+
+		// Killing the Docker CLI doesn't stop the command in the container.
+		_ = exec.Command(d.Binary, "kill", container).Run()
+	case stageCtx.Err() == context.DeadlineExceeded:
+		res.Status = "TO"
+		res.Signal = "SIGKILL"
+
+		// Killing the Docker CLI doesn't stop the command in the container.
+		_ = exec.Command(d.Binary, "kill", container).Run()
+	case errors.As(err, &exitErr):
+		res.Code = exitErr.ExitCode()
+
+		// The shell reports processes killed by a signal, e.g. by the
+		// kernel when out of memory, as 128 + the signal number.
+		if res.Code == 137 {
+			res.Signal = "SIGKILL"
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// usage returns the CPU time used by a container, and its peak memory in
+// bytes, from its cgroup. Both are 0 if cgroup v2 isn't available. The peak
+// memory includes compiling the code.
+func (d *DockerExecutor) usage(ctx context.Context, container string) (cpu time.Duration, memory int) {
+	out, err := exec.CommandContext(ctx, d.Binary, "exec", container,
+		"cat", "/sys/fs/cgroup/cpu.stat", "/sys/fs/cgroup/memory.peak",
+	).Output()
+	if err != nil {
+		return 0, 0
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "usage_usec":
+			usec, _ := strconv.Atoi(fields[1])
+			cpu = time.Duration(usec) * time.Microsecond
+		case len(fields) == 1:
+			memory, _ = strconv.Atoi(fields[0])
+		}
+	}
+
+	return cpu, memory
+}
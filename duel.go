@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// How long a duel stays open for submissions.
+const duelTTL = time.Hour
+
+// Duel is a head-to-head competition between two users.
+type Duel struct {
+	ChallengerID string
+	OpponentID   string
+	Language     string
+	Stdin        string
+	Expected     string // expected output; empty if any successful run is correct
+	RankBy       string // DuelRankTime or DuelRankMemory
+	Limits       Limits
+	Submissions  map[string]string // user ID -> code
+	Created      time.Time
+}
+
+// duelEntry is the result of one side of a duel.
+type duelEntry struct {
+	UserID  string
+	Result  *piston.ExecuteResponse
+	Err     error
+	Correct bool
+}
+
+var (
+	duels   = make(map[string]*Duel)
+	duelsMu sync.Mutex
+)
+
+// Duel command definition.
+var duelCommand = &discordgo.ApplicationCommand{
+	Name:        "duel",
+	Description: "Challenges another user to solve a problem faster than you.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "opponent",
+			Description: "The user to challenge.",
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Required:    true,
+		},
+		{
+			Name:        "language",
+			Description: "The language both solutions are written in.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+		},
+		{
+			Name:        "stdin",
+			Description: "The input given to both solutions.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:        "expected",
+			Description: "The expected output of a correct solution.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:        "rank",
+			Description: "Whether the fastest correct solution wins, or the one using the least memory.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "time", Value: DuelRankTime},
+				{Name: "memory", Value: DuelRankMemory},
+			},
+		},
+	},
+}
+
+// How the correct solutions of a duel are ranked.
+const (
+	DuelRankTime   = "time"
+	DuelRankMemory = "memory"
+)
+
+// duelComponents returns the components for submitting a solution to a duel.
+func duelComponents(id string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Submit Solution",
+					Style:    discordgo.PrimaryButton,
+					CustomID: "duel_submit:" + id,
+				},
+			},
+		},
+	}
+}
+
+// getDuel returns an open duel, removing expired duels.
+func getDuel(id string) (*Duel, bool) {
+	duelsMu.Lock()
+	defer duelsMu.Unlock()
+
+	for k, d := range duels {
+		if time.Since(d.Created) > duelTTL {
+			delete(duels, k)
+		}
+	}
+
+	d, ok := duels[id]
+	return d, ok
+}
+
+func duelHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	options := optionMap(i.ApplicationCommandData().Options)
+
+	opponent := options["opponent"].UserValue(nil)
+	if opponent.ID == interactionUser(i).ID || opponent.Bot {
+		respondEphemeral(s, i, "You can't duel yourself or a bot.")
+		return
+	}
+
+	lang := resolveGuildLanguage(i.GuildID, options["language"].StringValue())
+	if lang == "" {
+		respondEphemeral(s, i, fmt.Sprintf("Language %v is not supported. Supported languages are: %v", options["language"].StringValue(), getLanguages()))
+		return
+	}
+
+	d := &Duel{
+		ChallengerID: interactionUser(i).ID,
+		OpponentID:   opponent.ID,
+		Language:     lang,
+		Limits:       guildLimits(i.GuildID),
+		Submissions:  make(map[string]string, 2),
+		Created:      time.Now(),
+	}
+	if option, ok := options["stdin"]; ok {
+		d.Stdin = option.StringValue()
+	}
+	if option, ok := options["expected"]; ok {
+		d.Expected = option.StringValue()
+	}
+	d.RankBy = DuelRankTime
+	if option, ok := options["rank"]; ok {
+		d.RankBy = option.StringValue()
+	}
+
+	duelsMu.Lock()
+	duels[i.ID] = d
+	duelsMu.Unlock()
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf(
+					"<@%v> has challenged <@%v> to a duel in %v! Both of you, submit your solution with the button below.",
+					d.ChallengerID, d.OpponentID, d.Language,
+				),
+				Components: duelComponents(i.ID),
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// duelSubmitHandler opens the modal for submitting a solution to a duel.
+func duelSubmitHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	id := strings.TrimPrefix(i.MessageComponentData().CustomID, "duel_submit:")
+
+	d, ok := getDuel(id)
+	if !ok {
+		respondEphemeral(s, i, "This duel has expired.")
+		return
+	}
+
+	userID := interactionUser(i).ID
+	if userID != d.ChallengerID && userID != d.OpponentID {
+		respondEphemeral(s, i, "You are not part of this duel.")
+		return
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: "duel_solution:" + id,
+				Title:    "Submit Solution (" + d.Language + ")",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:  "code",
+								Label:     "Code",
+								Style:     discordgo.TextInputParagraph,
+								Required:  true,
+								MaxLength: 4000,
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// duelSolutionHandler records a solution to a duel, and runs the duel once
+// both solutions are in.
+func duelSolutionHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	id := strings.TrimPrefix(i.ModalSubmitData().CustomID, "duel_solution:")
+
+	d, ok := getDuel(id)
+	if !ok {
+		respondEphemeral(s, i, "This duel has expired.")
+		return
+	}
+
+	code := modalValues(i.ModalSubmitData())["code"]
+	if checkBlocked(s, i.GuildID, i.ChannelID, interactionUser(i).ID, []piston.File{{Content: code}}) {
+		respondEphemeral(s, i, tr(i.Locale, "error.blocked"))
+		return
+	}
+
+	duelsMu.Lock()
+	d.Submissions[interactionUser(i).ID] = code
+	done := len(d.Submissions) == 2
+	if done {
+		delete(duels, id)
+	}
+	duelsMu.Unlock()
+
+	if !done {
+		respondEphemeral(s, i, "Your solution has been submitted. Waiting for your opponent...")
+		return
+	}
+
+	// Send deferred message, telling the users that a response is coming shortly.
+	w := NewResponseWriter(ctx, s, i)
+	if !w.Defer() {
+		return
+	}
+
+	entries := []*duelEntry{
+		runDuelEntry(w.Context(), d, d.ChallengerID),
+		runDuelEntry(w.Context(), d, d.OpponentID),
+	}
+	for _, e := range entries {
+		auditExecution(s, i.ChannelID, e.UserID, i.GuildID, executionID(e.Result, e.Err), d.Language, []piston.File{{Content: d.Submissions[e.UserID]}}, executionStatus(e.Result, e.Err))
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{duelEmbed(d, entries)},
+	})
+}
+
+// runDuelEntry runs the solution of a user in a duel.
+func runDuelEntry(ctx context.Context, d *Duel, userID string) *duelEntry {
+	entry := &duelEntry{
+		UserID: userID,
+	}
+
+	files := applyTemplate(d.Language, []piston.File{{Content: d.Submissions[userID]}})
+
+	release, err := execQueue.Acquire(ctx, nil)
+	if err != nil {
+		entry.Err = err
+	} else {
+		entry.Result, entry.Err = Execute(ctx, ExecRequest{
+			Language: d.Language,
+			Files:    files,
+			Stdin:    d.Stdin,
+			Limits:   d.Limits,
+		})
+		release()
+	}
+
+	if entry.Err != nil {
+		log.Error().
+			Err(entry.Err).
+			Str("execution_id", executionID(nil, entry.Err)).
+			Msg("Error executing code.")
+		return entry
+	}
+
+	compiled := entry.Result.Compile == nil || entry.Result.Compile.Code == 0
+	succeeded := compiled && entry.Result.Run.Code == 0 && entry.Result.Run.Signal == ""
+	if d.Expected != "" {
+		entry.Correct = succeeded && strings.TrimSpace(entry.Result.Run.Stdout) == strings.TrimSpace(d.Expected)
+	} else {
+		entry.Correct = succeeded
+	}
+
+	return entry
+}
+
+// duelEmbed renders the results of a duel, with the fastest correct solution winning.
+func duelEmbed(d *Duel, entries []*duelEntry) *discordgo.MessageEmbed {
+	var winner *duelEntry
+	fields := make([]*discordgo.MessageEmbedField, 0, len(entries)+1)
+
+	for _, e := range entries {
+		var value string
+		switch {
+		case e.Err != nil:
+			value = "❌ " + execErrorMessage("code", e.Err)
+		case e.Correct:
+			value = "✅ Correct in " + resultStats(e.Result)
+		default:
+			value = fmt.Sprintf("❌ Incorrect (%v)", resultFooter(e.Result))
+		}
+
+		if e.Err == nil {
+			value += "\n" + splitOutput(e.Result.Run.Output, 300)[0]
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Solution",
+			Value:  fmt.Sprintf("<@%v>\n%v", e.UserID, value),
+			Inline: true,
+		})
+
+		if e.Correct && (winner == nil || d.better(e.Result, winner.Result)) {
+			winner = e
+		}
+	}
+
+	result := "Nobody solved it. It's a draw!"
+	if winner != nil {
+		result = fmt.Sprintf("🏆 <@%v> wins!", winner.UserID)
+	}
+
+	fields = append(fields, &discordgo.MessageEmbedField{
+		Name:  "Result",
+		Value: result,
+	})
+
+	return &discordgo.MessageEmbed{
+		Title:  fmt.Sprintf("Duel (%v, ranked by %v)", d.Language, d.RankBy),
+		Fields: fields,
+	}
+}
+
+// better checks if a result beats another in the ranking of the duel. Ties
+// in memory are broken by time.
+func (d *Duel) better(a *piston.ExecuteResponse, b *piston.ExecuteResponse) bool {
+	if d.RankBy == DuelRankMemory && a.Run.Memory != b.Run.Memory {
+		return a.Run.Memory > 0 && (b.Run.Memory == 0 || a.Run.Memory < b.Run.Memory)
+	}
+	return a.RunTime() < b.RunTime()
+}
+
+// modalValues maps the text inputs of a modal submission by their custom ID.
+func modalValues(data discordgo.ModalSubmitInteractionData) map[string]string {
+	values := make(map[string]string)
+	for _, row := range data.Components {
+		row, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, c := range row.Components {
+			if input, ok := c.(*discordgo.TextInput); ok {
+				values[input.CustomID] = input.Value
+			}
+		}
+	}
+	return values
+}
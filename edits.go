@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// How long edits to a code message run it again. The output is updated with
+// the token of the interaction that ran it, which expires after 15 minutes.
+const watchedMessageTTL = 15 * time.Minute
+
+// watchedMessage is a code message that was run, with the output messages to
+// update when it is edited.
+type watchedMessage struct {
+	Interaction *discordgo.Interaction
+	AuthorID    string
+	Language    string
+	Version     string
+	Limits      Limits
+	Spoiler     bool // output is hidden behind spoiler tags
+	OutputIDs   []string
+	Created     time.Time
+}
+
+var (
+	watchedMessages   = make(map[string]*watchedMessage)
+	watchedMessagesMu sync.Mutex
+)
+
+// watchEdits remembers that a code message was run by an interaction, so that
+// editing it runs the code again and updates the output.
+func watchEdits(source *discordgo.Message, interaction *discordgo.Interaction, outputIDs []string, lang string, version string, limits Limits, spoiler bool) {
+	if len(outputIDs) == 0 {
+		return
+	}
+
+	watchedMessagesMu.Lock()
+	defer watchedMessagesMu.Unlock()
+
+	for k, m := range watchedMessages {
+		if time.Since(m.Created) > watchedMessageTTL {
+			delete(watchedMessages, k)
+		}
+	}
+
+	watchedMessages[source.ID] = &watchedMessage{
+		Interaction: interaction,
+		AuthorID:    source.Author.ID,
+		Language:    lang,
+		Version:     version,
+		Limits:      limits,
+		Spoiler:     spoiler,
+		OutputIDs:   outputIDs,
+		Created:     time.Now(),
+	}
+}
+
+// messageUpdateHandler runs an edited code message again and updates its output.
+func messageUpdateHandler(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	defer recoverEvent("message update")
+
+	watchedMessagesMu.Lock()
+	watched, ok := watchedMessages[m.ID]
+	watchedMessagesMu.Unlock()
+
+	// Edits without content, e.g. embeds being added, don't change the code.
+	if !ok || time.Since(watched.Created) > watchedMessageTTL || m.Content == "" || !isCodeMessage(m.Message) {
+		return
+	}
+
+	if !shutdown.Begin() {
+		return
+	}
+	defer shutdown.Done()
+
+	// The language in the message is used if it was changed.
+	lang, files := getLanguageAndFilesFromMessage(m.Message, m.GuildID)
+	version := watched.Version
+	if lang == "" {
+		lang = watched.Language
+	} else if lang != watched.Language {
+		version = ""
+	}
+
+	files = applyTemplate(lang, files)
+
+	if !guildConfigs.Get(m.GuildID).ChannelAllowed(m.ChannelID, threadParent(s, m.ChannelID)) {
+		return
+	}
+
+	// The output isn't updated, so the last run of the code stays.
+	if checkBlocked(s, m.GuildID, m.ChannelID, watched.AuthorID, files) {
+		return
+	}
+
+	release, _, ok := rateLimiter.Acquire(watched.AuthorID, m.GuildID)
+	if !ok {
+		log.Debug().
+			Str("message_id", m.ID).
+			Msg("Edit not run, user throttled.")
+		return
+	}
+	defer release()
+
+	log.Debug().
+		Str("message_id", m.ID).
+		Str("language", lang).
+		Msg("Running edited code message.")
+
+	var result *piston.ExecuteResponse
+	releaseSlot, err := execQueue.Acquire(context.Background(), nil)
+	if err == nil {
+		result, err = Execute(context.Background(), ExecRequest{
+			Language: lang,
+			Version:  version,
+			Files:    files,
+			Limits:   watched.Limits,
+		})
+		releaseSlot()
+	}
+	recordExecution(watched.Interaction.ID, watched.AuthorID, m.GuildID, lang, version, files, result, err)
+	auditExecution(s, m.ChannelID, watched.AuthorID, m.GuildID, executionID(result, err), lang, files, executionStatus(result, err))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+		return
+	}
+
+	storeRun(watched.Interaction.ID, storedRun{
+		Language: lang,
+		Version:  version,
+		Files:    files,
+		Limits:   watched.Limits,
+	})
+	updateOutput(s, watched, renderOutput(result, watched.Interaction.ID, watched.AuthorID, m.GuildID, watched.Limits, watched.Spoiler))
+}
+
+// updateOutput replaces the output messages of a watched message, deleting
+// messages that are no longer needed and sending more if the output grew.
+func updateOutput(s *discordgo.Session, watched *watchedMessage, messages []*discordgo.WebhookParams) {
+	var outputIDs []string
+
+	for n, params := range messages {
+		if n >= len(watched.OutputIDs) {
+			m, err := s.FollowupMessageCreate(watched.Interaction, true, params)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("Error sending followup message.")
+				continue
+			}
+			outputIDs = append(outputIDs, m.ID)
+			continue
+		}
+
+		// Components and embeds are replaced too, so the button is removed from
+		// a message that is no longer the last one.
+		components := params.Components
+		if components == nil {
+			components = []discordgo.MessageComponent{}
+		}
+		embeds := params.Embeds
+		if embeds == nil {
+			embeds = []*discordgo.MessageEmbed{}
+		}
+		_, err := s.FollowupMessageEdit(watched.Interaction, watched.OutputIDs[n], &discordgo.WebhookEdit{
+			Content:    &params.Content,
+			Components: &components,
+			Embeds:     &embeds,
+			Files:      params.Files,
+		})
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error editing followup message.")
+		}
+		outputIDs = append(outputIDs, watched.OutputIDs[n])
+	}
+
+	for n := len(messages); n < len(watched.OutputIDs); n++ {
+		err := s.FollowupMessageDelete(watched.Interaction, watched.OutputIDs[n])
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error deleting followup message.")
+		}
+	}
+
+	watchedMessagesMu.Lock()
+	watched.OutputIDs = outputIDs
+	watchedMessagesMu.Unlock()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Maximum number of environment variables code can be run with.
+const maxEnvVars = 16
+
+// Maximum length of the value of an environment variable.
+const maxEnvValueLength = 256
+
+// Matches the name of an environment variable.
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Option for running code with environment variables.
+var envOption = &discordgo.ApplicationCommandOption{
+	Name:        "env",
+	Description: "Environment variables to run the code with, as KEY=value pairs separated by spaces.",
+	Type:        discordgo.ApplicationCommandOptionString,
+	Required:    false,
+}
+
+// reservedEnv checks if an environment variable can't be set, since the
+// compiler and the program rely on it.
+func reservedEnv(name string) bool {
+	name = strings.ToUpper(name)
+	return name == "PATH" || name == "HOME" || strings.HasPrefix(name, "LD_")
+}
+
+// checkEnv checks that environment variables can be set, and that there
+// aren't too many of them.
+func checkEnv(env map[string]string) error {
+	if len(env) > maxEnvVars {
+		return fmt.Errorf("at most %v environment variables can be set", maxEnvVars)
+	}
+
+	for name, value := range env {
+		if !envNameRegex.MatchString(name) {
+			return fmt.Errorf("%q is not a valid name", name)
+		}
+		if reservedEnv(name) {
+			return fmt.Errorf("%v can't be set", name)
+		}
+		if len(value) > maxEnvValueLength {
+			return fmt.Errorf("the value of %v is longer than %v characters", name, maxEnvValueLength)
+		}
+	}
+
+	return nil
+}
+
+// parseEnv parses environment variables given as KEY=value pairs separated
+// by spaces, e.g. "LANG=fr_FR.UTF-8 DEBUG=1".
+func parseEnv(v string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, pair := range strings.Fields(v) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not a KEY=value pair", pair)
+		}
+		env[parts[0]] = parts[1]
+	}
+
+	return env, checkEnv(env)
+}
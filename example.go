@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed examples/*.txt
+var exampleFiles embed.FS // named by their language, e.g. python.txt or c++.txt
+
+// exampleLanguages returns the languages with an example, sorted by name.
+func exampleLanguages() []string {
+	entries, err := exampleFiles.ReadDir("examples")
+	if err != nil {
+		return nil
+	}
+
+	langs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		langs = append(langs, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// exampleChoices returns a choice for every language with an example.
+func exampleChoices() []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, lang := range exampleLanguages() {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  lang,
+			Value: lang,
+		})
+	}
+	return choices
+}
+
+// Example command definition.
+var exampleCommand = &discordgo.ApplicationCommand{
+	Name:        "example",
+	Description: "Shows an example program in a language, in a code block that can be run.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "language",
+			Description: "The language of the example.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+			Choices:     exampleChoices(),
+		},
+	},
+}
+
+// exampleHandler posts the example of a language in a code block, with a
+// button to run it.
+func exampleHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	lang := commandOptions(i)["language"].StringValue()
+
+	code, err := exampleFiles.ReadFile(path.Join("examples", lang+".txt"))
+	if err != nil {
+		respondEphemeral(s, i, "There is no example for "+lang+". Use `/languages` to see the supported languages.")
+		return
+	}
+
+	err = s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: tr(i.Locale, "example.intro", lang) + "\n```" + lang + "\n" + string(code) + "```",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.Button{
+								Label:    "Run it",
+								Style:    discordgo.PrimaryButton,
+								CustomID: "example_run",
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// exampleRunHandler runs the example posted by exampleHandler.
+func exampleRunHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	lang, version, files, ok := getCodeFromMessage(w, i.Message, "", "", guildLimits(i.GuildID))
+	if !ok {
+		return
+	}
+
+	// Execute the code and send the output.
+	runCode(w, lang, version, files, guildLimits(i.GuildID))
+}
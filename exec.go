@@ -1,102 +1,204 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"io"
-	"net/http"
+	"fmt"
 
-	piston "github.com/milindmadhukar/go-piston"
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/rs/zerolog/log"
 )
 
 // TODO: make this configurable
 const USERAGENT = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/95.0.4638.54 Safari/537.36"
 
-// TODO: if this is well written, this should be ported to its own package/wrapper
-// POST /api/v2/execute
-type ExecuteRequest struct {
-	Language           string   `json:"language"`             // required, language of code
-	Version            string   `json:"version"`              // required, language of version
-	Files              []File   `json:"files"`                // required, files of code
-	Stdin              string   `json:"stdin"`                // input to code
-	Args               []string `json:"args"`                 // program arguments
-	CompileTimeout     int      `json:"compile_timeout"`      // max time for compiling; default: 10000 MS
-	RunTimeout         int      `json:"run_timeout"`          // max run time; default: 3000 MS
-	CompileMemoryLimit int      `json:"compile_memory_limit"` // max memory for compile: -1
-	RunMemoryLimit     int      `json:"run_memory_limit"`     // max memory for run; default: -1
-}
-
-type ExecuteResponse struct {
-	Language string         `json:"language"`
-	Version  string         `json:"version"`
-	Run      ExecuteResults `json:"run"`
-	Message  string         `json:"message"` // means something bad happened...
-}
-
-type ExecuteResults struct {
-	Stdout string `json:"stdout"`
-	Stderr string `json:"stderr"`
-	Output string `json:"output"`
-	Code   int    `json:"code"`
-	Signal int    `json:"signal"` // what is this??
-}
-
-type File struct {
-	Name     string `json:"name"`     // name of upload
-	Content  string `json:"content"`  // required, content of file
-	Encoding string `json:"encoding"` // encoding used; default: utf8; options base64, hex
-}
-
-// TODO: runtime endpoints
-func Exec(lang string, version string, code string) (string, error) {
-	execRequest := ExecuteRequest{
-		Language: lang,
-		Version:  version,
-		Files: []File{
-			{
-				Content: code,
-			},
-		},
+// Client of the Piston instance code is run on.
+var pistonClient *piston.Client
+
+// newPistonClient creates the client for the configured Piston instance.
+func newPistonClient() *piston.Client {
+	client := piston.New(PISTON_URL)
+	client.APIKey = PISTON_API_KEY
+	client.UserAgent = USERAGENT
+	client.HTTPClient.Timeout = PISTON_TIMEOUT
+	client.MaxRetries = PISTON_MAX_RETRIES
+
+	return client
+}
+
+// ExecRequest is code to run, with its input and the limits it is run with.
+type ExecRequest struct {
+	ID       string // identifies the run, generated if empty
+	Language string
+	Version  string        // defaults to the latest version
+	Files    []piston.File // the first file is run
+	Stdin    string
+	Args     []string          // command line arguments of the program
+	Env      map[string]string // environment variables, if the executor can set them
+	Limits   Limits
+
+	// Packages to install before running, if the executor can install them,
+	// and the maximum time for installing them, in milliseconds. Packages
+	// listed in dependency files like go.mod are only installed if Install
+	// is true.
+	Dependencies   []string
+	Install        bool
+	InstallTimeout int
+}
+
+// codeSize returns the size of the code in files, in bytes.
+func codeSize(files []piston.File) int {
+	size := 0
+	for _, f := range files {
+		size += len(f.Content)
+	}
+	return size
+}
+
+// CodeSizeError is returned for code larger than MAX_CODE_SIZE, which isn't
+// sent to the executor.
+type CodeSizeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *CodeSizeError) Error() string {
+	return fmt.Sprintf("the code is %.1f KB, over the limit of %.1f KB", float64(e.Size)/1024, float64(e.Limit)/1024)
+}
+
+// Is reports that the code is too large.
+func (e *CodeSizeError) Is(target error) bool {
+	return target == piston.ErrTooLarge
+}
+
+// newExecutionID generates a short ID for a run, which users can quote so
+// that it can be found in the logs.
+func newExecutionID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// ExecutionError is an error running code, with the ID of the run.
+type ExecutionError struct {
+	ID  string
+	Err error
+}
+
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("run %v: %v", e.ID, e.Err)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// executionID returns the ID of a run from its result, or its error if it
+// failed.
+func executionID(result *piston.ExecuteResponse, err error) string {
+	var execErr *ExecutionError
+	if errors.As(err, &execErr) {
+		return execErr.ID
+	}
+	if result != nil {
+		return result.ExecutionID
+	}
+	return ""
+}
+
+// Execute runs code on the executor, returning the output, exit code, and
+// timing of the compile and run stages. The retry function of the context
+// is called if the request to the executor is retried. Results are cached
+// for RESULT_CACHE_TTL unless the context is withoutCache. Code larger than
+// MAX_CODE_SIZE isn't run, since executors reject it without saying why.
+// The result and any error carry the ID of the run.
+func Execute(ctx context.Context, req ExecRequest) (*piston.ExecuteResponse, error) {
+	id := req.ID
+	if id == "" {
+		id = newExecutionID()
+	}
+
+	log.Debug().
+		Str("execution_id", id).
+		Str("language", req.Language).
+		Str("version", req.Version).
+		Int("size", codeSize(req.Files)).
+		Msg("Executing code.")
+
+	result, err := execute(ctx, req)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("execution_id", id).
+			Msg("Execution failed.")
+
+		return nil, &ExecutionError{ID: id, Err: err}
+	}
+
+	result.ExecutionID = id
+	return result, nil
+}
+
+// execute runs code for Execute.
+func execute(ctx context.Context, req ExecRequest) (*piston.ExecuteResponse, error) {
+	lang, version, limits := req.Language, req.Version, req.Limits
+
+	if size := codeSize(req.Files); MAX_CODE_SIZE > 0 && size > MAX_CODE_SIZE {
+		return nil, &CodeSizeError{Size: size, Limit: MAX_CODE_SIZE}
+	}
+
+	execRequest := piston.ExecuteRequest{
+		Language:           lang,
+		Version:            version,
+		Files:              req.Files,
+		Stdin:              req.Stdin,
+		Args:               req.Args,
+		Env:                req.Env,
+		Dependencies:       req.Dependencies,
+		Install:            req.Install,
+		InstallTimeout:     req.InstallTimeout,
+		CompileTimeout:     limits.CompileTimeout,
+		RunTimeout:         limits.RunTimeout,
+		CompileMemoryLimit: limits.CompileMemoryLimit,
+		RunMemoryLimit:     limits.RunMemoryLimit,
 	}
 	if version == "" {
 		latest, err := GetLatestVersion(lang)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		execRequest.Version = latest
 	}
 
-	body, err := json.Marshal(execRequest)
-	if err != nil {
-		return "", err
+	if !cacheDisabled(ctx) {
+		if cached, ok := resultCache.Get(execRequest); ok {
+			cachedResults.Inc()
+			return cached, nil
+		}
 	}
 
-	res, err := Request("POST", PISTON_URL+"execute", bytes.NewBuffer(body))
+	results, err := executor.Execute(ctx, execRequest)
 	if err != nil {
-		return "", err
+		pistonErrors.Inc()
+		return nil, err
 	}
 
-	defer res.Body.Close()
+	executions.WithLabelValues(lang).Inc()
+	executionDuration.WithLabelValues(lang).Observe(results.Duration.Seconds())
 
-	var results ExecuteResponse
-	decoder := json.NewDecoder(res.Body)
-	decoder.DisallowUnknownFields()
-	err = decoder.Decode(&results)
+	resultCache.Add(execRequest, results)
 
-	return results.Run.Output, err
+	// The cached result is shared, so the caller gets a copy to set its ID on.
+	result := *results
+	return &result, nil
 }
 
-func GetRuntimes() (*piston.Runtimes, error) {
-	httpClient := http.DefaultClient
-	client := piston.New("", httpClient, PISTON_URL)
-
-	runtimes, err := client.GetRuntimes()
-	if err != nil {
-		return nil, err
-	}
-
-	return runtimes, nil
+func GetRuntimes() ([]piston.Runtime, error) {
+	return executor.Runtimes(context.Background())
 }
 
 // TODO: there should be a static list of runtimes which the bot refers to; any issues if the runtimes change??
@@ -106,41 +208,63 @@ func GetLatestVersion(language string) (string, error) {
 		return "", err
 	}
 
-	if runtimes == nil {
+	if len(runtimes) == 0 {
 		return "", errors.New("no runtimes found")
 	}
 
-	for _, runtime := range *runtimes {
-		if language == runtime.Language || isPresent(runtime.Aliases, language) {
+	for _, runtime := range runtimes {
+		if language == runtime.Language || stringInSlice(language, runtime.Aliases) {
 			return runtime.Version, nil
 		}
 	}
 
-	return "", errors.New("Could not find a version for the language " + language)
+	return "", fmt.Errorf("no version of %v is installed: %w", language, piston.ErrUnsupportedLanguage)
 }
 
-// "Borrowed" from that piston wrapper library
-// Returns a boolean value checking if a string is found in the slice or not.
-func isPresent(slice []string, val string) bool {
-	for _, item := range slice {
-		if item == val {
-			return true
-		}
-	}
-	return false
+// GetPackages returns all packages available to a self-hosted Piston instance.
+func GetPackages() ([]piston.Package, error) {
+	return pistonClient.Packages(context.Background())
 }
 
-func Request(method string, path string, body io.Reader) (*http.Response, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest(method, path, body)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("User-Agent", USERAGENT)
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Content-Type", "application/json")
+// InstallPackage installs a package on a self-hosted Piston instance.
+func InstallPackage(lang string, version string) error {
+	return pistonClient.InstallPackage(context.Background(), lang, version)
+}
 
-	res, err := client.Do(req)
+// UninstallPackage removes a package from a self-hosted Piston instance.
+func UninstallPackage(lang string, version string) error {
+	return pistonClient.UninstallPackage(context.Background(), lang, version)
+}
 
-	return res, err
+// execErrorMessage describes an error executing something for users, by its
+// kind, with a hint at what they can do about it.
+func execErrorMessage(what string, err error) string {
+	var execErr *ExecutionError
+	if errors.As(err, &execErr) {
+		return execErrorDescription(what, execErr.Err) + fmt.Sprintf(" (run `%v`)", execErr.ID)
+	}
+	return execErrorDescription(what, err)
+}
+
+// execErrorDescription describes an error executing something for
+// execErrorMessage.
+func execErrorDescription(what string, err error) string {
+	var sizeErr *CodeSizeError
+	switch {
+	case errors.Is(err, piston.ErrRateLimited):
+		return "The execution service is busy right now. Please try again in a minute."
+	case errors.Is(err, piston.ErrUnreachable):
+		return "The execution service can't be reached right now. It may be restarting, so please try again in a few minutes. If it keeps happening, let the bot's admins know."
+	case errors.Is(err, piston.ErrTimeout):
+		return fmt.Sprintf("The execution service took too long to respond while running the %v. Try again, or make the code finish faster.", what)
+	case errors.Is(err, piston.ErrUnsupportedLanguage):
+		return fmt.Sprintf("The %v couldn't be run, since its language or version isn't installed: %v. Use `/languages` to see what can be run.", what, err)
+	case errors.Is(err, piston.ErrUnsupportedFeature):
+		return fmt.Sprintf("The %v couldn't be run, since the execution service doesn't support it: %v.", what, err)
+	case errors.As(err, &sizeErr):
+		return fmt.Sprintf("The %v is %.1f KB, over the limit of %.1f KB. Try running a smaller part of it, or put it in a gist and run it with the url option of `/run`.", what, float64(sizeErr.Size)/1024, float64(sizeErr.Limit)/1024)
+	case errors.Is(err, piston.ErrTooLarge):
+		return fmt.Sprintf("The %v or its input is too large for the execution service. Try running less code, or giving it less input.", what)
+	}
+	return fmt.Sprintf("Error executing %v.```\n%v\n```", what, err)
 }
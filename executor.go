@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// Executor is a backend that runs code. Piston's request and response types
+// are used by every backend, with results the backend can't report left empty.
+type Executor interface {
+	// Runtimes returns the languages and versions the backend can run.
+	Runtimes(ctx context.Context) ([]piston.Runtime, error)
+
+	// Execute runs code.
+	Execute(ctx context.Context, req piston.ExecuteRequest) (*piston.ExecuteResponse, error)
+}
+
+// The backend code is run on.
+var executor Executor
+
+// newExecutor creates the configured execution backend.
+func newExecutor(name string) (Executor, error) {
+	switch name {
+	case "", "piston":
+		return pistonClient, nil
+	case "judge0":
+		if JUDGE0_URL == "" {
+			return nil, errors.New("JUDGE0_URL is required for the judge0 executor")
+		}
+		return NewJudge0Executor(JUDGE0_URL, JUDGE0_API_KEY), nil
+	case "wasi":
+		return NewWASIExecutor(WASI_RUNTIME, WASI_MODULES_DIR), nil
+	case "docker":
+		images, err := loadDockerImages(DOCKER_IMAGES_FILE)
+		if err != nil {
+			return nil, err
+		}
+		return NewDockerExecutor(DOCKER_BINARY, images, DOCKER_CPUS, DOCKER_MEMORY), nil
+	}
+
+	return nil, fmt.Errorf("unknown executor %q, expected piston, judge0, wasi, or docker", name)
+}
+
+// outputCapture captures the stdout and stderr of a program run by a local
+// executor, and both interleaved, which are written concurrently. At most
+// limit bytes of each are kept, so that a program printing endlessly can't
+// use up the bot's memory; exceeded is called once the limit is reached so
+// the program can be stopped.
+type outputCapture struct {
+	mu        sync.Mutex
+	limit     int // bytes; 0 keeps all output
+	exceeded  func()
+	truncated bool
+
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	output bytes.Buffer
+}
+
+func newOutputCapture(limit int, exceeded func()) *outputCapture {
+	return &outputCapture{
+		limit:    limit,
+		exceeded: exceeded,
+	}
+}
+
+// Stdout returns the writer of the standard output of the program.
+func (o *outputCapture) Stdout() io.Writer {
+	return captureWriter{o, &o.stdout}
+}
+
+// Stderr returns the writer of the standard error of the program.
+func (o *outputCapture) Stderr() io.Writer {
+	return captureWriter{o, &o.stderr}
+}
+
+// write adds output to a buffer, up to the limit.
+func (o *outputCapture) write(buf *bytes.Buffer, p []byte) {
+	if o.limit > 0 && buf.Len()+len(p) > o.limit {
+		p = p[:o.limit-buf.Len()]
+		for len(p) > 0 && !utf8.Valid(p) {
+			p = p[:len(p)-1]
+		}
+
+		if !o.truncated && o.exceeded != nil {
+			o.exceeded()
+		}
+		o.truncated = true
+	}
+	buf.Write(p)
+}
+
+// fill sets the output of a stage. Stages whose output was cut off are
+// marked like Piston marks them.
+func (o *outputCapture) fill(res *piston.ExecuteResults) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	res.Stdout = o.stdout.String()
+	res.Stderr = o.stderr.String()
+	res.Output = o.output.String()
+	if o.truncated {
+		res.Status = "OL"
+		res.Message = fmt.Sprintf("output exceeded %d bytes", o.limit)
+	}
+}
+
+// captureWriter writes one stream of a program to its outputCapture.
+type captureWriter struct {
+	o      *outputCapture
+	stream *bytes.Buffer
+}
+
+func (w captureWriter) Write(p []byte) (int, error) {
+	w.o.mu.Lock()
+	defer w.o.mu.Unlock()
+
+	w.o.write(w.stream, p)
+	w.o.write(&w.o.output, p)
+
+	// Output past the limit is discarded rather than failing the write, so
+	// the program is stopped by the executor instead of by a broken pipe.
+	return len(p), nil
+}
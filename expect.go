@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+)
+
+// How output is compared with the expected output of the expect option.
+const (
+	CompareExact  = "exact"  // the output must be the same
+	CompareTrim   = "trim"   // trailing whitespace and empty lines are ignored
+	CompareTokens = "tokens" // only the words matter, not the whitespace between them
+)
+
+// Options for checking the output of /run against an expected output.
+var expectOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "expect",
+		Description: "The output you expect. The output is checked against it.",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    false,
+	},
+	{
+		Name:        "compare",
+		Description: "How strictly the output is compared with the expected output. Defaults to trim.",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    false,
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "exact", Value: CompareExact},
+			{Name: "trim trailing whitespace", Value: CompareTrim},
+			{Name: "ignore whitespace", Value: CompareTokens},
+		},
+	},
+}
+
+// compareLines splits output into the lines that are compared, depending on
+// how it is compared. With CompareTokens, every word is a line.
+func compareLines(output string, mode string) []string {
+	switch mode {
+	case CompareExact:
+		return strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	case CompareTokens:
+		return strings.Fields(output)
+	}
+	return normalizeOutput(output)
+}
+
+// expectedOutputMessage checks the output of code against the expected
+// output, showing a diff if they differ.
+func expectedOutputMessage(result *piston.ExecuteResponse, expected string, mode string) *discordgo.WebhookParams {
+	if status := executionStatus(result, nil); status != "success" {
+		return &discordgo.WebhookParams{
+			Content: "❌ The code didn't run successfully, so its output wasn't checked.",
+		}
+	}
+
+	// Discord removes trailing newlines from options, so the expected output
+	// has none.
+	actual := result.Run.Stdout
+	if mode == CompareExact {
+		actual = strings.TrimSuffix(actual, "\n")
+	}
+
+	diff := unifiedDiff(compareLines(expected, mode), compareLines(actual, mode), "expected", "output")
+	if diff == "" {
+		return &discordgo.WebhookParams{
+			Content: "✅ The output matches the expected output.",
+		}
+	}
+
+	content := fmt.Sprintf("❌ The output doesn't match the expected output.```diff\n%v```", sanitizeOutput(diff))
+	if len(content) <= 2000 {
+		return &discordgo.WebhookParams{
+			Content: content,
+		}
+	}
+
+	// Long diffs are attached as a file.
+	link, files := attachLong("expected.diff", diff)
+	content = "❌ The output doesn't match the expected output. The diff is attached."
+	if link != "" {
+		content = "❌ The output doesn't match the expected output. The diff is at " + link
+	}
+	return &discordgo.WebhookParams{
+		Content: content,
+		Files:   files,
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Matches a comment naming a file, e.g. "# file: utils.py" or "// file: main.go".
+var fileCommentRegex = regexp.MustCompile(`^\s*(?:#|//|--|;|%)\s*file:\s*(\S+)\s*$`)
+
+// CodeBlock is a fenced code block in a message.
+type CodeBlock struct {
+	Language string // language after the opening fence
+	Name     string // file name from a file comment, if any
+	Code     string
+}
+
+// Matches the opening fence of a code block: three or more backticks or
+// tildes.
+var fenceRegex = regexp.MustCompile("`{3,}|~{3,}")
+
+// Matches inline code in single backticks.
+var inlineCodeRegex = regexp.MustCompile("(?:^|[^`])`([^`\n]+)`(?:[^`]|$)")
+
+// Matches a language after an opening fence.
+var fenceLanguageRegex = regexp.MustCompile(`^[\w#+.-]*$`)
+
+// Replaces the line endings of Windows and old Macs.
+var lineEndingReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// parseCodeBlocks returns all fenced code blocks in a message, opened and
+// closed by backticks or tildes, with text allowed around them. A block can
+// be named by a file comment on the line before it or on its first line.
+// Malformed fences are tolerated: a block on one line can start with its
+// language, and a last block that is never closed runs to the end of the
+// message.
+func parseCodeBlocks(content string) []CodeBlock {
+	content = lineEndingReplacer.Replace(content)
+
+	var blocks []CodeBlock
+	for {
+		loc := fenceRegex.FindStringIndex(content)
+		if loc == nil {
+			break
+		}
+		fence := content[loc[0]:loc[1]]
+		before, rest := content[:loc[0]], content[loc[1]:]
+
+		code, after, ok := closeFence(rest, fence)
+		if !ok {
+			// Only an opening fence starting a line, with code on the
+			// following lines, is taken as a block missing its closing fence.
+			startsLine := before == "" || strings.HasSuffix(before, "\n")
+			if !startsLine || !strings.Contains(rest, "\n") || strings.TrimSpace(rest) == "" {
+				break
+			}
+			code, after = strings.TrimRight(rest, " \t\n"), ""
+		}
+		content = after
+
+		block := CodeBlock{}
+
+		// The language is the rest of the opening line, if it is one word.
+		if nl := strings.Index(code, "\n"); nl >= 0 {
+			if lang := strings.TrimSpace(code[:nl]); fenceLanguageRegex.MatchString(lang) {
+				block.Language = lang
+				code = code[nl+1:]
+			}
+		} else if fields := strings.Fields(code); len(fields) > 1 && fenceLanguageRegex.MatchString(fields[0]) && resolveLanguage(fields[0]) != "" {
+			// A block on one line, e.g. ```py print(1)```, starts with its
+			// language if it is a known one.
+			block.Language = fields[0]
+			code = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(code), fields[0]))
+		}
+		code = strings.TrimSuffix(code, "\n")
+
+		// A comment on the line before the block names it.
+		if lines := strings.Split(strings.TrimRight(before, " \t"), "\n"); len(lines) > 1 && lines[len(lines)-1] == "" {
+			if match := fileCommentRegex.FindStringSubmatch(lines[len(lines)-2]); match != nil {
+				block.Name = match[1]
+			}
+		}
+
+		// A comment on the first line of the block also names it.
+		if block.Name == "" {
+			first, remaining := code, ""
+			if nl := strings.Index(code, "\n"); nl >= 0 {
+				first, remaining = code[:nl], code[nl+1:]
+			}
+			if match := fileCommentRegex.FindStringSubmatch(first); match != nil {
+				block.Name = match[1]
+				code = remaining
+			}
+		}
+
+		block.Code = code
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// closeFence finds the fence closing a code block in the text after its
+// opening fence, returning the code between them and the text after the
+// block. A fence on its own line is preferred, so that code can contain
+// fences in strings; otherwise the first fence closes the block, as in
+// one-line blocks. Closing fences can be longer than the opening fence.
+func closeFence(rest string, fence string) (code string, after string, ok bool) {
+	marker := fence[:1]
+
+	offset := 0
+	for _, line := range strings.SplitAfter(rest, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if offset > 0 && len(trimmed) >= len(fence) && strings.Trim(trimmed, marker) == "" {
+			return rest[:offset], rest[offset+len(line):], true
+		}
+		offset += len(line)
+	}
+
+	if n := strings.Index(rest, fence); n >= 0 {
+		end := n + len(fence)
+		for end < len(rest) && rest[end:end+1] == marker {
+			end++
+		}
+		return rest[:n], rest[end:], true
+	}
+
+	return "", "", false
+}
+
+// parseInlineCode returns the first inline code in single backticks in a
+// message, or an empty string if there is none. It can only be run when
+// the language is given, since inline code has none.
+func parseInlineCode(content string) string {
+	match := inlineCodeRegex.FindStringSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(match[1])
+}
+
+// getLanguageAndFilesFromMessage returns the language of the first code block
+// in a message, with the aliases of the guild, and every code block as a
+// file. The first file is the one that is run.
+func getLanguageAndFilesFromMessage(m *discordgo.Message, guildID string) (string, []piston.File) {
+	blocks := parseCodeBlocks(m.Content)
+
+	files := make([]piston.File, len(blocks))
+	for n, b := range blocks {
+		files[n] = piston.File{
+			Name:    b.Name,
+			Content: b.Code,
+		}
+	}
+
+	if len(blocks) == 0 {
+		return "", files
+	}
+
+	return resolveGuildLanguage(guildID, blocks[0].Language), files
+}
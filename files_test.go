@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []CodeBlock
+	}{
+		{
+			name:    "no code",
+			content: "hello",
+			want:    nil,
+		},
+		{
+			name:    "language tag",
+			content: "```py\nprint(1)\n```",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)"}},
+		},
+		{
+			name:    "no language tag",
+			content: "```\nprint(1)\n```",
+			want:    []CodeBlock{{Code: "print(1)"}},
+		},
+		{
+			name:    "language tag with symbols",
+			content: "```c++\nint main() {}\n```",
+			want:    []CodeBlock{{Language: "c++", Code: "int main() {}"}},
+		},
+		{
+			name:    "language tag with spaces around",
+			content: "``` python \nx = 1\n```",
+			want:    []CodeBlock{{Language: "python", Code: "x = 1"}},
+		},
+		{
+			name:    "opening line of several words",
+			content: "```python title\nx = 1\n```",
+			want:    []CodeBlock{{Code: "python title\nx = 1"}},
+		},
+		{
+			name:    "text around",
+			content: "Why doesn't this work?\n```python\nx = 1\n```\nThanks!",
+			want:    []CodeBlock{{Language: "python", Code: "x = 1"}},
+		},
+		{
+			name:    "tildes",
+			content: "~~~py\nprint(1)\n~~~",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)"}},
+		},
+		{
+			name:    "longer closing fence",
+			content: "```py\nprint(1)\n`````",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)"}},
+		},
+		{
+			name:    "fence in a string",
+			content: "```py\nprint(\"```\")\n```",
+			want:    []CodeBlock{{Language: "py", Code: "print(\"```\")"}},
+		},
+		{
+			name:    "one line",
+			content: "```print(1)```",
+			want:    []CodeBlock{{Code: "print(1)"}},
+		},
+		{
+			name:    "one line with language",
+			content: "```py print(1)```",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)"}},
+		},
+		{
+			name:    "one line with unknown first word",
+			content: "```echo hi```",
+			want:    []CodeBlock{{Code: "echo hi"}},
+		},
+		{
+			name:    "unclosed",
+			content: "```py\nprint(1)\n",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)"}},
+		},
+		{
+			name:    "unclosed after a closed block",
+			content: "```py\nprint(1)\n```\n```py\nprint(2)",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)"}, {Language: "py", Code: "print(2)"}},
+		},
+		{
+			name:    "unclosed without code",
+			content: "```py",
+			want:    nil,
+		},
+		{
+			name:    "unclosed inside a line",
+			content: "use ```py\nprint(1)",
+			want:    nil,
+		},
+		{
+			name:    "CRLF",
+			content: "```py\r\nprint(1)\r\nprint(2)\r\n```",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)\nprint(2)"}},
+		},
+		{
+			name:    "CR",
+			content: "```py\rprint(1)\r```",
+			want:    []CodeBlock{{Language: "py", Code: "print(1)"}},
+		},
+		{
+			name:    "file comments",
+			content: "# file: main.py\n```py\nimport utils\n```\n```py\n# file: utils.py\nx = 1\n```",
+			want: []CodeBlock{
+				{Language: "py", Name: "main.py", Code: "import utils"},
+				{Language: "py", Name: "utils.py", Code: "x = 1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCodeBlocks(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCodeBlocks(%q) = %+v, expected %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Tool is a program that is given code on stdin, such as a formatter or a
+// linter. Errors running the tool are printed on stderr.
+type Tool struct {
+	Name     string
+	Language string // language the tool is run in
+	Program  string
+}
+
+// runTool runs a tool on code, waiting in the queue like any execution.
+func runTool(ctx context.Context, t Tool, code string, limits Limits) (*piston.ExecuteResponse, error) {
+	release, err := execQueue.Acquire(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return Execute(ctx, ExecRequest{
+		Language: t.Language,
+		Files:    []piston.File{{Content: t.Program}},
+		Stdin:    code,
+		Limits:   limits,
+	})
+}
+
+// Formats Go code with the go/format package, which gofmt uses.
+const gofmtProgram = `package main
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+)
+
+func main() {
+	src, _ := io.ReadAll(os.Stdin)
+	out, err := format.Source(src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(out)
+}
+`
+
+const blackProgram = `import sys
+
+try:
+    import black
+except ImportError:
+    sys.exit("black is not installed on the execution backend.")
+
+try:
+    sys.stdout.write(black.format_str(sys.stdin.read(), mode=black.Mode()))
+except Exception as e:
+    sys.exit(str(e))
+`
+
+// Formats C and C++ code, with the file name telling clang-format the language.
+const clangFormatProgram = `command -v clang-format > /dev/null || { echo "clang-format is not installed on the execution backend." >&2; exit 1; }
+clang-format --assume-filename=%v
+`
+
+// Formats JavaScript and TypeScript code with the given prettier parser.
+const prettierProgram = `let prettier;
+try {
+  prettier = require("prettier");
+} catch {
+  console.error("prettier is not installed on the execution backend.");
+  process.exit(1);
+}
+
+const src = require("fs").readFileSync(0, "utf8");
+Promise.resolve(prettier.format(src, { parser: %q })).then(
+  (out) => process.stdout.write(out),
+  (err) => {
+    console.error(err.message);
+    process.exit(1);
+  },
+);
+`
+
+// Formatters of the languages that can be formatted.
+var formatters = map[string]Tool{
+	"go":         {"gofmt", "go", gofmtProgram},
+	"python":     {"black", "python", blackProgram},
+	"c":          {"clang-format", "bash", fmt.Sprintf(clangFormatProgram, "main.c")},
+	"c++":        {"clang-format", "bash", fmt.Sprintf(clangFormatProgram, "main.cpp")},
+	"javascript": {"prettier", "javascript", fmt.Sprintf(prettierProgram, "babel")},
+	"typescript": {"prettier", "javascript", fmt.Sprintf(prettierProgram, "typescript")},
+}
+
+// formatLanguages returns the languages that can be formatted.
+func formatLanguages() string {
+	langs := make([]string, 0, len(formatters))
+	for lang, f := range formatters {
+		langs = append(langs, fmt.Sprintf("%v (%v)", lang, f.Name))
+	}
+	sort.Strings(langs)
+	return strings.Join(langs, ", ")
+}
+
+// Format command definition.
+var formatCommand = &discordgo.ApplicationCommand{
+	Name:        "format",
+	Description: "Formats the latest code message. Run this command after a code message.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "language",
+			Description: "The language of the code.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:        "message",
+			Description: "A link to or the ID of the message to format. Defaults to the latest code message.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+	},
+}
+
+func formatHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	// The code is checked as it was posted.
+	w.Raw = true
+	lang, _, files, ok := getCodeFromChannel(w)
+	if !ok {
+		return
+	}
+
+	f, ok := formatters[lang]
+	if !ok {
+		w.Error(fmt.Sprintf("%v code can't be formatted. Languages that can be formatted are: %v", lang, formatLanguages()))
+		return
+	}
+
+	// The formatter is given the code that would be run.
+	code := files[0].Content
+
+	result, err := runTool(w.Context(), f, code, guildLimits(i.GuildID))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Str("formatter", f.Name).
+			Msg("Error executing formatter.")
+
+		w.Error(execErrorMessage(f.Name, err))
+		return
+	}
+
+	if executionStatus(result, nil) != "success" {
+		w.Error(labelOutput(f.Name+" failed", splitOutput(fullOutput(result), 1800))[0])
+		return
+	}
+
+	formatted := result.Run.Stdout
+	if strings.TrimSpace(formatted) == strings.TrimSpace(code) {
+		w.Send(&discordgo.WebhookParams{
+			Content: fmt.Sprintf("The code is already formatted with %v.", f.Name),
+		})
+		return
+	}
+
+	// Long code is sent as a file, since it can't be split without breaking it up.
+	content := fmt.Sprintf("Formatted with %v:\n```%v\n%v\n```", f.Name, lang, sanitizeOutput(strings.TrimRight(formatted, "\n")))
+	if len(content) > 2000 {
+		link, files := attachLong("formatted.txt", formatted)
+		w.Send(&discordgo.WebhookParams{
+			Content: strings.TrimSpace(fmt.Sprintf("Formatted with %v: %v", f.Name, link)),
+			Files:   files,
+		})
+		return
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Content: content,
+	})
+}
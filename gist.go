@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum size of a file fetched from GitHub, and of all files of a gist.
+const remoteFileLimit = 256 * 1024
+
+// Maximum number of files of a gist that is run.
+const maxGistFiles = 20
+
+// Matches a link to a gist, with the gist ID.
+var gistURLRegex = regexp.MustCompile(`^https://gist\.github\.com/(?:[\w-]+/)?([0-9a-f]+)/?(?:#.*)?$`)
+
+// Matches a link to a file on GitHub, with the owner, repository, and the ref
+// and path of the file.
+var githubBlobRegex = regexp.MustCompile(`^https://github\.com/([\w.-]+)/([\w.-]+)/blob/(.+)$`)
+
+// Matches a link to a raw file on GitHub or in a gist.
+var githubRawRegex = regexp.MustCompile(`^https://(?:raw|gist)\.githubusercontent\.com/.+$`)
+
+// Languages of file extensions that aren't aliases of a language.
+var extensionLanguages = map[string]string{
+	"cc":  "c++",
+	"cxx": "c++",
+	"hpp": "c++",
+	"h":   "c",
+	"cs":  "csharp",
+	"mjs": "javascript",
+	"cjs": "javascript",
+	"kt":  "kotlin",
+	"pyw": "python",
+	"sh":  "bash",
+}
+
+// Host of the GitHub API, the only one GITHUB_TOKEN is sent to.
+const githubAPIHost = "api.github.com"
+
+var githubClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// languageFromFileName returns the language of a file from its extension, or
+// an empty string if it isn't supported.
+func languageFromFileName(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if lang, ok := extensionLanguages[ext]; ok {
+		ext = lang
+	}
+	if ext == "" {
+		return ""
+	}
+	return resolveLanguage(ext)
+}
+
+// isCodeURL checks if a link is to a gist or a file on GitHub.
+func isCodeURL(url string) bool {
+	return gistURLRegex.MatchString(url) || githubBlobRegex.MatchString(url) || githubRawRegex.MatchString(url)
+}
+
+// fetchCode fetches the files of a gist or a file on GitHub, with the
+// language of the file that is run. The file that is run is named main.* or
+// is the first file of a supported language.
+func fetchCode(ctx context.Context, url string) (string, []piston.File, error) {
+	url = strings.TrimSpace(url)
+
+	if match := gistURLRegex.FindStringSubmatch(url); match != nil {
+		return fetchGist(ctx, match[1])
+	}
+
+	if match := githubBlobRegex.FindStringSubmatch(url); match != nil {
+		url = fmt.Sprintf("https://raw.githubusercontent.com/%v/%v/%v", match[1], match[2], match[3])
+	} else if !githubRawRegex.MatchString(url) {
+		return "", nil, errors.New("only links to gists and files on GitHub can be run")
+	}
+
+	content, err := githubGet(ctx, url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := path.Base(strings.SplitN(url, "?", 2)[0])
+	return languageFromFileName(name), []piston.File{{Name: name, Content: string(content)}}, nil
+}
+
+// fetchGist fetches the files of a gist.
+func fetchGist(ctx context.Context, id string) (string, []piston.File, error) {
+	data, err := githubGet(ctx, "https://"+githubAPIHost+"/gists/"+id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var gist struct {
+		Files map[string]struct {
+			Filename  string `json:"filename"`
+			Content   string `json:"content"`
+			Truncated bool   `json:"truncated"`
+			RawURL    string `json:"raw_url"`
+		} `json:"files"`
+	}
+	err = json.Unmarshal(data, &gist)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(gist.Files) == 0 {
+		return "", nil, errors.New("the gist has no files")
+	}
+	if len(gist.Files) > maxGistFiles {
+		return "", nil, fmt.Errorf("the gist has more than %d files", maxGistFiles)
+	}
+
+	names := make([]string, 0, len(gist.Files))
+	for name := range gist.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]piston.File, 0, len(names))
+	main := -1
+	lang := ""
+	size := 0
+	for _, name := range names {
+		f := gist.Files[name]
+
+		// Large files are only in the gist API response in part.
+		content := f.Content
+		if f.Truncated {
+			raw, err := githubGet(ctx, f.RawURL)
+			if err != nil {
+				return "", nil, err
+			}
+			content = string(raw)
+		}
+
+		size += len(content)
+		if size > remoteFileLimit {
+			return "", nil, fmt.Errorf("the files of the gist are larger than %d KB", remoteFileLimit/1024)
+		}
+
+		fileLang := languageFromFileName(name)
+		if fileLang != "" && (main == -1 || strings.HasPrefix(name, "main.")) {
+			main = len(files)
+			lang = fileLang
+		}
+
+		files = append(files, piston.File{Name: name, Content: content})
+	}
+
+	// The first file is the one that is run.
+	if main > 0 {
+		files[0], files[main] = files[main], files[0]
+	}
+
+	return lang, files, nil
+}
+
+// githubGet fetches a URL from GitHub. Requests to the API are authenticated
+// with GITHUB_TOKEN if it is set. Files are fetched without it, so a link
+// can't be used to read a private repository the token has access to.
+func githubGet(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if GITHUB_TOKEN != "" && req.URL.Scheme == "https" && req.URL.Host == githubAPIHost {
+		req.Header.Set("Authorization", "Bearer "+GITHUB_TOKEN)
+	}
+
+	res, err := githubClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, errors.New("the file or gist doesn't exist or isn't public")
+	case res.StatusCode != http.StatusOK:
+		log.Debug().
+			Str("url", url).
+			Int("status", res.StatusCode).
+			Msg("Error fetching from GitHub.")
+
+		return nil, fmt.Errorf("GitHub responded with %v", res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, remoteFileLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > remoteFileLimit {
+		return nil, fmt.Errorf("the file is larger than %d KB", remoteFileLimit/1024)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc answers requests without sending them.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGithubGetToken(t *testing.T) {
+	defer func(token string, transport http.RoundTripper) {
+		GITHUB_TOKEN = token
+		githubClient.Transport = transport
+	}(GITHUB_TOKEN, githubClient.Transport)
+
+	GITHUB_TOKEN = "secret"
+	var authorization string
+	githubClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		authorization = req.Header.Get("Authorization")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("{}")),
+			Request:    req,
+		}, nil
+	})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://api.github.com/gists/abc", "Bearer secret"},
+		{"https://raw.githubusercontent.com/owner/repo/main/main.py", ""},
+		{"https://gist.githubusercontent.com/owner/abc/raw/main.py", ""},
+	}
+
+	for _, tt := range tests {
+		authorization = ""
+		if _, err := githubGet(context.Background(), tt.url); err != nil {
+			t.Fatal(err)
+		}
+		if authorization != tt.want {
+			t.Errorf("githubGet(%q) sent Authorization %q, expected %q", tt.url, authorization, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// HealthStatus is the state of the bot's connections, used by the health checks.
+type HealthStatus struct {
+	mu sync.RWMutex
+
+	DiscordConnected bool      `json:"discord_connected"`
+	PistonReachable  bool      `json:"piston_reachable"`
+	PistonChecked    time.Time `json:"piston_checked"`
+
+	shards map[int]bool // whether each shard is connected
+}
+
+var health HealthStatus
+
+// setDiscordConnected records whether a shard is connected to the Discord
+// gateway. Discord is connected when every shard is.
+func (h *HealthStatus) setDiscordConnected(shard int, connected bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.shards == nil {
+		h.shards = make(map[int]bool)
+	}
+	h.shards[shard] = connected
+
+	h.DiscordConnected = true
+	for _, c := range h.shards {
+		h.DiscordConnected = h.DiscordConnected && c
+	}
+}
+
+// checkPiston pings Piston and records whether it is reachable.
+func (h *HealthStatus) checkPiston() {
+	_, err := GetRuntimes()
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msg("Piston is unreachable.")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.PistonReachable = err == nil
+	h.PistonChecked = time.Now()
+}
+
+// watchPiston pings Piston on an interval, so health checks don't hit Piston directly.
+func (h *HealthStatus) watchPiston(interval time.Duration) {
+	h.checkPiston()
+
+	go func() {
+		for range time.Tick(interval) {
+			h.checkPiston()
+		}
+	}()
+}
+
+// watchDiscord tracks the connection of a shard to the Discord gateway.
+func (h *HealthStatus) watchDiscord(dg *discordgo.Session) {
+	dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Connect) {
+		h.setDiscordConnected(s.ShardID, true)
+	})
+	dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Disconnect) {
+		h.setDiscordConnected(s.ShardID, false)
+	})
+}
+
+// handler responds with the health status, failing if ok returns false.
+func (h *HealthStatus) handler(ok func(h *HealthStatus) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok(h) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		err := json.NewEncoder(w).Encode(h)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error writing health status.")
+		}
+	}
+}
+
+func init() {
+	// Alive as long as the Discord gateway is connected.
+	httpMux.Handle("/healthz", health.handler(func(h *HealthStatus) bool {
+		return h.DiscordConnected
+	}))
+
+	// Ready to run code when Piston is also reachable.
+	httpMux.Handle("/readyz", health.handler(func(h *HealthStatus) bool {
+		return h.DiscordConnected && h.PistonReachable
+	}))
+}
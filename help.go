@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Commands that only server managers or bot admins can use, shown on the
+// admin page of the help.
+var adminCommands = map[string]bool{
+	"config":   true,
+	"admin":    true,
+	"shutdown": true,
+	"restart":  true,
+}
+
+// Maximum number of commands on a page of the help.
+const helpFieldsPerPage = 8
+
+// Discord allows at most 6000 characters in an embed, so pages of the help
+// are kept below this to leave room for the title and the names of fields.
+const helpPageLimit = 5000
+
+// Discord allows at most 256 characters in the name of an embed field.
+const embedFieldNameLimit = 256
+
+// commandUsage formats how a command is used from its options, e.g.
+// "`/duel <opponent> <language> [stdin]`", or "`/challenge create|submit`"
+// for a command with subcommands.
+func commandUsage(cmd *discordgo.ApplicationCommand) string {
+	var subcommands, args []string
+	for _, option := range cmd.Options {
+		switch {
+		case option.Type == discordgo.ApplicationCommandOptionSubCommand || option.Type == discordgo.ApplicationCommandOptionSubCommandGroup:
+			subcommands = append(subcommands, option.Name)
+		case option.Required:
+			args = append(args, "<"+option.Name+">")
+		default:
+			args = append(args, "["+option.Name+"]")
+		}
+	}
+
+	usage := "/" + cmd.Name
+	if len(subcommands) > 0 {
+		usage += " " + strings.Join(subcommands, "|")
+	}
+	if len(args) > 0 {
+		usage += " " + strings.Join(args, " ")
+	}
+
+	return "`" + truncate(usage, embedFieldNameLimit-2) + "`"
+}
+
+// commandHelp returns the help of a command in a locale: the "help.<name>"
+// key if there is one, then its translated description, then its
+// description.
+func commandHelp(locale discordgo.Locale, cmd *discordgo.ApplicationCommand) string {
+	if text := tr(locale, "help."+cmd.Name); text != "help."+cmd.Name {
+		return text
+	}
+	if text := tr(locale, "command."+cmd.Name); text != "command."+cmd.Name {
+		return text
+	}
+	return cmd.Description
+}
+
+// commandFields returns a field with the usage and help of every slash
+// command, sorted by name, that is or isn't an admin command.
+func commandFields(locale discordgo.Locale, admin bool) []*discordgo.MessageEmbedField {
+	var cmds []*discordgo.ApplicationCommand
+	for _, cmd := range commands {
+		if cmd.Type != 0 && cmd.Type != discordgo.ChatApplicationCommand {
+			continue
+		}
+		if adminCommands[cmd.Name] == admin {
+			cmds = append(cmds, cmd)
+		}
+	}
+	sort.Slice(cmds, func(a, b int) bool {
+		return cmds[a].Name < cmds[b].Name
+	})
+
+	fields := make([]*discordgo.MessageEmbedField, 0, len(cmds))
+	for _, cmd := range cmds {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  commandUsage(cmd),
+			Value: truncate(commandHelp(locale, cmd), embedFieldLimit),
+		})
+	}
+
+	return fields
+}
+
+// helpTopic splits the fields of a topic of the help into as many pages as
+// they need.
+func helpTopic(title string, description string, fields []*discordgo.MessageEmbedField) []*discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: title, Description: description}
+	embeds := []*discordgo.MessageEmbed{embed}
+
+	size := len(description)
+	for _, field := range fields {
+		fieldSize := len(field.Name) + len(field.Value)
+		if len(embed.Fields) > 0 && (len(embed.Fields) == helpFieldsPerPage || size+fieldSize > helpPageLimit) {
+			embed = &discordgo.MessageEmbed{Title: title}
+			embeds = append(embeds, embed)
+			size = 0
+		}
+
+		embed.Fields = append(embed.Fields, field)
+		size += fieldSize
+	}
+
+	return embeds
+}
+
+// helpPages returns the pages of the help in a locale, by topic: commands,
+// languages, examples, and the admin commands if the user can use them.
+func helpPages(i *discordgo.InteractionCreate) []*discordgo.MessageEmbed {
+	locale := i.Locale
+	title := func(topic string) string {
+		return tr(locale, "help.title") + ": " + tr(locale, "help.topic."+topic)
+	}
+
+	pages := helpTopic(title("commands"), "", commandFields(locale, false))
+
+	pages = append(pages, helpTopic(title("languages"), tr(locale, "help.topic.languages.description", len(getLanguages())), nil)...)
+
+	pages = append(pages, helpTopic(title("examples"), "", []*discordgo.MessageEmbedField{
+		{
+			Name:  tr(locale, "help.run_code.name"),
+			Value: tr(locale, "help.run_code") + runEmojiHelp(locale),
+		},
+		{
+			Name:  tr(locale, "help.code_blocks.name"),
+			Value: tr(locale, "help.code_blocks"),
+		},
+		{
+			Name:  tr(locale, "help.files.name"),
+			Value: tr(locale, "help.files"),
+		},
+	})...)
+
+	if canManageGuild(i) || isAdmin(interactionUser(i).ID) {
+		pages = append(pages, helpTopic(title("admin"), "", commandFields(locale, true))...)
+	}
+
+	return pages
+}
+
+// helpHandler shows the help, with buttons to move between its pages.
+func helpHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	params := paginateEmbeds(i.ID, helpPages(i), nil)
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds:     params.Embeds,
+				Components: params.Components,
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum length of output kept in the history.
+const historyOutputLimit = 1500
+
+// Maximum number of runs shown by /history.
+const historyMaxRuns = 5
+
+// Execution is a record of code that was run.
+type Execution struct {
+	ID       string        `json:"id"`               // ID of the interaction that ran the code
+	RunID    string        `json:"run_id,omitempty"` // see newExecutionID
+	UserID   string        `json:"user_id"`
+	GuildID  string        `json:"guild_id"`
+	Language string        `json:"language"`
+	Version  string        `json:"version"`
+	CodeHash string        `json:"code_hash"` // SHA-256 of the files
+	Status   string        `json:"status"`    // see executionStatus
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output"` // truncated to historyOutputLimit
+	Created  time.Time     `json:"created"`
+}
+
+// HistoryStore stores every execution in a file with one JSON record per
+// line, or in the database if there is one.
+type HistoryStore struct {
+	mu         sync.RWMutex
+	file       *os.File // nil if the executions are stored in the database
+	executions []Execution
+}
+
+// LoadHistoryStore loads the executions from a file, creating it if it doesn't exist.
+func LoadHistoryStore(path string) (*HistoryStore, error) {
+	if database != nil {
+		return loadHistoryDatabase(path)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HistoryStore{
+		file: file,
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Execution
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		h.executions = append(h.executions, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// loadHistoryDatabase loads the executions from the database. If it has none,
+// they are imported from the file at path, if it exists.
+func loadHistoryDatabase(path string) (*HistoryStore, error) {
+	h := &HistoryStore{}
+
+	records, err := database.Executions()
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range records {
+		var e Execution
+		err := json.Unmarshal(data, &e)
+		if err != nil {
+			return nil, err
+		}
+		h.executions = append(h.executions, e)
+	}
+
+	if len(records) > 0 {
+		return h, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Execution
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return nil, err
+		}
+
+		err = database.AddExecution(e.ID, e.UserID, e.GuildID, e.Created, scanner.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		h.executions = append(h.executions, e)
+	}
+
+	return h, scanner.Err()
+}
+
+// Add records an execution and appends it to the file.
+func (h *HistoryStore) Add(e Execution) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.executions = append(h.executions, e)
+	if h.file == nil {
+		return database.AddExecution(e.ID, e.UserID, e.GuildID, e.Created, data)
+	}
+
+	_, err = h.file.Write(append(data, '\n'))
+	return err
+}
+
+// Get returns an execution by the ID of its interaction.
+func (h *HistoryStore) Get(id string) (Execution, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, e := range h.executions {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Execution{}, false
+}
+
+// User returns the last n executions of a user, newest first.
+func (h *HistoryStore) User(userID string, n int) []Execution {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var executions []Execution
+	for k := len(h.executions) - 1; k >= 0 && len(executions) < n; k-- {
+		if h.executions[k].UserID == userID {
+			executions = append(executions, h.executions[k])
+		}
+	}
+	return executions
+}
+
+// All returns a copy of every execution, oldest first.
+func (h *HistoryStore) All() []Execution {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return append([]Execution(nil), h.executions...)
+}
+
+// hashFiles returns the SHA-256 hash of the names and contents of files.
+func hashFiles(files []piston.File) string {
+	hash := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(hash, "%d:%v%d:%v", len(f.Name), f.Name, len(f.Content), f.Content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// executionStatus summarizes the result of an execution: "success", "failed",
+// "timeout", "killed", "compile_error", or "error" if it couldn't be executed.
+func executionStatus(result *piston.ExecuteResponse, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case result.Compile != nil && result.Compile.Code != 0:
+		return "compile_error"
+	case result.Run.Status == "TO":
+		return "timeout"
+	case result.Run.Signal != "":
+		return "killed"
+	case result.Run.Code != 0:
+		return "failed"
+	}
+	return "success"
+}
+
+// recordExecution adds the result of running code to the history.
+func recordExecution(id string, userID string, guildID string, lang string, version string, files []piston.File, result *piston.ExecuteResponse, err error) {
+	e := Execution{
+		ID:       id,
+		UserID:   userID,
+		GuildID:  guildID,
+		Language: lang,
+		Version:  version,
+		CodeHash: hashFiles(files),
+		Status:   executionStatus(result, err),
+		RunID:    executionID(result, err),
+		Created:  time.Now(),
+	}
+
+	if err != nil {
+		e.Output = err.Error()
+	} else {
+		e.Version = result.Version
+		e.Duration = result.RunTime()
+		e.Output = fullOutput(result)
+	}
+	if len(e.Output) > historyOutputLimit {
+		e.Output = e.Output[:historyOutputLimit]
+	}
+
+	err = history.Add(e)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error recording execution.")
+	}
+}
+
+// History command definition.
+var historyCommand = &discordgo.ApplicationCommand{
+	Name:        "history",
+	Description: "Shows the code you ran recently.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "count",
+			Description: fmt.Sprintf("The number of runs to show (up to %d).", historyMaxRuns),
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Required:    false,
+		},
+	},
+}
+
+func historyHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	options := optionMap(i.ApplicationCommandData().Options)
+
+	count := historyMaxRuns
+	if option, ok := options["count"]; ok && option.IntValue() > 0 && int(option.IntValue()) < count {
+		count = int(option.IntValue())
+	}
+
+	executions := history.User(interactionUser(i).ID, count)
+	if len(executions) == 0 {
+		respondEphemeral(s, i, "You haven't run any code yet.")
+		return
+	}
+
+	lines := make([]string, len(executions))
+	var rerun, output []discordgo.MessageComponent
+	for n, e := range executions {
+		lines[n] = fmt.Sprintf(
+			"**%d.** <t:%d:R> %v %v: %v (%v)",
+			n+1, e.Created.Unix(), e.Language, e.Version, e.Status, e.Duration.Round(time.Millisecond),
+		)
+		if e.RunID != "" {
+			lines[n] += fmt.Sprintf(" `%v`", e.RunID)
+		}
+
+		// Code is only kept for a while, so older runs can't be run again.
+		if _, ok := getRun(e.ID); ok {
+			rerun = append(rerun, discordgo.Button{
+				Label:    fmt.Sprintf("Run #%d Again", n+1),
+				Style:    discordgo.PrimaryButton,
+				CustomID: "run_again:" + e.ID,
+			})
+		}
+		output = append(output, discordgo.Button{
+			Label:    fmt.Sprintf("Output #%d", n+1),
+			Style:    discordgo.SecondaryButton,
+			CustomID: "history_output:" + e.ID,
+		})
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: output},
+	}
+	if len(rerun) > 0 {
+		components = append(components, discordgo.ActionsRow{Components: rerun})
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Title:       "History",
+						Description: strings.Join(lines, "\n"),
+					},
+				},
+				Components: components,
+				Flags:      discordgo.MessageFlagsEphemeral,
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// historyOutputHandler shows the output of a run in the history.
+func historyOutputHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	id := strings.TrimPrefix(i.MessageComponentData().CustomID, "history_output:")
+
+	e, ok := history.Get(id)
+	if !ok || (e.UserID != interactionUser(i).ID && !isAdmin(interactionUser(i).ID)) {
+		respondEphemeral(s, i, "This run could not be found.")
+		return
+	}
+
+	respondEphemeral(s, i, splitOutput(e.Output, historyOutputLimit+100)[0])
+}
+
+// historyStats summarizes every execution in the history for admins.
+func historyStats() string {
+	executions := history.All()
+	if len(executions) == 0 {
+		return "No code has been run yet."
+	}
+
+	languages := make(map[string]int)
+	users := make(map[string]int)
+	errored := 0
+	var total time.Duration
+	for _, e := range executions {
+		languages[e.Language]++
+		users[e.UserID]++
+		if e.Status == "error" {
+			errored++
+		}
+		total += e.Duration
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Executions:** %d\n", len(executions))
+	fmt.Fprintf(&b, "**Users:** %d\n", len(users))
+	fmt.Fprintf(&b, "**Errors:** %.1f%%\n", float64(errored)/float64(len(executions))*100)
+	fmt.Fprintf(&b, "**Average Duration:** %v\n", (total / time.Duration(len(executions))).Round(time.Millisecond))
+
+	b.WriteString("**Top Languages:**\n")
+	for _, c := range topCounts(languages, 5) {
+		fmt.Fprintf(&b, "%v: %d\n", c.Key, c.Count)
+	}
+
+	b.WriteString("**Top Users:**\n")
+	for _, c := range topCounts(users, 5) {
+		fmt.Fprintf(&b, "<@%v>: %d\n", c.Key, c.Count)
+	}
+
+	return b.String()
+}
+
+type keyCount struct {
+	Key   string
+	Count int
+}
+
+// topCounts returns the n keys with the highest counts, highest first.
+func topCounts(counts map[string]int, n int) []keyCount {
+	sorted := make([]keyCount, 0, len(counts))
+	for k, c := range counts {
+		sorted = append(sorted, keyCount{k, c})
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].Count != sorted[b].Count {
+			return sorted[a].Count > sorted[b].Count
+		}
+		return sorted[a].Key < sorted[b].Key
+	})
+
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Locale that is used for strings missing from other locales.
+const defaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS // named by their Discord locale, e.g. fr.json or pt-BR.json
+
+// Translated strings by locale and key.
+var translations map[string]map[string]string
+
+// loadTranslations loads the strings of every locale file.
+func loadTranslations() error {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		return err
+	}
+
+	translations = make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			return err
+		}
+
+		var texts map[string]string
+		err = json.Unmarshal(data, &texts)
+		if err != nil {
+			return fmt.Errorf("%v: %w", e.Name(), err)
+		}
+		translations[strings.TrimSuffix(e.Name(), ".json")] = texts
+	}
+
+	if _, ok := translations[defaultLocale]; !ok {
+		return fmt.Errorf("missing locale file for %v", defaultLocale)
+	}
+
+	return nil
+}
+
+// tr returns the string of a key in a locale, formatted with args. The
+// language of regional locales, e.g. en for en-US, and then the default
+// locale are used if the locale doesn't have the string.
+func tr(locale discordgo.Locale, key string, args ...interface{}) string {
+	text, ok := translations[string(locale)][key]
+	if !ok {
+		lang := strings.SplitN(string(locale), "-", 2)[0]
+		text, ok = translations[lang][key]
+	}
+	if !ok {
+		text, ok = translations[defaultLocale][key]
+	}
+	if !ok {
+		return key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// localizeCommands adds the translated descriptions of commands and their
+// options to be registered with Discord. A command's description is the key
+// "command.<name>", and an option's is "command.<name>.<option>", or
+// "option.<option>" for options shared by many commands. Message commands
+// have no description, so their name is translated instead.
+func localizeCommands(commands []*discordgo.ApplicationCommand) {
+	for name, texts := range translations {
+		if name == defaultLocale {
+			continue
+		}
+		locale := discordgo.Locale(name)
+
+		for _, c := range commands {
+			key := "command." + c.Name
+			if text, ok := texts[key]; ok {
+				localized := c.DescriptionLocalizations
+				if c.Type == discordgo.MessageApplicationCommand {
+					localized = c.NameLocalizations
+				}
+				if localized == nil {
+					localized = &map[discordgo.Locale]string{}
+				}
+				(*localized)[locale] = text
+
+				if c.Type == discordgo.MessageApplicationCommand {
+					c.NameLocalizations = localized
+				} else {
+					c.DescriptionLocalizations = localized
+				}
+			}
+
+			localizeOptions(locale, texts, key, c.Options)
+		}
+	}
+}
+
+// localizeOptions adds the translated descriptions of options and their
+// subcommands' options.
+func localizeOptions(locale discordgo.Locale, texts map[string]string, prefix string, options []*discordgo.ApplicationCommandOption) {
+	for _, o := range options {
+		key := prefix + "." + o.Name
+
+		text, ok := texts[key]
+		if !ok {
+			text, ok = texts["option."+o.Name]
+		}
+		if ok {
+			if o.DescriptionLocalizations == nil {
+				o.DescriptionLocalizations = make(map[discordgo.Locale]string)
+			}
+			o.DescriptionLocalizations[locale] = text
+		}
+
+		localizeOptions(locale, texts, key, o.Options)
+	}
+}
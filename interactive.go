@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum length of the input given to an interactive program over all of
+// its runs.
+const maxInteractiveStdin = 4000
+
+// Errors printed by programs that tried to read input that wasn't given.
+var inputEOFErrors = []string{
+	"EOFError: EOF when reading a line", // Python
+	"java.util.NoSuchElementException",  // Java Scanner
+	"end of file reached (EOFError)",    // Ruby
+}
+
+// interactiveRun is the input given so far to a program that is run again
+// with more input each time its user provides it.
+type interactiveRun struct {
+	UserID      string
+	Stdin       string
+	Interactive bool // the user asked to give input, instead of it being detected
+	Created     time.Time
+}
+
+var (
+	interactiveRuns   = make(map[string]interactiveRun)
+	interactiveRunsMu sync.Mutex
+)
+
+// awaitsInput guesses if a program stopped because it was waiting for input:
+// it failed reading input that wasn't given, or it timed out after printing
+// a prompt.
+func awaitsInput(result *piston.ExecuteResponse) bool {
+	if result.Compile != nil && result.Compile.Code != 0 {
+		return false
+	}
+
+	for _, e := range inputEOFErrors {
+		if strings.Contains(result.Run.Stderr, e) {
+			return true
+		}
+	}
+
+	if result.Run.Status != "TO" {
+		return false
+	}
+
+	// A prompt is printed without a newline, or ends with a colon, question
+	// mark or angle bracket.
+	stdout := result.Run.Stdout
+	if stdout == "" {
+		return false
+	}
+	if !strings.HasSuffix(stdout, "\n") {
+		return true
+	}
+	trimmed := strings.TrimSpace(stdout)
+	return strings.HasSuffix(trimmed, ":") || strings.HasSuffix(trimmed, "?") || strings.HasSuffix(trimmed, ">")
+}
+
+// storeInteractiveRun saves the input given to the program run by an
+// interaction, so that more can be added, removing expired runs.
+func storeInteractiveRun(id string, run interactiveRun) {
+	run.Created = time.Now()
+
+	if redisClient != nil {
+		setShared("stdin", id, run, storedRunTTL)
+		return
+	}
+
+	interactiveRunsMu.Lock()
+	defer interactiveRunsMu.Unlock()
+
+	for k, r := range interactiveRuns {
+		if time.Since(r.Created) > storedRunTTL {
+			delete(interactiveRuns, k)
+		}
+	}
+
+	interactiveRuns[id] = run
+}
+
+// getInteractiveRun returns the input given to the program run by an
+// interaction, if it has not expired.
+func getInteractiveRun(id string) (interactiveRun, bool) {
+	if redisClient != nil {
+		var r interactiveRun
+		return r, getShared("stdin", id, &r)
+	}
+
+	interactiveRunsMu.Lock()
+	defer interactiveRunsMu.Unlock()
+
+	r, ok := interactiveRuns[id]
+	if !ok || time.Since(r.Created) > storedRunTTL {
+		return interactiveRun{}, false
+	}
+
+	return r, true
+}
+
+// addInputButton adds a button to give input to the program of an
+// interaction below the last message of its output.
+func addInputButton(messages []*discordgo.WebhookParams, id string) {
+	if len(messages) == 0 {
+		return
+	}
+
+	last := messages[len(messages)-1]
+	last.Components = append(last.Components, discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Enter Input",
+				Style:    discordgo.SecondaryButton,
+				CustomID: "stdin:" + id,
+			},
+		},
+	})
+}
+
+// stdinHandler asks the user of an interactive program for its next input.
+func stdinHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	id := strings.TrimPrefix(i.MessageComponentData().CustomID, "stdin:")
+
+	run, ok := getInteractiveRun(id)
+	if !ok {
+		respondEphemeral(s, i, "This program has expired. Please run it with `/run` again.")
+		return
+	}
+	if run.UserID != interactionUser(i).ID {
+		respondEphemeral(s, i, "Only the user who ran the program can give it input.")
+		return
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: "stdin_submit:" + id,
+				Title:    "Enter Input",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:  "input",
+								Label:     "Input, added after the input given before",
+								Style:     discordgo.TextInputParagraph,
+								Required:  true,
+								MaxLength: maxInteractiveStdin,
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// stdinSubmitHandler runs an interactive program again with the input given
+// before and the new input.
+func stdinSubmitHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	id := strings.TrimPrefix(i.ModalSubmitData().CustomID, "stdin_submit:")
+	w := NewResponseWriter(ctx, s, i)
+
+	run, ok := getRun(id)
+	input, inputOK := getInteractiveRun(id)
+	if !ok || !inputOK {
+		w.Error("This program has expired. Please run it with `/run` again.")
+		return
+	}
+
+	stdin := input.Stdin + strings.TrimSuffix(modalValues(i.ModalSubmitData())["input"], "\n") + "\n"
+	if len(stdin) > maxInteractiveStdin {
+		w.Error("The program has been given too much input. Please run it with `/run` again.")
+		return
+	}
+
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	// Execute the code with all the input and send the output.
+	w.Stdin = stdin
+	w.Interactive = input.Interactive
+	w.Env = run.Env
+	w.Deps = run.Deps
+	runCode(w, run.Language, run.Version, run.Files, run.Limits)
+}
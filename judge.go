@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of test cases, one embed field each.
+const maxJudgeCases = 20
+
+// Maximum size of an attached test case file.
+const maxTestFileSize = 1 << 20
+
+// How long the user has to submit test cases in the modal.
+const pendingJudgeTTL = 15 * time.Minute
+
+// TestCase is an input with the output a correct solution prints for it.
+type TestCase struct {
+	Input    string
+	Expected string
+}
+
+// testCaseResult is the result of running code on a test case.
+type testCaseResult struct {
+	Result *piston.ExecuteResponse
+	Err    error
+	Passed bool
+	Diff   string // first difference from the expected output
+}
+
+// pendingJudge is code waiting for its test cases to be submitted in a modal.
+type pendingJudge struct {
+	UserID   string
+	Language string
+	Version  string
+	Files    []piston.File
+	Limits   Limits
+	Created  time.Time
+}
+
+var (
+	pendingJudges   = make(map[string]*pendingJudge)
+	pendingJudgesMu sync.Mutex
+)
+
+// Judge command definition.
+var judgeCommand = &discordgo.ApplicationCommand{
+	Name:        "judge",
+	Description: "Runs code against test cases and checks its output. Run this command after a code message.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "tests",
+			Description: "A file of test cases. If not given, you can paste them instead.",
+			Type:        discordgo.ApplicationCommandOptionAttachment,
+			Required:    false,
+		},
+		{
+			Name:        "language",
+			Description: "The language to run the code in.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:         "version",
+			Description:  "The version of the language to use. Defaults to the latest version.",
+			Type:         discordgo.ApplicationCommandOptionString,
+			Required:     false,
+			Autocomplete: true,
+		},
+		{
+			Name:        "message",
+			Description: "A link to or the ID of the message to run. Defaults to the latest code message.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+	},
+}
+
+// How test cases are written, shown to users.
+const testCaseFormat = "Separate the input and expected output of a test case with a line of `===`, and test cases with a line of `---`."
+
+// parseTestCases parses test cases, separated by lines of "---", each with its
+// input and expected output separated by a line of "===".
+func parseTestCases(text string) ([]TestCase, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var cases []TestCase
+	var input, current []string
+	inExpected := false
+
+	finish := func() error {
+		if !inExpected {
+			if len(input) == 0 && len(current) == 0 {
+				return nil
+			}
+			return fmt.Errorf("test case %d has no `===` line before its expected output", len(cases)+1)
+		}
+		cases = append(cases, TestCase{
+			Input:    strings.Join(input, "\n"),
+			Expected: strings.Join(current, "\n"),
+		})
+		return nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		switch strings.TrimSpace(line) {
+		case "---":
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			input, current, inExpected = nil, nil, false
+		case "===":
+			input, current, inExpected = current, nil, true
+		default:
+			current = append(current, line)
+		}
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+
+	if len(cases) == 0 {
+		return nil, errors.New("no test cases found")
+	}
+	if len(cases) > maxJudgeCases {
+		return nil, fmt.Errorf("there are %d test cases, but at most %d can be run", len(cases), maxJudgeCases)
+	}
+
+	return cases, nil
+}
+
+// normalizeOutput removes trailing whitespace from every line and trailing
+// empty lines, which judges usually ignore.
+func normalizeOutput(output string) []string {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for n, line := range lines {
+		lines[n] = strings.TrimRight(line, " \t")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOutput describes the first line where the actual output differs from
+// the expected output, or returns an empty string if they match.
+func diffOutput(expected string, actual string) string {
+	e, a := normalizeOutput(expected), normalizeOutput(actual)
+
+	for n := 0; n < len(e) || n < len(a); n++ {
+		switch {
+		case n >= len(a):
+			return fmt.Sprintf("Line %d: expected `%v`, but the output ended", n+1, truncate(e[n], 100))
+		case n >= len(e):
+			return fmt.Sprintf("Line %d: expected the output to end, got `%v`", n+1, truncate(a[n], 100))
+		case e[n] != a[n]:
+			return fmt.Sprintf("Line %d: expected `%v`, got `%v`", n+1, truncate(e[n], 100), truncate(a[n], 100))
+		}
+	}
+
+	return ""
+}
+
+// downloadTestCases downloads an attached test case file.
+func downloadTestCases(attachment *discordgo.MessageAttachment) (string, error) {
+	if attachment.Size > maxTestFileSize {
+		return "", fmt.Errorf("the test case file is larger than %d bytes", maxTestFileSize)
+	}
+
+	res, err := http.Get(attachment.URL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", errors.New("downloading the test case file failed: " + res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxTestFileSize))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func judgeHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+	data := i.ApplicationCommandData()
+	options := optionMap(data.Options)
+
+	// Find the code before asking for test cases, so that missing code is
+	// reported right away.
+	lang, version, files, ok := getCodeFromChannel(w)
+	if !ok {
+		return
+	}
+
+	option, ok := options["tests"]
+	if !ok {
+		askTestCases(w, &pendingJudge{
+			UserID:   interactionUser(i).ID,
+			Language: lang,
+			Version:  version,
+			Files:    files,
+			Limits:   requestedLimits(i),
+		})
+		return
+	}
+
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	text, err := downloadTestCases(data.Resolved.Attachments[option.Value.(string)])
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error downloading test cases.")
+
+		w.Error(fmt.Sprintf("Error getting the test cases.```\n%v\n```", err))
+		return
+	}
+
+	cases, err := parseTestCases(text)
+	if err != nil {
+		w.Error(fmt.Sprintf("Invalid test cases: %v. %v", err, testCaseFormat))
+		return
+	}
+
+	runJudge(w, lang, version, files, requestedLimits(i), cases)
+}
+
+// askTestCases opens a modal for pasting test cases for code.
+func askTestCases(w *ResponseWriter, judge *pendingJudge) {
+	judge.Created = time.Now()
+
+	pendingJudgesMu.Lock()
+	for k, j := range pendingJudges {
+		if time.Since(j.Created) > pendingJudgeTTL {
+			delete(pendingJudges, k)
+		}
+	}
+	pendingJudges[w.Interaction.ID] = judge
+	pendingJudgesMu.Unlock()
+
+	err := w.Session.InteractionRespond(
+		w.Interaction.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: "judge_cases:" + w.Interaction.ID,
+				Title:    "Test Cases (" + judge.Language + ")",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:    "cases",
+								Label:       "Test Cases",
+								Style:       discordgo.TextInputParagraph,
+								Placeholder: "1 2\n===\n3\n---\n2 2\n===\n4",
+								Required:    true,
+								MaxLength:   4000,
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// judgeCasesHandler runs code against the test cases submitted in the modal.
+func judgeCasesHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+	id := strings.TrimPrefix(i.ModalSubmitData().CustomID, "judge_cases:")
+
+	pendingJudgesMu.Lock()
+	judge, ok := pendingJudges[id]
+	delete(pendingJudges, id)
+	pendingJudgesMu.Unlock()
+
+	if !ok || time.Since(judge.Created) > pendingJudgeTTL {
+		w.Error("These test cases have expired. Please run `/judge` again.")
+		return
+	}
+
+	cases, err := parseTestCases(modalValues(i.ModalSubmitData())["cases"])
+	if err != nil {
+		w.Error(fmt.Sprintf("Invalid test cases: %v. %v", err, testCaseFormat))
+		return
+	}
+
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	runJudge(w, judge.Language, judge.Version, judge.Files, judge.Limits, cases)
+}
+
+// runJudge runs code against every test case and sends a summary of which passed.
+func runJudge(w *ResponseWriter, lang string, version string, files []piston.File, limits Limits, cases []TestCase) {
+	runID := newExecutionID()
+	results := judgeCases(w.Context(), runID, lang, version, files, limits, cases)
+	i := w.Interaction
+	auditExecution(w.Session, i.ChannelID, interactionUser(i).ID, i.GuildID, runID, lang, files, judgeStatus(results))
+
+	w.Send(&discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{judgeEmbed(runID, lang, results, false)},
+	})
+}
+
+// judgeCases runs code against every test case. Each case is run with the
+// ID of the judging and its number, e.g. "1a2b3c4d-2".
+func judgeCases(ctx context.Context, runID string, lang string, version string, files []piston.File, limits Limits, cases []TestCase) []testCaseResult {
+	results := make([]testCaseResult, len(cases))
+	for n, c := range cases {
+		// Wait in the queue for every case so that judging doesn't starve
+		// other executions.
+		var result *piston.ExecuteResponse
+		release, err := execQueue.Acquire(ctx, nil)
+		if err == nil {
+			result, err = Execute(ctx, ExecRequest{
+				ID:       fmt.Sprintf("%v-%d", runID, n+1),
+				Language: lang,
+				Version:  version,
+				Files:    files,
+				Stdin:    c.Input,
+				Limits:   limits,
+			})
+			release()
+		}
+
+		results[n] = judgeCase(c, result, err)
+	}
+	return results
+}
+
+// judgeStatus describes how many test cases passed.
+func judgeStatus(results []testCaseResult) string {
+	passed := 0
+	for _, r := range results {
+		if r.Passed {
+			passed++
+		}
+	}
+	if passed == len(results) {
+		return fmt.Sprintf("passed all %d test cases", len(results))
+	}
+	return fmt.Sprintf("passed %d/%d test cases", passed, len(results))
+}
+
+// judgeCase checks the result of running code on a test case.
+func judgeCase(c TestCase, result *piston.ExecuteResponse, err error) testCaseResult {
+	r := testCaseResult{
+		Result: result,
+		Err:    err,
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+		return r
+	}
+
+	if status := executionStatus(result, nil); status != "success" {
+		r.Diff = resultSummary(result)
+		return r
+	}
+
+	r.Diff = diffOutput(c.Expected, result.Run.Stdout)
+	r.Passed = r.Diff == ""
+	return r
+}
+
+// judgeEmbed renders the results of judging code, with a field for every test
+// case and the ID of the judging below. Hidden test cases don't show how the
+// output differs from the expected output.
+func judgeEmbed(runID string, lang string, results []testCaseResult, hidden bool) *discordgo.MessageEmbed {
+	passed := 0
+	fields := make([]*discordgo.MessageEmbedField, len(results))
+
+	for n, r := range results {
+		var value string
+		switch {
+		case r.Err != nil:
+			value = "❌ " + execErrorMessage("code", r.Err)
+		case r.Passed:
+			passed++
+			value = fmt.Sprintf("✅ Passed in %v", r.Result.RunTime().Round(time.Millisecond))
+		case hidden:
+			value = "❌ Failed"
+		default:
+			value = "❌ " + r.Diff
+		}
+
+		fields[n] = &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("Case %d", n+1),
+			Value:  value,
+			Inline: true,
+		}
+	}
+
+	color := colorFailure
+	if passed == len(results) {
+		color = colorSuccess
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:  fmt.Sprintf("Judge (%v): %d/%d passed", lang, passed, len(results)),
+		Color:  color,
+		Fields: fields,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Run " + runID,
+		},
+	}
+}
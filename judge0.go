@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// Matches Judge0 language names, e.g. "Python (3.8.1)".
+var judge0LanguageRegex = regexp.MustCompile(`^(.+?) \((.+)\)$`)
+
+// Judge0Executor runs code on a Judge0 instance.
+type Judge0Executor struct {
+	URL        string // URL of the API, ending with a slash
+	APIKey     string // sent in the X-Auth-Token header, if set
+	HTTPClient *http.Client
+}
+
+// GET /languages
+type judge0Language struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// POST /submissions
+type judge0Submission struct {
+	SourceCode   string  `json:"source_code"`
+	LanguageID   int     `json:"language_id"`
+	Stdin        string  `json:"stdin,omitempty"`
+	CPUTimeLimit float64 `json:"cpu_time_limit,omitempty"` // seconds
+	MemoryLimit  int     `json:"memory_limit,omitempty"`   // KB
+}
+
+type judge0Result struct {
+	Stdout        *string `json:"stdout"`
+	Stderr        *string `json:"stderr"`
+	CompileOutput *string `json:"compile_output"`
+	Message       *string `json:"message"`
+	ExitCode      *int    `json:"exit_code"`
+	ExitSignal    *int    `json:"exit_signal"`
+	Time          *string `json:"time"`   // seconds
+	Memory        *int    `json:"memory"` // KB
+	Status        struct {
+		ID          int    `json:"id"`
+		Description string `json:"description"`
+	} `json:"status"`
+}
+
+// Judge0 status IDs.
+const (
+	judge0TimeLimitExceeded = 5
+	judge0CompilationError  = 6
+	judge0InternalError     = 13
+)
+
+func NewJudge0Executor(url string, apiKey string) *Judge0Executor {
+	if !strings.HasSuffix(url, "/") {
+		url += "/"
+	}
+
+	return &Judge0Executor{
+		URL:    url,
+		APIKey: apiKey,
+		HTTPClient: &http.Client{
+			Timeout: PISTON_TIMEOUT,
+		},
+	}
+}
+
+func (j *Judge0Executor) request(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		err := json.NewEncoder(&body).Encode(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, j.URL+path, &body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if j.APIKey != "" {
+		req.Header.Set("X-Auth-Token", j.APIKey)
+	}
+
+	res, err := j.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("judge0: %v: %w", err, piston.ErrUnreachable)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("judge0: %v: %w", res.Status, piston.ErrRateLimited)
+	case res.StatusCode >= 500:
+		return fmt.Errorf("judge0: %v: %w", res.Status, piston.ErrUnreachable)
+	case res.StatusCode >= 400:
+		return errors.New("judge0: " + res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// languages returns the Judge0 languages, mapped to runtimes by their IDs.
+func (j *Judge0Executor) languages(ctx context.Context) (map[int]piston.Runtime, error) {
+	var langs []judge0Language
+	err := j.request(ctx, "GET", "languages", nil, &langs)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimes := make(map[int]piston.Runtime, len(langs))
+	for _, l := range langs {
+		match := judge0LanguageRegex.FindStringSubmatch(l.Name)
+		if match == nil {
+			continue
+		}
+
+		runtimes[l.ID] = piston.Runtime{
+			Language: strings.ToLower(match[1]),
+			Version:  match[2],
+		}
+	}
+
+	return runtimes, nil
+}
+
+func (j *Judge0Executor) Runtimes(ctx context.Context) ([]piston.Runtime, error) {
+	langs, err := j.languages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimes := make([]piston.Runtime, 0, len(langs))
+	for _, r := range langs {
+		runtimes = append(runtimes, r)
+	}
+
+	return runtimes, nil
+}
+
+func (j *Judge0Executor) Execute(ctx context.Context, req piston.ExecuteRequest) (*piston.ExecuteResponse, error) {
+	if len(req.Files) != 1 {
+		return nil, fmt.Errorf("judge0 can only run a single file: %w", piston.ErrUnsupportedFeature)
+	}
+	if len(req.Env) > 0 {
+		return nil, fmt.Errorf("judge0 can't set environment variables: %w", piston.ErrUnsupportedFeature)
+	}
+	if len(req.Dependencies) > 0 {
+		return nil, fmt.Errorf("judge0 can't install dependencies: %w", piston.ErrUnsupportedFeature)
+	}
+
+	langs, err := j.languages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id := 0
+	for langID, r := range langs {
+		if r.Language == req.Language && r.Version == req.Version {
+			id = langID
+			break
+		}
+	}
+	if id == 0 {
+		return nil, fmt.Errorf("judge0 does not support %v %v: %w", req.Language, req.Version, piston.ErrUnsupportedLanguage)
+	}
+
+	submission := judge0Submission{
+		SourceCode:   req.Files[0].Content,
+		LanguageID:   id,
+		Stdin:        req.Stdin,
+		CPUTimeLimit: float64(req.RunTimeout) / 1000,
+		MemoryLimit:  req.RunMemoryLimit / 1000,
+	}
+
+	start := time.Now()
+
+	var result judge0Result
+	err = j.request(ctx, "POST", "submissions?base64_encoded=false&wait=true", submission, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Status.ID == judge0InternalError {
+		return nil, errors.New("judge0: " + str(result.Message))
+	}
+
+	res := &piston.ExecuteResponse{
+		Language: req.Language,
+		Version:  req.Version,
+		Duration: time.Since(start),
+	}
+
+	if result.Status.ID == judge0CompilationError {
+		res.Compile = &piston.ExecuteResults{
+			Output: str(result.CompileOutput),
+			Code:   1,
+		}
+		return res, nil
+	}
+
+	res.Run = piston.ExecuteResults{
+		Stdout:  str(result.Stdout),
+		Stderr:  str(result.Stderr),
+		Output:  str(result.Stdout) + str(result.Stderr),
+		Message: str(result.Message),
+	}
+	if result.ExitCode != nil {
+		res.Run.Code = *result.ExitCode
+	}
+	if result.ExitSignal != nil {
+		res.Run.Signal = fmt.Sprintf("signal %d", *result.ExitSignal)
+	}
+	if result.Status.ID == judge0TimeLimitExceeded {
+		res.Run.Status = "TO"
+	}
+	if result.Memory != nil {
+		res.Run.Memory = *result.Memory * 1000
+	}
+	if result.Time != nil {
+		var seconds float64
+		_, err := fmt.Sscan(*result.Time, &seconds)
+		if err == nil {
+			res.Run.CPUTime = int(seconds * 1000)
+		}
+	}
+
+	return res, nil
+}
+
+// str dereferences an optional string.
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
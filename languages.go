@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// The supported languages, refreshed from the Piston runtimes.
+var (
+	languagesMu      sync.RWMutex
+	languages        []string
+	languageMappings map[string][]string
+	languageVersions map[string][]string
+)
+
+// loadLanguages loads the supported languages from the Piston runtimes.
+func loadLanguages() error {
+	runtimes, err := GetRuntimes()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(runtimes))
+	mappings := make(map[string][]string, len(runtimes))
+	versions := make(map[string][]string, len(runtimes))
+
+	for _, r := range runtimes {
+		// A language can have multiple runtimes with different versions.
+		if _, ok := mappings[r.Language]; !ok {
+			names = append(names, r.Language)
+		}
+		mappings[r.Language] = append(mappings[r.Language], r.Aliases...)
+		versions[r.Language] = append(versions[r.Language], r.Version)
+	}
+
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+
+	languages = names
+	languageMappings = mappings
+	languageVersions = versions
+
+	return nil
+}
+
+// refreshLanguages reloads the supported languages on an interval, so that
+// newly installed Piston packages can be used without a restart.
+func refreshLanguages(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			err := loadLanguages()
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("Error refreshing languages.")
+				continue
+			}
+
+			log.Debug().
+				Strs("languages", getLanguages()).
+				Msg("Refreshed languages.")
+		}
+	}()
+}
+
+// getLanguages returns the names of the supported languages.
+func getLanguages() []string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+
+	return languages
+}
+
+// getLanguageVersions returns the supported versions of a language.
+func getLanguageVersions(lang string) []string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+
+	return languageVersions[lang]
+}
+
+// getLanguageAliases returns the aliases of a language, without duplicates
+// from its runtimes.
+func getLanguageAliases(lang string) []string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+
+	var aliases []string
+	for _, alias := range languageMappings[lang] {
+		if !stringInSlice(alias, aliases) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// resolveLanguage returns the language matching a name or alias, or an empty
+// string if there is none.
+func resolveLanguage(name string) string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+
+	for lang, aliases := range languageMappings {
+		if strings.EqualFold(name, lang) {
+			return lang
+		}
+		for _, alias := range aliases {
+			// Check if the name is a valid alias of the language.
+			if strings.EqualFold(alias, name) {
+				return lang
+			}
+		}
+	}
+
+	return ""
+}
+
+// resolveGuildLanguage returns the language matching a name or alias, with
+// the aliases added in a guild, or an empty string if there is none.
+func resolveGuildLanguage(guildID string, name string) string {
+	if lang, ok := guildConfigs.Get(guildID).Aliases[strings.ToLower(name)]; ok {
+		return lang
+	}
+	return resolveLanguage(name)
+}
+
+// Number of languages on each page of /languages.
+const languagesPerPage = 10
+
+// Languages command definition.
+var languagesCommand = &discordgo.ApplicationCommand{
+	Name:        "languages",
+	Description: "Shows the supported languages, their versions, and aliases.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "name",
+			Description: "A language to show the versions and aliases of.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+	},
+}
+
+// languageField describes the versions and aliases of a language, with the
+// aliases added by a guild.
+func languageField(lang string, guildID string) *discordgo.MessageEmbedField {
+	aliases := getLanguageAliases(lang)
+	for alias, l := range guildConfigs.Get(guildID).Aliases {
+		if l == lang && !stringInSlice(alias, aliases) {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	value := "**Versions:** " + strings.Join(getLanguageVersions(lang), ", ")
+	if len(aliases) > 0 {
+		value += "\n**Aliases:** " + strings.Join(aliases, ", ")
+	}
+
+	return &discordgo.MessageEmbedField{
+		Name:  lang,
+		Value: truncate(value, embedFieldLimit),
+	}
+}
+
+// languagesHandler shows one language, or every language on pages.
+func languagesHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	options := commandOptions(i)
+
+	var params *discordgo.WebhookParams
+	if option, ok := options["name"]; ok {
+		lang := resolveGuildLanguage(i.GuildID, option.StringValue())
+		if lang == "" {
+			respondEphemeral(s, i, fmt.Sprintf("Language %v is not supported. Use `/languages` to see the supported languages.", option.StringValue()))
+			return
+		}
+
+		params = &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:  tr(i.Locale, "languages.title"),
+					Fields: []*discordgo.MessageEmbedField{languageField(lang, i.GuildID)},
+				},
+			},
+		}
+	} else {
+		langs := append([]string(nil), getLanguages()...)
+		sort.Strings(langs)
+		if len(langs) == 0 {
+			respondEphemeral(s, i, "No languages are available right now.")
+			return
+		}
+
+		var embeds []*discordgo.MessageEmbed
+		for start := 0; start < len(langs); start += languagesPerPage {
+			end := start + languagesPerPage
+			if end > len(langs) {
+				end = len(langs)
+			}
+
+			embed := &discordgo.MessageEmbed{
+				Title:       tr(i.Locale, "languages.title"),
+				Description: tr(i.Locale, "languages.description", len(langs)),
+			}
+			for _, lang := range langs[start:end] {
+				embed.Fields = append(embed.Fields, languageField(lang, i.GuildID))
+			}
+			embeds = append(embeds, embed)
+		}
+
+		params = paginateEmbeds(i.ID, embeds, nil)
+		if len(embeds) == 1 {
+			params.Components = nil
+		}
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds:     params.Embeds,
+				Components: params.Components,
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
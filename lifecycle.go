@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Receives a request to stop the bot from /shutdown or /restart, with whether
+// it should start again.
+var stopRequests = make(chan bool, 1)
+
+// Shutdown command definition.
+var shutdownCommand = &discordgo.ApplicationCommand{
+	Name:        "shutdown",
+	Description: "Shuts down the bot once in-flight runs finish.",
+}
+
+// Restart command definition.
+var restartCommand = &discordgo.ApplicationCommand{
+	Name:        "restart",
+	Description: "Restarts the bot once in-flight runs finish.",
+}
+
+func shutdownHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	requestStop(s, i, false)
+}
+
+func restartHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	requestStop(s, i, true)
+}
+
+// requestStop stops the bot for an admin, the same as on SIGTERM. Runs that
+// are in flight finish first, for up to SHUTDOWN_TIMEOUT.
+func requestStop(s Discord, i *discordgo.InteractionCreate, restart bool) {
+	if !isAdmin(interactionUser(i).ID) {
+		respondEphemeral(s, i, "You are not allowed to use admin commands.")
+		return
+	}
+
+	log.Info().
+		Bool("restart", restart).
+		Str("user_id", interactionUser(i).ID).
+		Msg("Stop requested.")
+
+	select {
+	case stopRequests <- restart:
+	default:
+		respondEphemeral(s, i, "The bot is already stopping.")
+		return
+	}
+
+	if restart {
+		respondEphemeral(s, i, "Restarting once in-flight runs finish.")
+	} else {
+		respondEphemeral(s, i, "Shutting down once in-flight runs finish.")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Matches message links anywhere in a message.
+var messageLinksRegex = regexp.MustCompile(`https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(\d+)/(\d+)/(\d+)`)
+
+// canReadChannel checks if a user can read the messages of a channel, so
+// that linked code is only shown to those who could see it.
+func canReadChannel(s Discord, userID string, channelID string) bool {
+	permissions, err := s.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Str("user_id", userID).
+			Str("channel_id", channelID).
+			Msg("Error getting channel permissions.")
+		return false
+	}
+
+	needed := int64(discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory)
+	return permissions&needed == needed
+}
+
+// linkMessageHandler offers to run the code message linked in a message, in
+// guilds that enabled link detection.
+func linkMessageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	defer recoverEvent("link message")
+
+	if m.Author == nil || m.Author.Bot || m.GuildID == "" {
+		return
+	}
+
+	g := guildConfigs.Get(m.GuildID)
+	if !g.LinkDetection || !g.ChannelAllowed(m.ChannelID, threadParent(s, m.ChannelID)) {
+		return
+	}
+
+	// Only the first link to a message of this guild is offered.
+	var channelID, messageID string
+	for _, match := range messageLinksRegex.FindAllStringSubmatch(m.Content, -1) {
+		if match[1] == m.GuildID {
+			channelID, messageID = match[2], match[3]
+			break
+		}
+	}
+	if messageID == "" || !canReadChannel(s, m.Author.ID, channelID) {
+		return
+	}
+
+	linked, err := s.ChannelMessage(channelID, messageID)
+	if err != nil || !isCodeMessage(linked) {
+		return
+	}
+
+	replyWith(s, m.Message, &discordgo.WebhookParams{
+		Content: "That message has code in it. Run this?",
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Run Code",
+						Style:    discordgo.PrimaryButton,
+						CustomID: "run_link:" + channelID + ":" + messageID,
+					},
+				},
+			},
+		},
+	})
+}
+
+// runLinkHandler runs the code message offered by linkMessageHandler.
+func runLinkHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+
+	ids := strings.Split(strings.TrimPrefix(i.MessageComponentData().CustomID, "run_link:"), ":")
+	if len(ids) != 2 {
+		return
+	}
+	channelID, messageID := ids[0], ids[1]
+
+	if !canReadChannel(s, interactionUser(i).ID, channelID) {
+		w.Error("You can't see the channel of this message.")
+		return
+	}
+
+	message, err := s.ChannelMessage(channelID, messageID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("message_id", messageID).
+			Msg("Error getting message.")
+
+		w.Error(tr(i.Locale, "error.message_not_found"))
+		return
+	}
+	if !isCodeMessage(message) {
+		w.Error(tr(i.Locale, "error.not_code_message"))
+		return
+	}
+
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	lang, version, files, ok := getCodeFromMessage(w, message, "", "", guildLimits(i.GuildID))
+	if !ok {
+		return
+	}
+
+	// Execute the code and send the output.
+	runCode(w, lang, version, files, guildLimits(i.GuildID))
+}
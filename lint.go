@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of findings shown by /lint.
+const lintMaxFindings = 15
+
+// Lints Python code with flake8 or pylint, whichever is installed, falling
+// back to checking the syntax.
+const pythonLintProgram = `import importlib.util
+import os
+import subprocess
+import sys
+import tempfile
+
+code = sys.stdin.read()
+path = os.path.join(tempfile.mkdtemp(), "main.py")
+with open(path, "w") as f:
+    f.write(code)
+
+for linter in (["flake8"], ["pylint", "--output-format=parseable", "--score=n"]):
+    if importlib.util.find_spec(linter[0]) is not None:
+        result = subprocess.run([sys.executable, "-m", *linter, path], capture_output=True, text=True)
+        sys.stdout.write(result.stdout.replace(path, "main.py"))
+        sys.exit(0)
+
+try:
+    compile(code, "main.py", "exec")
+except SyntaxError as e:
+    print(f"main.py:{e.lineno}:{e.offset}: {e.msg}")
+`
+
+// Vets Go code with the go command of the runtime.
+const goVetProgram = `package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+func main() {
+	src, _ := io.ReadAll(os.Stdin)
+	dir, _ := os.MkdirTemp("", "vet")
+	os.WriteFile(filepath.Join(dir, "main.go"), src, 0o644)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module vet\n"), 0o644)
+
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "vet", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOCACHE="+filepath.Join(dir, ".cache"), "GOPATH="+filepath.Join(dir, ".gopath"))
+	out, _ := cmd.CombinedOutput()
+	os.Stdout.Write(out)
+}
+`
+
+// Lints JavaScript code with the recommended eslint rules.
+const eslintProgram = `let ESLint;
+try {
+  ({ ESLint } = require("eslint"));
+} catch {
+  console.error("eslint is not installed on the execution backend.");
+  process.exit(1);
+}
+
+const src = require("fs").readFileSync(0, "utf8");
+const eslint = new ESLint({
+  useEslintrc: false,
+  overrideConfig: {
+    extends: ["eslint:recommended"],
+    parserOptions: { ecmaVersion: "latest", sourceType: "module" },
+    env: { node: true, browser: true, es2022: true },
+  },
+});
+eslint.lintText(src, { filePath: "main.js" }).then(
+  (results) => {
+    for (const m of results[0].messages) {
+      console.log("main.js:" + m.line + ":" + m.column + ": " + m.message + (m.ruleId ? " (" + m.ruleId + ")" : ""));
+    }
+  },
+  (err) => {
+    console.error(err.message);
+    process.exit(1);
+  },
+);
+`
+
+// Linters of the languages that can be linted. They print one finding per
+// line, e.g. "main.py:3:1: message".
+var linters = map[string]Tool{
+	"python":     {"flake8/pylint", "python", pythonLintProgram},
+	"go":         {"go vet", "go", goVetProgram},
+	"javascript": {"eslint", "javascript", eslintProgram},
+}
+
+// lintLanguages returns the languages that can be linted.
+func lintLanguages() string {
+	langs := make([]string, 0, len(linters))
+	for lang, l := range linters {
+		langs = append(langs, fmt.Sprintf("%v (%v)", lang, l.Name))
+	}
+	sort.Strings(langs)
+	return strings.Join(langs, ", ")
+}
+
+// Matches a finding of a linter, e.g. "main.py:3:1: message" or "./main.go:3: message".
+var lintFindingRegex = regexp.MustCompile(`^\S*?:(\d+):(?:(\d+):)?\s*(.+)$`)
+
+// LintFinding is a problem found by a linter.
+type LintFinding struct {
+	Line    int
+	Column  int // 0 if not reported
+	Message string
+}
+
+// parseLintFindings returns the findings in the output of a linter.
+func parseLintFindings(output string) []LintFinding {
+	var findings []LintFinding
+	for _, line := range strings.Split(output, "\n") {
+		match := lintFindingRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		f := LintFinding{
+			Message: match[3],
+		}
+		f.Line, _ = strconv.Atoi(match[1])
+		f.Column, _ = strconv.Atoi(match[2])
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// Lint command definition.
+var lintCommand = &discordgo.ApplicationCommand{
+	Name:        "lint",
+	Description: "Checks the latest code message for problems. Run this command after a code message.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "language",
+			Description: "The language of the code.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:        "message",
+			Description: "A link to or the ID of the message to check. Defaults to the latest code message.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+	},
+}
+
+func lintHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	// The code is checked as it was posted.
+	w.Raw = true
+	lang, _, files, ok := getCodeFromChannel(w)
+	if !ok {
+		return
+	}
+
+	l, ok := linters[lang]
+	if !ok {
+		w.Error(fmt.Sprintf("%v code can't be linted. Languages that can be linted are: %v", lang, lintLanguages()))
+		return
+	}
+
+	code := files[0].Content
+	result, err := runTool(w.Context(), l, code, guildLimits(i.GuildID))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Str("linter", l.Name).
+			Msg("Error executing linter.")
+
+		w.Error(execErrorMessage(l.Name, err))
+		return
+	}
+
+	if executionStatus(result, nil) != "success" {
+		w.Error(labelOutput(l.Name+" failed", splitOutput(fullOutput(result), 1800))[0])
+		return
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{lintEmbed(l, lang, code, parseLintFindings(result.Run.Stdout))},
+	})
+}
+
+// lintEmbed renders the findings of a linter, with the line of code each
+// one is on.
+func lintEmbed(l Tool, lang string, code string, findings []LintFinding) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Lint (%v, %v)", lang, l.Name),
+		Color: colorSuccess,
+	}
+
+	if len(findings) == 0 {
+		embed.Description = "No problems found."
+		return embed
+	}
+
+	lines := strings.Split(strings.ReplaceAll(code, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	for n, f := range findings {
+		if n == lintMaxFindings {
+			fmt.Fprintf(&b, "...and %d more.", len(findings)-n)
+			break
+		}
+
+		location := strconv.Itoa(f.Line)
+		if f.Column > 0 {
+			location += ":" + strconv.Itoa(f.Column)
+		}
+		fmt.Fprintf(&b, "**%v** %v\n", location, truncate(f.Message, 200))
+
+		if f.Line > 0 && f.Line <= len(lines) && strings.TrimSpace(lines[f.Line-1]) != "" {
+			fmt.Fprintf(&b, "> `%v`\n", truncate(strings.ReplaceAll(strings.TrimSpace(lines[f.Line-1]), "`", "'"), 100))
+		}
+	}
+
+	embed.Color = colorFailure
+	embed.Description = b.String()
+	embed.Footer = &discordgo.MessageEmbedFooter{
+		Text: fmt.Sprintf("%d problems found", len(findings)),
+	}
+	return embed
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// setupLogging configures the global logger from LOG_LEVEL, LOG_FORMAT and
+// LOG_FILE. It must be called once the environment has been loaded.
+func setupLogging() {
+	level, err := zerolog.ParseLevel(strings.ToLower(LOG_LEVEL))
+	if err != nil || level == zerolog.NoLevel {
+		log.Fatal().
+			Str("log_level", LOG_LEVEL).
+			Msg("Invalid LOG_LEVEL.")
+	}
+	zerolog.SetGlobalLevel(level)
+
+	var out io.Writer
+	switch LOG_FORMAT {
+	case "console":
+		out = zerolog.ConsoleWriter{Out: os.Stdout}
+	case "json":
+		out = os.Stdout
+	default:
+		log.Fatal().
+			Str("log_format", LOG_FORMAT).
+			Msg("LOG_FORMAT must be console or json.")
+	}
+
+	writers := []io.Writer{out}
+	if LOG_FILE != "" {
+		file, err := NewRotatingFile(LOG_FILE, int64(LOG_FILE_MAX_SIZE)*1024*1024, LOG_FILE_MAX_BACKUPS)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Str("log_file", LOG_FILE).
+				Msg("Error opening log file.")
+		}
+		// Log files are always JSON, so they can be processed by other tools.
+		writers = append(writers, file)
+	}
+
+	log.Logger = zerolog.New(zerolog.MultiLevelWriter(writers...)).With().Timestamp().Logger()
+}
+
+// RotatingFile is a log file that is rotated once it reaches a maximum size.
+// Rotated files are renamed with the time they were rotated, and only the
+// newest backups are kept.
+type RotatingFile struct {
+	mu sync.Mutex
+
+	Path       string
+	MaxSize    int64 // bytes; 0 for unlimited
+	MaxBackups int   // 0 to keep every backup
+
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens a log file for appending, creating it if it doesn't exist.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}
+
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if p would make it too large.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		err := f.rotate()
+		if err != nil {
+			// Keep logging to stderr rather than losing the entry.
+			fmt.Fprintf(os.Stderr, "Error rotating log file: %v\n", err)
+		}
+	}
+
+	if f.file == nil {
+		return os.Stderr.Write(p)
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file to a backup, opens a new one and removes
+// old backups.
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	ext := filepath.Ext(f.Path)
+	backup := fmt.Sprintf("%v-%v%v", strings.TrimSuffix(f.Path, ext), time.Now().UTC().Format("20060102T150405.000"), ext)
+	err := os.Rename(f.Path, backup)
+	if err != nil {
+		return err
+	}
+
+	err = f.open()
+	if err != nil {
+		return err
+	}
+
+	if f.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(strings.TrimSuffix(f.Path, ext) + "-*" + ext)
+	if err != nil {
+		return err
+	}
+	// Backup names sort by the time they were rotated.
+	sort.Strings(backups)
+	for len(backups) > f.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
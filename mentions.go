@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// mentionCommand returns the command a message gives the bot by mentioning
+// it, e.g. "run" for "@CodeRunnerBot run", or an empty string if the message
+// doesn't mention the bot.
+func mentionCommand(s *discordgo.Session, m *discordgo.Message) string {
+	if s.State == nil || s.State.User == nil {
+		return ""
+	}
+	botID := s.State.User.ID
+
+	mentioned := false
+	for _, u := range m.Mentions {
+		if u.ID == botID {
+			mentioned = true
+			break
+		}
+	}
+	if !mentioned {
+		return ""
+	}
+
+	content := strings.NewReplacer("<@"+botID+">", "", "<@!"+botID+">", "").Replace(m.Content)
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// mentionHandler runs the code in a message mentioning the bot with "run",
+// or the code message it replies to, for servers where slash commands
+// aren't available.
+func mentionHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	defer recoverEvent("mention")
+
+	if m.Author == nil || m.Author.Bot || m.GuildID == "" || m.Member == nil {
+		return
+	}
+	if mentionCommand(s, m.Message) != "run" {
+		return
+	}
+
+	runRequestedMessage(s, m, "mention")
+}
+
+// runRequestedMessage runs the code in a message asking to run code, or in
+// the code message it replies to, replying with the output. The source, e.g.
+// "mention", is counted in the metrics.
+func runRequestedMessage(s *discordgo.Session, m *discordgo.MessageCreate, source string) {
+	if !shutdown.Begin() {
+		return
+	}
+	defer shutdown.Done()
+
+	// Check that the user is allowed to run code here.
+	if !guildConfigs.Get(m.GuildID).ChannelAllowed(m.ChannelID, threadParent(s, m.ChannelID)) {
+		replyWith(s, m.Message, &discordgo.WebhookParams{
+			Content: tr("", "error.channel_disabled"),
+		})
+		return
+	}
+	if !isAdmin(m.Author.ID) && !memberHasRole(m.GuildID, m.Member, "run") {
+		return
+	}
+
+	if isCodeMessage(m.Message) {
+		runCodeMessage(s, m.Message, m.Author.ID, m.GuildID, source)
+		return
+	}
+
+	if m.MessageReference == nil {
+		replyWith(s, m.Message, &discordgo.WebhookParams{
+			Content: "Reply to a code message with this to run it, or put the code after it.",
+		})
+		return
+	}
+
+	message := m.ReferencedMessage
+	if message == nil {
+		var err error
+		message, err = s.ChannelMessage(m.MessageReference.ChannelID, m.MessageReference.MessageID)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("message_id", m.MessageReference.MessageID).
+				Msg("Error getting message.")
+
+			replyWith(s, m.Message, &discordgo.WebhookParams{
+				Content: tr("", "error.message_not_found"),
+			})
+			return
+		}
+	}
+
+	message = resolveStarterMessage(s, message)
+	if !isCodeMessage(message) {
+		replyWith(s, m.Message, &discordgo.WebhookParams{
+			Content: tr("", "error.not_code_message"),
+		})
+		return
+	}
+
+	// The channel of the message replied to may be missing from the reference.
+	if message.ChannelID == "" {
+		message.ChannelID = m.ChannelID
+	}
+
+	runCodeMessage(s, message, m.Author.ID, m.GuildID, source)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	commandsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crb_commands_received_total",
+		Help: "Number of commands and other interactions received.",
+	}, []string{"command", "shard"})
+
+	handlerPanics = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crb_handler_panics_total",
+		Help: "Number of panics recovered from in interaction and event handlers.",
+	})
+
+	executions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crb_executions_total",
+		Help: "Number of code executions per language.",
+	}, []string{"language"})
+
+	blockedRuns = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crb_blocked_runs_total",
+		Help: "Number of runs refused because the code matched a blocked pattern.",
+	})
+
+	cachedResults = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crb_cached_results_total",
+		Help: "Number of executions answered from the result cache.",
+	})
+
+	pistonErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crb_piston_errors_total",
+		Help: "Number of failed requests to Piston.",
+	})
+
+	executionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crb_execution_duration_seconds",
+		Help:    "Latency of code executions, including the request to Piston.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30},
+	}, []string{"language"})
+
+	discordErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crb_discord_errors_total",
+		Help: "Number of failed requests to the Discord API.",
+	})
+
+	shardConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "crb_shard_connected",
+		Help: "Whether each shard is connected to the Discord gateway.",
+	}, []string{"shard"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "crb_queue_depth",
+		Help: "Number of executions waiting in the queue.",
+	}, func() float64 {
+		return float64(execQueue.Len())
+	})
+)
+
+// metricsTransport counts failed requests to the Discord API.
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil || res.StatusCode >= 400 {
+		discordErrors.Inc()
+	}
+	return res, err
+}
+
+func init() {
+	httpMux.Handle("/metrics", promhttp.Handler())
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of messages in a scratchpad thread whose code is combined.
+const padMaxMessages = 100
+
+// Pad command definition.
+var padCommand = &discordgo.ApplicationCommand{
+	Name:        "pad",
+	Description: "Creates a thread where everyone can add code blocks and run them combined.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "language",
+			Description: "The language of the code.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    true,
+		},
+		{
+			Name:        "name",
+			Description: "The name of the thread.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+	},
+}
+
+// padComponents returns the components for running the code of a scratchpad.
+// The language is kept in the custom ID so the button works across restarts.
+func padComponents(lang string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Run Combined",
+					Style:    discordgo.PrimaryButton,
+					CustomID: "pad_run:" + lang,
+				},
+			},
+		},
+	}
+}
+
+func padHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	if !checkChannel(s, i) || !checkThreadChannel(s, i) {
+		return
+	}
+
+	options := optionMap(i.ApplicationCommandData().Options)
+
+	lang := resolveGuildLanguage(i.GuildID, options["language"].StringValue())
+	if lang == "" {
+		respondEphemeral(s, i, fmt.Sprintf("Language %v is not supported. Supported languages are: %v", options["language"].StringValue(), getLanguages()))
+		return
+	}
+
+	name := fmt.Sprintf("%v scratchpad", lang)
+	if option, ok := options["name"]; ok {
+		name = truncate(option.StringValue(), 100)
+	}
+
+	thread, err := s.ThreadStart(i.ChannelID, name, discordgo.ChannelTypeGuildPublicThread, 1440)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error starting thread.")
+
+		respondEphemeral(s, i, "Error starting the scratchpad thread. Scratchpads can't be started inside threads, and the bot needs permission to create threads here.")
+		return
+	}
+
+	_, err = s.ChannelMessageSendComplex(thread.ID, &discordgo.MessageSend{
+		Content: fmt.Sprintf(
+			"Anyone can post %v code blocks here. Press the button to run every code block in this thread combined, oldest first.",
+			lang,
+		),
+		Components: padComponents(lang),
+	})
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending message.")
+	}
+
+	log.Info().
+		Str("thread_id", thread.ID).
+		Str("user_id", interactionUser(i).ID).
+		Str("language", lang).
+		Msg("Scratchpad created.")
+
+	err = s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Created a %v scratchpad in <#%v>.", lang, thread.ID),
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// padRunHandler runs the code blocks of a scratchpad thread combined.
+func padRunHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+	lang := strings.TrimPrefix(i.MessageComponentData().CustomID, "pad_run:")
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	code, ok := padCode(w)
+	if !ok || w.Blocked([]piston.File{{Content: code}}) {
+		return
+	}
+
+	// Execute the code and send the output.
+	runCode(w, lang, "", applyTemplate(lang, []piston.File{{Content: code}}), guildLimits(i.GuildID))
+}
+
+// padCode combines the code blocks posted in the thread of the interaction,
+// oldest first. If there are none, an error is sent and ok is false.
+func padCode(w *ResponseWriter) (string, bool) {
+	messages, err := w.Session.ChannelMessages(w.Interaction.ChannelID, padMaxMessages, "", "", "", discordgo.WithContext(w.Context()))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error getting messages in channel.")
+
+		w.Error("Error getting messages in channel.")
+		return "", false
+	}
+
+	// Messages are returned newest first.
+	var code []string
+	for n := len(messages) - 1; n >= 0; n-- {
+		if messages[n].Author != nil && messages[n].Author.Bot {
+			continue
+		}
+		for _, b := range parseCodeBlocks(messages[n].Content) {
+			code = append(code, b.Code)
+		}
+	}
+
+	if len(code) == 0 {
+		w.Error("No code blocks have been posted in this scratchpad yet.")
+		return "", false
+	}
+
+	return strings.Join(code, "\n"), true
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// How long paginated output can be navigated.
+const pagesTTL = time.Hour
+
+// pagedOutput is output split into pages shown one at a time in a message.
+// Pages are either message contents or embeds.
+type pagedOutput struct {
+	Pages      []string
+	Embeds     []*discordgo.MessageEmbed    `json:",omitempty"`
+	Components []discordgo.MessageComponent // shown below the page buttons
+	Created    time.Time
+}
+
+// count returns the number of pages.
+func (p pagedOutput) count() int {
+	if len(p.Embeds) > 0 {
+		return len(p.Embeds)
+	}
+	return len(p.Pages)
+}
+
+// UnmarshalJSON unmarshals paged output shared between replicas, whose
+// components can't be unmarshaled without knowing their types.
+func (p *pagedOutput) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Pages      []string
+		Embeds     []*discordgo.MessageEmbed
+		Components []json.RawMessage
+		Created    time.Time
+	}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+
+	p.Pages = v.Pages
+	p.Embeds = v.Embeds
+	p.Created = v.Created
+	p.Components = nil
+	for _, c := range v.Components {
+		component, err := discordgo.MessageComponentFromJSON(c)
+		if err != nil {
+			return err
+		}
+		p.Components = append(p.Components, component)
+	}
+
+	return nil
+}
+
+var (
+	pagedOutputs   = make(map[string]pagedOutput)
+	pagedOutputsMu sync.Mutex
+)
+
+// paginate stores pages of output by an ID and returns a message showing the
+// first page, with buttons to move between pages above the components.
+func paginate(id string, pages []string, components []discordgo.MessageComponent) *discordgo.WebhookParams {
+	storePages(id, pagedOutput{
+		Pages:      pages,
+		Components: components,
+		Created:    time.Now(),
+	})
+
+	return &discordgo.WebhookParams{
+		Content:    pages[0],
+		Components: pageComponents(id, 0, len(pages), components),
+	}
+}
+
+// paginateEmbeds is like paginate, with an embed on each page.
+func paginateEmbeds(id string, embeds []*discordgo.MessageEmbed, components []discordgo.MessageComponent) *discordgo.WebhookParams {
+	storePages(id, pagedOutput{
+		Embeds:     embeds,
+		Components: components,
+		Created:    time.Now(),
+	})
+
+	return &discordgo.WebhookParams{
+		Embeds:     embeds[:1],
+		Components: pageComponents(id, 0, len(embeds), components),
+	}
+}
+
+// storePages stores pages by an ID, removing expired pages.
+func storePages(id string, output pagedOutput) {
+	if redisClient != nil {
+		setShared("pages", id, output, pagesTTL)
+		return
+	}
+
+	pagedOutputsMu.Lock()
+	defer pagedOutputsMu.Unlock()
+
+	for k, p := range pagedOutputs {
+		if time.Since(p.Created) > pagesTTL {
+			delete(pagedOutputs, k)
+		}
+	}
+	pagedOutputs[id] = output
+}
+
+// getPages returns the pages of output stored by an ID, if they have not expired.
+func getPages(id string) (pagedOutput, bool) {
+	if redisClient != nil {
+		var p pagedOutput
+		return p, getShared("pages", id, &p)
+	}
+
+	pagedOutputsMu.Lock()
+	defer pagedOutputsMu.Unlock()
+
+	p, ok := pagedOutputs[id]
+	if !ok || time.Since(p.Created) > pagesTTL {
+		return pagedOutput{}, false
+	}
+
+	return p, true
+}
+
+// pageComponents returns the buttons to move to the previous and next pages,
+// with the current page between them, followed by other components.
+func pageComponents(id string, page int, total int, components []discordgo.MessageComponent) []discordgo.MessageComponent {
+	row := discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Emoji:    discordgo.ComponentEmoji{Name: "◀️"},
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("page:%v:%d", id, page-1),
+				Disabled: page == 0,
+			},
+			// Custom IDs must be unique in a message, even for disabled buttons.
+			discordgo.Button{
+				Label:    fmt.Sprintf("%d/%d", page+1, total),
+				Style:    discordgo.SecondaryButton,
+				CustomID: "page_indicator:" + id,
+				Disabled: true,
+			},
+			discordgo.Button{
+				Emoji:    discordgo.ComponentEmoji{Name: "▶️"},
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("page:%v:%d", id, page+1),
+				Disabled: page == total-1,
+			},
+		},
+	}
+
+	return append([]discordgo.MessageComponent{row}, components...)
+}
+
+// pageHandler shows another page of paginated output in place.
+func pageHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	// Custom IDs are of the form "page:<id>:<page>".
+	parts := strings.Split(i.MessageComponentData().CustomID, ":")
+	if len(parts) != 3 {
+		return
+	}
+	id := parts[1]
+
+	p, ok := getPages(id)
+	if !ok {
+		respondEphemeral(s, i, "This output has expired and can no longer be navigated.")
+		return
+	}
+
+	page, err := strconv.Atoi(parts[2])
+	if err != nil || page < 0 || page >= p.count() {
+		return
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Components: pageComponents(id, page, p.count(), p.Components),
+	}
+	if len(p.Embeds) > 0 {
+		data.Embeds = p.Embeds[page : page+1]
+	} else {
+		data.Content = p.Pages[page]
+	}
+
+	err = s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: data,
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
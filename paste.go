@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Length of paste IDs, which are random letters and digits.
+const pasteIDLength = 8
+
+const pasteIDAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Matches a paste ID, or the end of a link to a paste.
+var pasteIDRegex = regexp.MustCompile(`(?:^|/p/)([a-zA-Z0-9]{8})$`)
+
+// PasteStore stores text too long for a message as files, and serves them
+// over HTTP so they can be shared with a link.
+type PasteStore struct {
+	Dir       string
+	URL       string        // public URL of the HTTP server
+	Retention time.Duration // how long pastes are kept; 0 keeps them forever
+}
+
+func NewPasteStore(dir string, url string, retention time.Duration) (*PasteStore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasteStore{
+		Dir:       dir,
+		URL:       strings.TrimRight(url, "/"),
+		Retention: retention,
+	}, nil
+}
+
+// Add stores text and returns the ID of the paste.
+func (p *PasteStore) Add(content string) (string, error) {
+	id := make([]byte, pasteIDLength)
+	for n := range id {
+		k, err := rand.Int(rand.Reader, big.NewInt(int64(len(pasteIDAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		id[n] = pasteIDAlphabet[k.Int64()]
+	}
+
+	err := os.WriteFile(p.path(string(id)), []byte(content), 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	return string(id), nil
+}
+
+// Get returns the text of a paste, if it exists and has not expired.
+func (p *PasteStore) Get(id string) (string, bool) {
+	if len(id) != pasteIDLength || !pasteIDRegex.MatchString(id) {
+		return "", false
+	}
+
+	info, err := os.Stat(p.path(id))
+	if err != nil || p.expired(info) {
+		return "", false
+	}
+
+	content, err := os.ReadFile(p.path(id))
+	if err != nil {
+		return "", false
+	}
+
+	return string(content), true
+}
+
+// Link returns the public link to a paste.
+func (p *PasteStore) Link(id string) string {
+	return p.URL + "/p/" + id
+}
+
+// Clean removes expired pastes.
+func (p *PasteStore) Clean() error {
+	entries, err := os.ReadDir(p.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !p.expired(info) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(p.Dir, e.Name()))
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("paste", e.Name()).
+				Msg("Error removing expired paste.")
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP serves pastes as plain text at /p/<id>.
+func (p *PasteStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	content, ok := p.Get(strings.TrimPrefix(r.URL.Path, "/p/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write([]byte(content))
+}
+
+func (p *PasteStore) path(id string) string {
+	return filepath.Join(p.Dir, id+".txt")
+}
+
+func (p *PasteStore) expired(info os.FileInfo) bool {
+	return p.Retention > 0 && time.Since(info.ModTime()) > p.Retention
+}
+
+// cleanPastes removes expired pastes on an interval.
+func cleanPastes(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			err := pastes.Clean()
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("Error removing expired pastes.")
+			}
+		}
+	}()
+}
+
+// attachLong prepares content too long for a message. If pastes are enabled,
+// it is pasted and a link to it is returned. Otherwise, or if it couldn't be
+// pasted, it is returned as a file to attach.
+func attachLong(name string, content string) (link string, files []*discordgo.File) {
+	if pastes != nil {
+		id, err := pastes.Add(content)
+		if err == nil {
+			return pastes.Link(id), nil
+		}
+
+		log.Error().
+			Err(err).
+			Msg("Error adding paste.")
+	}
+
+	return "", []*discordgo.File{
+		{
+			Name:        name,
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(content),
+		},
+	}
+}
+
+// Snippet command definition.
+var snippetCommand = &discordgo.ApplicationCommand{
+	Name:        "snippet",
+	Description: "Saves and runs your snippets of code, or shows text that was too long for a message.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "get",
+			Description: "Shows a paste of output or code.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "id",
+					Description: "The ID of or link to the paste.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "save",
+			Description: "Saves the latest code message, or the given message, to run again by name.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				snippetNameOption("The name to save the snippet as.", false),
+				{
+					Name:        "language",
+					Description: "The language of the code.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:        "message",
+					Description: "The link to or ID of the message to save, instead of the latest code message.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "run",
+			Description: "Runs one of your snippets.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				snippetNameOption("The name of the snippet.", true),
+			},
+		},
+		{
+			Name:        "list",
+			Description: "Lists your snippets.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+		{
+			Name:        "delete",
+			Description: "Deletes one of your snippets.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				snippetNameOption("The name of the snippet.", true),
+			},
+		},
+	},
+}
+
+func snippetHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	cmd := i.ApplicationCommandData().Options[0]
+	switch cmd.Name {
+	case "get":
+		snippetGetHandler(ctx, s, i, cmd)
+	case "save":
+		snippetSaveHandler(ctx, s, i)
+	case "run":
+		snippetRunHandler(ctx, s, i)
+	case "list":
+		snippetListHandler(ctx, s, i)
+	case "delete":
+		snippetDeleteHandler(ctx, s, i)
+	}
+}
+
+// snippetGetHandler shows the start of a paste, with a link to all of it.
+func snippetGetHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate, cmd *discordgo.ApplicationCommandInteractionDataOption) {
+	if pastes == nil {
+		respondEphemeral(s, i, "Pastes are not enabled on this bot.")
+		return
+	}
+
+	match := pasteIDRegex.FindStringSubmatch(strings.TrimSpace(cmd.Options[0].StringValue()))
+	if match == nil {
+		respondEphemeral(s, i, "That isn't a paste ID or link.")
+		return
+	}
+
+	content, ok := pastes.Get(match[1])
+	if !ok {
+		respondEphemeral(s, i, "That paste doesn't exist or has expired.")
+		return
+	}
+
+	w := NewResponseWriter(ctx, s, i)
+	w.Send(&discordgo.WebhookParams{
+		Content: fmt.Sprintf("%v\n%v", splitOutput(content, 1800)[0], pastes.Link(match[1])),
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Commands that components and modals belong to, so that using them needs
+// the same roles as the command.
+var componentCommands = map[string]string{
+	"run_again":        "run",
+	"confirm_language": "run",
+	"duel_submit":      "duel",
+	"duel_solution":    "duel",
+	"history_output":   "history",
+	"select_code":      "run",
+	"judge_cases":      "judge",
+	"challenge_create": "challenge",
+	"pad_run":          "pad",
+	"page":             "run",
+	"stdin":            "run",
+	"stdin_submit":     "run",
+	"run_link":         "Run Code",
+	"example_run":      "run",
+	"delete_output":    "run",
+}
+
+// Commands that can be used in direct messages, and whether they run code.
+// Commands that run code can only be used there if ALLOW_DM_EXECUTION is set.
+var dmCommands = map[string]bool{
+	"help":       false,
+	"build_info": false,
+	"history":    false,
+	"snippet":    false,
+	"prefs":      false,
+	"languages":  false,
+	"example":    false,
+	"Run Code":   true,
+	"run":        true,
+	"benchmark":  true,
+	"judge":      true,
+	"format":     true,
+	"lint":       true,
+	"asm":        true,
+	"diff":       true,
+}
+
+// Commands that find the code to run in earlier messages of the channel, so
+// the bot needs permission to read them.
+var historyCommands = map[string]bool{
+	"run":       true,
+	"benchmark": true,
+	"judge":     true,
+	"format":    true,
+	"lint":      true,
+	"asm":       true,
+	"diff":      true,
+}
+
+// Permissions the bot needs in a channel to post output, with their names.
+var outputPermissions = []struct {
+	Permission int64
+	Name       string
+}{
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+	{discordgo.PermissionAttachFiles, "Attach Files"},
+}
+
+// allowedInDMs checks if a command can be used in direct messages.
+func allowedInDMs(command string) bool {
+	runsCode, ok := dmCommands[command]
+	return ok && (!runsCode || dmExecutionAllowed())
+}
+
+// setDMPermissions sets which commands can be used in direct messages.
+func setDMPermissions(commands []*discordgo.ApplicationCommand) {
+	for _, c := range commands {
+		allowed := allowedInDMs(c.Name)
+		c.DMPermission = &allowed
+	}
+}
+
+// isCommand checks if a command with a name exists.
+func isCommand(name string) bool {
+	for _, c := range commands {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRequiredRole checks if the member of an interaction has one of the roles
+// a guild requires for a command. Admins and server managers can use every
+// command, so they can't lock themselves out.
+func hasRequiredRole(i *discordgo.InteractionCreate, command string) bool {
+	// Roles can't be required in direct messages.
+	if i.GuildID == "" {
+		return true
+	}
+	return canManageGuild(i) || memberHasRole(i.GuildID, i.Member, command)
+}
+
+// memberHasRole checks if a member has one of the roles a guild requires for a command.
+func memberHasRole(guildID string, member *discordgo.Member, command string) bool {
+	roles := guildConfigs.Get(guildID).CommandRoles[command]
+	if len(roles) == 0 {
+		return true
+	}
+
+	for _, role := range member.Roles {
+		if stringInSlice(role, roles) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRoles checks that the member of an interaction can use a command,
+// sending an ephemeral message if they can't.
+func checkRoles(s Discord, i *discordgo.InteractionCreate, command string) bool {
+	if hasRequiredRole(i, command) {
+		return true
+	}
+
+	roles := guildConfigs.Get(i.GuildID).CommandRoles[command]
+	respondEphemeral(s, i, fmt.Sprintf("You need one of these roles to use this command: %v", mentionRoles(roles)))
+
+	return false
+}
+
+// missingBotPermissions returns the names of the permissions the bot lacks in
+// the channel of an interaction to respond to it, publicly unless ephemeral.
+// Permissions don't apply in direct messages, and threads need permission to
+// send messages in threads instead.
+func missingBotPermissions(s Discord, i *discordgo.InteractionCreate, ephemeral bool) []string {
+	perms := i.AppPermissions
+	if i.GuildID == "" || perms&discordgo.PermissionAdministrator != 0 {
+		return nil
+	}
+	if perms&discordgo.PermissionSendMessagesInThreads != 0 && getThread(s, i.ChannelID) != nil {
+		perms |= discordgo.PermissionSendMessages
+	}
+
+	var missing []string
+	if i.Type == discordgo.InteractionApplicationCommand && historyCommands[interactionCommand(i)] && perms&discordgo.PermissionReadMessageHistory == 0 {
+		missing = append(missing, "Read Message History")
+	}
+	if !ephemeral {
+		for _, p := range outputPermissions {
+			if perms&p.Permission == 0 {
+				missing = append(missing, p.Name)
+			}
+		}
+	}
+	return missing
+}
+
+// checkBotPermissions checks that the bot has the permissions it needs in the
+// channel of an interaction, sending an ephemeral message naming the missing
+// ones if it doesn't.
+func checkBotPermissions(s Discord, i *discordgo.InteractionCreate, ephemeral bool) bool {
+	missing := missingBotPermissions(s, i, ephemeral)
+	if len(missing) == 0 {
+		return true
+	}
+
+	respondEphemeral(s, i, tr(i.Locale, "error.missing_permissions", strings.Join(missing, ", ")))
+	return false
+}
+
+// permissionsMiddleware checks that the user of an interaction can use the
+// command it belongs to, there and with their roles. Autocompletion is always
+// allowed.
+func permissionsMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+			next(ctx, s, i)
+			return
+		}
+
+		// Commands may still be registered for direct messages after
+		// ALLOW_DM_EXECUTION is turned off.
+		if i.GuildID == "" && !allowedInDMs(interactionCommand(i)) {
+			respondEphemeral(s, i, tr(i.Locale, "error.dm_disabled"))
+			return
+		}
+
+		if !checkRoles(s, i, interactionCommand(i)) {
+			return
+		}
+		next(ctx, s, i)
+	}
+}
+
+// describeRoles formats the roles required for commands for a message.
+func describeRoles(g GuildConfig) string {
+	if len(g.CommandRoles) == 0 {
+		return "**Roles**\nEveryone can use every command."
+	}
+
+	lines := make([]string, 0, len(g.CommandRoles))
+	for command, roles := range g.CommandRoles {
+		lines = append(lines, fmt.Sprintf("%v: %v", command, mentionRoles(roles)))
+	}
+	sort.Strings(lines)
+
+	return "**Roles**\n" + strings.Join(lines, "\n")
+}
+
+// mentionRoles formats role IDs as mentions.
+func mentionRoles(ids []string) string {
+	mentions := make([]string, len(ids))
+	for n, id := range ids {
+		mentions[n] = "<@&" + id + ">"
+	}
+	return strings.Join(mentions, ", ")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPermissionsMiddleware(t *testing.T) {
+	err := guildConfigs.Update("roles", func(g *GuildConfig) {
+		g.CommandRoles = map[string][]string{"run": {"runner"}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	member := func(permissions int64, roles ...string) *discordgo.Member {
+		return &discordgo.Member{
+			User:        &discordgo.User{ID: "user"},
+			Roles:       roles,
+			Permissions: permissions,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		interaction *discordgo.Interaction
+		allowed     bool
+	}{
+		{
+			name: "no roles required",
+			interaction: &discordgo.Interaction{
+				Type:    discordgo.InteractionApplicationCommand,
+				GuildID: "guild",
+				Member:  member(0),
+				Data:    discordgo.ApplicationCommandInteractionData{Name: "run"},
+			},
+			allowed: true,
+		},
+		{
+			name: "required role",
+			interaction: &discordgo.Interaction{
+				Type:    discordgo.InteractionApplicationCommand,
+				GuildID: "roles",
+				Member:  member(0, "runner"),
+				Data:    discordgo.ApplicationCommandInteractionData{Name: "run"},
+			},
+			allowed: true,
+		},
+		{
+			name: "missing role",
+			interaction: &discordgo.Interaction{
+				Type:    discordgo.InteractionApplicationCommand,
+				GuildID: "roles",
+				Member:  member(0, "other"),
+				Data:    discordgo.ApplicationCommandInteractionData{Name: "run"},
+			},
+			allowed: false,
+		},
+		{
+			name: "server manager without role",
+			interaction: &discordgo.Interaction{
+				Type:    discordgo.InteractionApplicationCommand,
+				GuildID: "roles",
+				Member:  member(discordgo.PermissionManageServer),
+				Data:    discordgo.ApplicationCommandInteractionData{Name: "run"},
+			},
+			allowed: true,
+		},
+		{
+			name: "command without required roles",
+			interaction: &discordgo.Interaction{
+				Type:    discordgo.InteractionApplicationCommand,
+				GuildID: "roles",
+				Member:  member(0),
+				Data:    discordgo.ApplicationCommandInteractionData{Name: "help"},
+			},
+			allowed: true,
+		},
+		{
+			name: "component of command missing role",
+			interaction: &discordgo.Interaction{
+				Type:    discordgo.InteractionMessageComponent,
+				GuildID: "roles",
+				Member:  member(0),
+				Data:    discordgo.MessageComponentInteractionData{CustomID: "run_again:1000"},
+			},
+			allowed: false,
+		},
+		{
+			name: "autocompletion missing role",
+			interaction: &discordgo.Interaction{
+				Type:    discordgo.InteractionApplicationCommandAutocomplete,
+				GuildID: "roles",
+				Member:  member(0),
+				Data:    discordgo.ApplicationCommandInteractionData{Name: "run"},
+			},
+			allowed: true,
+		},
+		{
+			name: "command in direct messages",
+			interaction: &discordgo.Interaction{
+				Type: discordgo.InteractionApplicationCommand,
+				User: &discordgo.User{ID: "user"},
+				Data: discordgo.ApplicationCommandInteractionData{Name: "run"},
+			},
+			allowed: true,
+		},
+		{
+			name: "guild-only command in direct messages",
+			interaction: &discordgo.Interaction{
+				Type: discordgo.InteractionApplicationCommand,
+				User: &discordgo.User{ID: "user"},
+				Data: discordgo.ApplicationCommandInteractionData{Name: "config"},
+			},
+			allowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeDiscord()
+			called := false
+			handler := permissionsMiddleware(func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+				called = true
+			})
+
+			handler(context.Background(), s, &discordgo.InteractionCreate{Interaction: tt.interaction})
+
+			if called != tt.allowed {
+				t.Errorf("expected the handler to be called: %v, was called: %v", tt.allowed, called)
+			}
+			if !tt.allowed && len(s.responses) != 1 {
+				t.Errorf("expected the user to be told, got %d responses", len(s.responses))
+			}
+		})
+	}
+}
+
+func TestPermissionsMiddlewareDMExecution(t *testing.T) {
+	ALLOW_DM_EXECUTION = false
+	defer func() { ALLOW_DM_EXECUTION = true }()
+
+	s := newFakeDiscord()
+	called := false
+	handler := permissionsMiddleware(func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		called = true
+	})
+
+	handler(context.Background(), s, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionApplicationCommand,
+		User: &discordgo.User{ID: "user"},
+		Data: discordgo.ApplicationCommandInteractionData{Name: "run"},
+	}})
+
+	if called {
+		t.Error("expected code not to be run in direct messages")
+	}
+	if contents := s.contents(); len(contents) != 1 || contents[0] != tr("", "error.dm_disabled") {
+		t.Errorf("expected %q, got %q", tr("", "error.dm_disabled"), contents)
+	}
+}
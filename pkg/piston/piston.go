@@ -0,0 +1,312 @@
+// Package piston is a client for the Piston code execution engine API.
+package piston
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Public Piston API endpoint.
+	DefaultBaseURL = "https://emkc.org/api/v2/piston/"
+
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 500 * time.Millisecond
+	DefaultMaxWait    = 30 * time.Second
+)
+
+// Kinds of errors running code, which errors returned by the client can be
+// checked for with errors.Is.
+var (
+	ErrUnreachable         = errors.New("the execution service can't be reached")
+	ErrRateLimited         = errors.New("the execution service is rate limiting requests")
+	ErrUnsupportedLanguage = errors.New("the language or version isn't installed")
+	ErrUnsupportedFeature  = errors.New("the execution service doesn't support this")
+	ErrTooLarge            = errors.New("the code or input is too large")
+	ErrTimeout             = errors.New("the execution service took too long to respond")
+)
+
+// APIError is an error response from Piston.
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // from the Retry-After header, if sent
+}
+
+// RateLimited checks if the request was rejected because of rate limiting.
+func (e *APIError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// Is reports the kind of error of the response, e.g. ErrRateLimited for a
+// 429 response.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.RateLimited()
+	case ErrUnreachable:
+		return e.StatusCode == http.StatusBadGateway || e.StatusCode == http.StatusServiceUnavailable
+	case ErrTimeout:
+		return e.StatusCode == http.StatusGatewayTimeout
+	case ErrTooLarge:
+		return e.StatusCode == http.StatusRequestEntityTooLarge
+	case ErrUnsupportedLanguage:
+		return strings.Contains(e.Message, "runtime is unknown")
+	}
+	return false
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("piston: %d %v", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("piston: %v", e.Message)
+}
+
+// RequestError is an error sending a request to Piston or reading its
+// response, of a kind like ErrUnreachable or ErrTimeout.
+type RequestError struct {
+	Kind error
+	Err  error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("piston: %v", e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports the kind of the error.
+func (e *RequestError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// requestError wraps an error sending a request with its kind, which is
+// ErrTimeout if the request took too long and ErrUnreachable otherwise,
+// unless the request was cancelled.
+func requestError(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &RequestError{Kind: ErrTimeout, Err: err}
+	}
+	return &RequestError{Kind: ErrUnreachable, Err: err}
+}
+
+// Client is a client for a Piston instance.
+type Client struct {
+	BaseURL    string // URL of the API, ending with a slash, e.g. https://emkc.org/api/v2/piston/
+	APIKey     string // sent in the Authorization header, if set
+	UserAgent  string
+	HTTPClient *http.Client
+
+	MaxRetries int           // number of retries of requests failing with 429 or 5xx
+	Backoff    time.Duration // delay before the first retry, doubled for every retry
+	MaxWait    time.Duration // longest Retry-After that is waited for before giving up
+}
+
+// RetryFunc is called before a request is retried, with the number of the
+// retry starting at 1 and how long the client waits before it.
+type RetryFunc func(retry int, wait time.Duration)
+
+type retryFuncKey struct{}
+
+// WithRetryFunc returns a context that calls fn before requests made with it
+// are retried, e.g. to tell users why their request is taking longer.
+func WithRetryFunc(ctx context.Context, fn RetryFunc) context.Context {
+	return context.WithValue(ctx, retryFuncKey{}, fn)
+}
+
+// New creates a client for the Piston instance at baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		MaxRetries: DefaultMaxRetries,
+		Backoff:    DefaultBackoff,
+		MaxWait:    DefaultMaxWait,
+	}
+}
+
+// Runtimes returns the installed runtimes.
+func (c *Client) Runtimes(ctx context.Context) ([]Runtime, error) {
+	var runtimes []Runtime
+	err := c.do(ctx, "GET", "runtimes", nil, &runtimes)
+	return runtimes, err
+}
+
+// Execute runs code.
+func (c *Client) Execute(ctx context.Context, req ExecuteRequest) (*ExecuteResponse, error) {
+	if len(req.Env) > 0 {
+		return nil, fmt.Errorf("piston can't set environment variables: %w", ErrUnsupportedFeature)
+	}
+	if len(req.Dependencies) > 0 {
+		return nil, fmt.Errorf("piston can't install dependencies: %w", ErrUnsupportedFeature)
+	}
+
+	start := time.Now()
+
+	var res ExecuteResponse
+	err := c.do(ctx, "POST", "execute", req, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Message != "" {
+		return nil, &APIError{
+			StatusCode: http.StatusOK,
+			Message:    res.Message,
+		}
+	}
+
+	res.Duration = time.Since(start)
+
+	return &res, nil
+}
+
+// Packages returns all packages available to the instance. Only available on self-hosted instances.
+func (c *Client) Packages(ctx context.Context) ([]Package, error) {
+	var packages []Package
+	err := c.do(ctx, "GET", "packages", nil, &packages)
+	return packages, err
+}
+
+// InstallPackage installs a package. Only available on self-hosted instances.
+func (c *Client) InstallPackage(ctx context.Context, language string, version string) error {
+	return c.do(ctx, "POST", "packages", PackageRequest{Language: language, Version: version}, &PackageResponse{})
+}
+
+// UninstallPackage removes a package. Only available on self-hosted instances.
+func (c *Client) UninstallPackage(ctx context.Context, language string, version string) error {
+	return c.do(ctx, "DELETE", "packages", PackageRequest{Language: language, Version: version}, &PackageResponse{})
+}
+
+// do sends a request to the API, retrying with backoff if Piston is rate
+// limiting or failing, and decodes the response into out. A Retry-After
+// longer than the backoff is respected, unless it is longer than MaxWait.
+func (c *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.request(ctx, method, path, body, out)
+
+		var apiErr *APIError
+		retryable := errors.As(err, &apiErr) &&
+			(apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500)
+		if !retryable || attempt >= c.MaxRetries {
+			return err
+		}
+
+		wait := backoff
+		if apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		if c.MaxWait > 0 && wait > c.MaxWait {
+			return err
+		}
+
+		if fn, ok := ctx.Value(retryFuncKey{}).(RetryFunc); ok {
+			fn(attempt+1, wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) request(ctx context.Context, method string, path string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", c.APIKey)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return requestError(err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return requestError(err)
+	}
+
+	// Errors are returned as {"message": "..."}.
+	if res.StatusCode >= 400 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &e)
+
+		return &APIError{
+			StatusCode: res.StatusCode,
+			Message:    e.Message,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date. Zero is returned if it is missing or invalid.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+
+	return 0
+}
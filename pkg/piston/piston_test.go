@@ -0,0 +1,335 @@
+package piston
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for a test server that answers every
+// request with handler, retrying without waiting.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := New(server.URL + "/")
+	c.Backoff = time.Millisecond
+	return c
+}
+
+// respond writes a JSON response.
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestExecute(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/execute" {
+			t.Errorf("expected POST /execute, got %v %v", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "secret" {
+			t.Errorf("expected the API key in the Authorization header, got %q", got)
+		}
+		if got := r.Header.Get("User-Agent"); got != "test" {
+			t.Errorf("expected the user agent test, got %q", got)
+		}
+
+		var req ExecuteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		respond(w, http.StatusOK, ExecuteResponse{
+			Language: req.Language,
+			Version:  req.Version,
+			Run:      ExecuteResults{Stdout: req.Files[0].Content, Output: req.Files[0].Content},
+		})
+	})
+	c.APIKey = "secret"
+	c.UserAgent = "test"
+
+	res, err := c.Execute(context.Background(), ExecuteRequest{
+		Language: "python",
+		Version:  "3.10.0",
+		Files:    []File{{Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Language != "python" || res.Version != "3.10.0" || res.Run.Stdout != "hi" {
+		t.Errorf("unexpected response %+v", res)
+	}
+}
+
+func TestExecuteWithoutAPIKey(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header["Authorization"]; ok {
+			t.Error("expected no Authorization header without an API key")
+		}
+		respond(w, http.StatusOK, []Runtime{})
+	})
+
+	if _, err := c.Runtimes(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var requests int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			respond(w, http.StatusServiceUnavailable, map[string]string{"message": "busy"})
+			return
+		}
+		respond(w, http.StatusOK, []Runtime{{Language: "python", Version: "3.10.0"}})
+	})
+
+	var retries []int
+	ctx := WithRetryFunc(context.Background(), func(retry int, wait time.Duration) {
+		retries = append(retries, retry)
+	})
+
+	runtimes, err := c.Runtimes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runtimes) != 1 {
+		t.Errorf("expected the runtimes of the last response, got %+v", runtimes)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	if len(retries) != 2 || retries[0] != 1 || retries[1] != 2 {
+		t.Errorf("expected retries 1 and 2, got %v", retries)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	var requests int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		respond(w, http.StatusBadGateway, nil)
+	})
+	c.MaxRetries = 2
+
+	_, err := c.Runtimes(context.Background())
+	if !errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected %v, got %v", ErrUnreachable, err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	var requests int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		respond(w, http.StatusBadRequest, map[string]string{"message": "bad request"})
+	})
+
+	_, err := c.Runtimes(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "bad request" {
+		t.Errorf("expected the error of the response, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		respond(w, http.StatusTooManyRequests, nil)
+	})
+
+	// The client waits for Retry-After rather than the backoff. The wait
+	// is cancelled instead of waited out.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wait time.Duration
+	ctx = WithRetryFunc(ctx, func(retry int, w time.Duration) {
+		wait = w
+		cancel()
+	})
+
+	_, err := c.Runtimes(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if wait != 2*time.Second {
+		t.Errorf("expected to wait 2s, got %v", wait)
+	}
+}
+
+func TestRetryAfterLongerThanMaxWait(t *testing.T) {
+	var requests int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "60")
+		respond(w, http.StatusTooManyRequests, nil)
+	})
+	c.MaxWait = time.Second
+
+	_, err := c.Runtimes(context.Background())
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected %v, got %v", ErrRateLimited, err)
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter != time.Minute {
+		t.Errorf("expected Retry-After of 1m, got %v", apiErr.RetryAfter)
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	c.HTTPClient.Timeout = 10 * time.Millisecond
+
+	_, err := c.Runtimes(context.Background())
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected %v, got %v", ErrTimeout, err)
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Runtimes(ctx)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected %v, got %v", ErrTimeout, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the error to wrap %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	c := New(server.URL + "/")
+	_, err := c.Runtimes(context.Background())
+	if !errors.Is(err, ErrUnreachable) {
+		t.Errorf("expected %v, got %v", ErrUnreachable, err)
+	}
+
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) {
+		t.Errorf("expected a *RequestError, got %T", err)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		kind    error
+	}{
+		{"rate limited", http.StatusTooManyRequests, "", ErrRateLimited},
+		{"bad gateway", http.StatusBadGateway, "", ErrUnreachable},
+		{"unavailable", http.StatusServiceUnavailable, "", ErrUnreachable},
+		{"gateway timeout", http.StatusGatewayTimeout, "", ErrTimeout},
+		{"too large", http.StatusRequestEntityTooLarge, "", ErrTooLarge},
+		{"unknown runtime", http.StatusBadRequest, "brainfudge-1.0.0 runtime is unknown", ErrUnsupportedLanguage},
+	}
+
+	kinds := []error{ErrRateLimited, ErrUnreachable, ErrTimeout, ErrTooLarge, ErrUnsupportedLanguage, ErrUnsupportedFeature}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				respond(w, tt.status, map[string]string{"message": tt.message})
+			})
+			c.MaxRetries = 0
+
+			_, err := c.Execute(context.Background(), ExecuteRequest{Language: "python", Files: []File{{Content: "hi"}}})
+			for _, kind := range kinds {
+				if got, want := errors.Is(err, kind), kind == tt.kind; got != want {
+					t.Errorf("errors.Is(%v, %q) = %v, expected %v", err, kind, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteMessage(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]string{"message": "python-9.9.9 runtime is unknown"})
+	})
+
+	_, err := c.Execute(context.Background(), ExecuteRequest{Language: "python", Version: "9.9.9"})
+	if !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedLanguage, err)
+	}
+}
+
+func TestExecuteUnsupportedFeature(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected no request to be sent")
+	})
+
+	requests := []ExecuteRequest{
+		{Language: "python", Env: map[string]string{"A": "1"}},
+		{Language: "python", Dependencies: []string{"requests"}},
+	}
+	for _, req := range requests {
+		_, err := c.Execute(context.Background(), req)
+		if !errors.Is(err, ErrUnsupportedFeature) {
+			t.Errorf("expected %v, got %v", ErrUnsupportedFeature, err)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"0", 0},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, expected %v", tt.header, got, tt.want)
+		}
+	}
+
+	// HTTP dates are rounded to seconds.
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%q) = %v, expected about 1h", date, got)
+	}
+}
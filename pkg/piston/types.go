@@ -0,0 +1,86 @@
+package piston
+
+import "time"
+
+// GET /api/v2/runtimes
+type Runtime struct {
+	Language string   `json:"language"`
+	Version  string   `json:"version"`
+	Aliases  []string `json:"aliases"`
+	Runtime  string   `json:"runtime,omitempty"` // runtime providing the language, e.g. node for javascript
+}
+
+// POST /api/v2/execute
+type ExecuteRequest struct {
+	Language           string            `json:"language"`                       // required, language of code
+	Version            string            `json:"version"`                        // required, language of version
+	Files              []File            `json:"files"`                          // required, files of code
+	Stdin              string            `json:"stdin"`                          // input to code
+	Args               []string          `json:"args"`                           // program arguments
+	Env                map[string]string `json:"-"`                              // environment variables; not supported by Piston
+	Dependencies       []string          `json:"-"`                              // packages to install before running; not supported by Piston
+	Install            bool              `json:"-"`                              // install dependencies listed in files, e.g. go.mod
+	InstallTimeout     int               `json:"-"`                              // max time for installing dependencies, in MS
+	CompileTimeout     int               `json:"compile_timeout,omitempty"`      // max time for compiling; default: 10000 MS
+	RunTimeout         int               `json:"run_timeout,omitempty"`          // max run time; default: 3000 MS
+	CompileMemoryLimit int               `json:"compile_memory_limit,omitempty"` // max memory for compile: -1
+	RunMemoryLimit     int               `json:"run_memory_limit,omitempty"`     // max memory for run; default: -1
+}
+
+type ExecuteResponse struct {
+	Language string          `json:"language"`
+	Version  string          `json:"version"`
+	Compile  *ExecuteResults `json:"compile"` // only present for compiled languages
+	Run      ExecuteResults  `json:"run"`
+	Message  string          `json:"message"` // means something bad happened...
+
+	Duration time.Duration `json:"-"` // time taken by the request to Piston
+	Cached   bool          `json:"-"` // the response was cached by the caller
+
+	ExecutionID string `json:"-"` // set by the caller to identify the run in its logs and messages
+}
+
+type ExecuteResults struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Output   string `json:"output"`
+	Code     int    `json:"code"`
+	Signal   string `json:"signal"`    // signal that killed the process, e.g. SIGKILL
+	Message  string `json:"message"`   // reason the process was stopped, if any
+	Status   string `json:"status"`    // TO: timed out, SG: killed by signal, RE: runtime error, XX: internal error
+	CPUTime  int    `json:"cpu_time"`  // MS
+	WallTime int    `json:"wall_time"` // MS
+	Memory   int    `json:"memory"`    // bytes
+}
+
+type File struct {
+	Name     string `json:"name,omitempty"`     // name of upload
+	Content  string `json:"content"`            // required, content of file
+	Encoding string `json:"encoding,omitempty"` // encoding used; default: utf8; options base64, hex
+}
+
+// RunTime returns how long the code ran for, as reported by Piston if possible.
+func (r *ExecuteResponse) RunTime() time.Duration {
+	if r.Run.WallTime > 0 {
+		return time.Duration(r.Run.WallTime) * time.Millisecond
+	}
+	return r.Duration
+}
+
+// GET /api/v2/packages
+type Package struct {
+	Language        string `json:"language"`
+	LanguageVersion string `json:"language_version"`
+	Installed       bool   `json:"installed"`
+}
+
+// POST/DELETE /api/v2/packages
+type PackageRequest struct {
+	Language string `json:"language"` // required, language of package
+	Version  string `json:"version"`  // required, version of package
+}
+
+type PackageResponse struct {
+	Language string `json:"language"`
+	Version  string `json:"version"`
+}
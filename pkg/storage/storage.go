@@ -0,0 +1,183 @@
+// Package storage persists the state of the bot in a SQLite database.
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the sqlite driver
+)
+
+// Migrations of the schema, applied in order. The version of a database is
+// the number of migrations applied to it, stored as its user_version.
+// Migrations must never be changed once released; add a new one instead.
+var migrations = []string{
+	// Documents are JSON values of a kind, e.g. the configuration of a guild.
+	`CREATE TABLE documents (
+		kind TEXT NOT NULL,
+		key  TEXT NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (kind, key)
+	)`,
+
+	// Executions are appended in order, and can share an ID when code is run
+	// again by the same interaction.
+	`CREATE TABLE executions (
+		seq      INTEGER PRIMARY KEY AUTOINCREMENT,
+		id       TEXT NOT NULL,
+		user_id  TEXT NOT NULL,
+		guild_id TEXT NOT NULL,
+		created  INTEGER NOT NULL,
+		data     BLOB NOT NULL
+	);
+	CREATE INDEX executions_user_id ON executions (user_id);
+	CREATE INDEX executions_guild_id ON executions (guild_id)`,
+}
+
+// DB is a SQLite database storing the state of the bot.
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the database at a path, creating it if it doesn't exist, and
+// migrates it to the latest schema.
+func Open(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows one writer at a time, so writes wait for each other
+	// instead of failing.
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("PRAGMA journal_mode = WAL; PRAGMA busy_timeout = 5000")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	d := &DB{db: db}
+	err = d.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Version returns the number of migrations applied to the database.
+func (d *DB) Version() (int, error) {
+	var version int
+	err := d.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// migrate applies the migrations that haven't been applied yet, each in its
+// own transaction.
+func (d *DB) migrate() error {
+	version, err := d.Version()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database version %d is newer than the latest known version %d", version, len(migrations))
+	}
+
+	for n := version; n < len(migrations); n++ {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(migrations[n])
+		if err == nil {
+			// PRAGMA doesn't accept parameters.
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", n+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", n+1, err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Documents returns every document of a kind, by key.
+func (d *DB) Documents(kind string) (map[string][]byte, error) {
+	rows, err := d.db.Query("SELECT key, data FROM documents WHERE kind = ?", kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := make(map[string][]byte)
+	for rows.Next() {
+		var key string
+		var data []byte
+		err := rows.Scan(&key, &data)
+		if err != nil {
+			return nil, err
+		}
+		documents[key] = data
+	}
+
+	return documents, rows.Err()
+}
+
+// PutDocument adds or replaces a document.
+func (d *DB) PutDocument(kind string, key string, data []byte) error {
+	_, err := d.db.Exec(
+		"INSERT INTO documents (kind, key, data) VALUES (?, ?, ?) ON CONFLICT (kind, key) DO UPDATE SET data = excluded.data",
+		kind, key, data,
+	)
+	return err
+}
+
+// DeleteDocument removes a document, if it exists.
+func (d *DB) DeleteDocument(kind string, key string) error {
+	_, err := d.db.Exec("DELETE FROM documents WHERE kind = ? AND key = ?", kind, key)
+	return err
+}
+
+// AddExecution appends an execution.
+func (d *DB) AddExecution(id string, userID string, guildID string, created time.Time, data []byte) error {
+	_, err := d.db.Exec(
+		"INSERT INTO executions (id, user_id, guild_id, created, data) VALUES (?, ?, ?, ?, ?)",
+		id, userID, guildID, created.UnixNano(), data,
+	)
+	return err
+}
+
+// Executions returns every execution, oldest first.
+func (d *DB) Executions() ([][]byte, error) {
+	rows, err := d.db.Query("SELECT data FROM executions ORDER BY seq")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var executions [][]byte
+	for rows.Next() {
+		var data []byte
+		err := rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, data)
+	}
+
+	return executions, rows.Err()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Longest prefix of text commands a guild can set.
+const maxPrefixLength = 5
+
+// prefixCommand returns the text command in a message starting with a
+// prefix, e.g. "run" for "!run" with the prefix "!", or an empty string if
+// the message doesn't start with the prefix.
+func prefixCommand(m *discordgo.Message, prefix string) string {
+	if prefix == "" || !strings.HasPrefix(m.Content, prefix) {
+		return ""
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(m.Content, prefix))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// prefixHandler runs the code in a message starting with the text command
+// prefix of the guild and "run", e.g. "!run", or the code message it replies
+// to, for communities that still use text commands.
+func prefixHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	defer recoverEvent("prefix command")
+
+	if m.Author == nil || m.Author.Bot || m.GuildID == "" || m.Member == nil {
+		return
+	}
+	if prefixCommand(m.Message, guildConfigs.Get(m.GuildID).Prefix) != "run" {
+		return
+	}
+
+	runRequestedMessage(s, m, "prefix")
+}
+
+// describePrefix formats the prefix of text commands for a message.
+func describePrefix(g GuildConfig) string {
+	if g.Prefix == "" {
+		return "**Text Commands**\nDisabled"
+	}
+	return "**Text Commands**\n`" + g.Prefix + "run`"
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// UserPrefs are the preferences of a user, used when a command doesn't say
+// otherwise.
+type UserPrefs struct {
+	Language    string `json:"language,omitempty"`     // used for code without a language
+	Version     string `json:"version,omitempty"`      // version of Language
+	OutputStyle string `json:"output_style,omitempty"` // overrides the output style of guilds
+}
+
+// PrefsStore stores the preferences of every user in a JSON file, or in the
+// database if there is one.
+type PrefsStore struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]*UserPrefs
+}
+
+// LoadPrefsStore loads the user preferences from a file, which is created
+// when preferences are first set.
+func LoadPrefsStore(path string) (*PrefsStore, error) {
+	p := &PrefsStore{
+		path:  path,
+		users: make(map[string]*UserPrefs),
+	}
+
+	if database != nil {
+		return p, loadDocuments(documentUserPrefs, path, &p.users)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &p.users)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Get returns a copy of the preferences of a user.
+func (p *PrefsStore) Get(userID string) UserPrefs {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if u, ok := p.users[userID]; ok {
+		return *u
+	}
+	return UserPrefs{}
+}
+
+// Update changes the preferences of a user and saves them to the file. Users
+// without preferences are removed.
+func (p *PrefsStore) Update(userID string, update func(u *UserPrefs)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	u, ok := p.users[userID]
+	if !ok {
+		u = &UserPrefs{}
+		p.users[userID] = u
+	}
+	update(u)
+	if *u == (UserPrefs{}) {
+		delete(p.users, userID)
+	}
+
+	if database != nil {
+		if u, ok := p.users[userID]; ok {
+			return saveDocument(documentUserPrefs, userID, u)
+		}
+		return database.DeleteDocument(documentUserPrefs, userID)
+	}
+
+	data, err := json.MarshalIndent(p.users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(p.path, data, 0o600)
+}
+
+// preferredLanguage returns the language a user prefers for code without a
+// language, with the preferred version if it is still supported.
+func preferredLanguage(userID string) (lang string, version string) {
+	u := userPrefs.Get(userID)
+	if u.Language == "" || !stringInSlice(u.Language, getLanguages()) {
+		return "", ""
+	}
+	if !stringInSlice(u.Version, getLanguageVersions(u.Language)) {
+		return u.Language, ""
+	}
+	return u.Language, u.Version
+}
+
+// outputStyle returns the output style of a user, or of the guild if the user
+// has none.
+func outputStyle(userID string, guildID string) string {
+	if style := userPrefs.Get(userID).OutputStyle; style != "" {
+		return style
+	}
+	return guildConfigs.Get(guildID).OutputStyle
+}
+
+// Prefs command definition.
+var prefsCommand = &discordgo.ApplicationCommand{
+	Name:        "prefs",
+	Description: "Sets your default language and output style.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "show",
+			Description: "Shows your preferences.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+		{
+			Name:        "set",
+			Description: "Sets your preferences. Options that aren't given are kept.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "language",
+					Description: "The language to run code in when it has none.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:         "version",
+					Description:  "The version of your language to use. Defaults to the latest version.",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+				{
+					Name:        "style",
+					Description: "An embed with a field for each output stream, or plain code blocks.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "embed", Value: OutputStyleEmbed},
+						{Name: "text", Value: OutputStyleText},
+					},
+				},
+			},
+		},
+		{
+			Name:        "reset",
+			Description: "Removes your preferences.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+	},
+}
+
+func prefsHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+
+	cmd := i.ApplicationCommandData().Options[0]
+	switch cmd.Name {
+	case "show":
+		respondEphemeral(s, i, describePrefs(userPrefs.Get(userID)))
+		return
+	case "set":
+		options := optionMap(cmd.Options)
+
+		current := userPrefs.Get(userID)
+		lang := current.Language
+		if option, ok := options["language"]; ok {
+			lang = resolveLanguage(option.StringValue())
+			if lang == "" {
+				respondEphemeral(s, i, tr(i.Locale, "error.language_unsupported", option.StringValue(), getLanguages()))
+				return
+			}
+		}
+
+		version := current.Version
+		if option, ok := options["version"]; ok {
+			version = option.StringValue()
+		} else if lang != current.Language {
+			version = ""
+		}
+		if version != "" && !stringInSlice(version, getLanguageVersions(lang)) {
+			respondEphemeral(s, i, tr(i.Locale, "error.version_unsupported", version, lang, getLanguageVersions(lang)))
+			return
+		}
+
+		err := userPrefs.Update(userID, func(u *UserPrefs) {
+			u.Language = lang
+			u.Version = version
+			if option, ok := options["style"]; ok {
+				u.OutputStyle = option.StringValue()
+			}
+		})
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("user_id", userID).
+				Msg("Error saving user preferences.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving preferences.```\n%v\n```", err))
+			return
+		}
+	case "reset":
+		err := userPrefs.Update(userID, func(u *UserPrefs) {
+			*u = UserPrefs{}
+		})
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("user_id", userID).
+				Msg("Error saving user preferences.")
+
+			respondEphemeral(s, i, fmt.Sprintf("Error saving preferences.```\n%v\n```", err))
+			return
+		}
+	}
+
+	respondEphemeral(s, i, "Updated your preferences.\n"+describePrefs(userPrefs.Get(userID)))
+}
+
+// describePrefs describes the preferences of a user.
+func describePrefs(u UserPrefs) string {
+	lang := "none"
+	if u.Language != "" {
+		lang = u.Language
+		if u.Version != "" {
+			lang += " " + u.Version
+		} else {
+			lang += " (latest version)"
+		}
+	}
+
+	style := "the server's"
+	if u.OutputStyle != "" {
+		style = u.OutputStyle
+	}
+
+	return strings.Join([]string{
+		"**Default language:** " + lang,
+		"**Output style:** " + style,
+	}, "\n")
+}
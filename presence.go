@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Statuses shown if STATUSES isn't set.
+var defaultStatuses = []string{"listening:/run"}
+
+// Activity types of statuses, by the prefix of their template.
+var statusActivities = map[string]discordgo.ActivityType{
+	"playing":   discordgo.ActivityTypeGame,
+	"listening": discordgo.ActivityTypeListening,
+	"watching":  discordgo.ActivityTypeWatching,
+	"competing": discordgo.ActivityTypeCompeting,
+}
+
+// Index of the status shown, which is the same on every shard.
+var (
+	statusMu   sync.Mutex
+	statusNext int
+)
+
+// parseStatus splits a status template, e.g. "watching:{servers} servers",
+// into its activity type and text. Templates without a known type are shown
+// as playing.
+func parseStatus(template string) (discordgo.ActivityType, string) {
+	if n := strings.Index(template, ":"); n >= 0 {
+		if t, ok := statusActivities[strings.ToLower(strings.TrimSpace(template[:n]))]; ok {
+			return t, strings.TrimSpace(template[n+1:])
+		}
+	}
+	return discordgo.ActivityTypeGame, strings.TrimSpace(template)
+}
+
+// executionsSince counts the executions in the history since a time.
+func executionsSince(since time.Time) int {
+	count := 0
+	for _, e := range history.All() {
+		if e.Created.After(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// renderStatus fills in the placeholders of a status template: {servers},
+// {languages}, {executions} and {executions_today}. Servers are counted on
+// the shards of this process.
+func renderStatus(template string) string {
+	servers := 0
+	for _, s := range shards {
+		if s.State != nil {
+			servers += len(s.State.Guilds)
+		}
+	}
+
+	replacements := []string{
+		"{servers}", strconv.Itoa(servers),
+		"{languages}", strconv.Itoa(len(getLanguages())),
+	}
+	if strings.Contains(template, "{executions") {
+		now := time.Now()
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		replacements = append(replacements,
+			"{executions_today}", strconv.Itoa(executionsSince(midnight)),
+			"{executions}", strconv.Itoa(len(history.All())),
+		)
+	}
+
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// updateStatus shows the next status of STATUSES on a shard, or the current
+// one if next is false.
+func updateStatus(s *discordgo.Session, next bool) {
+	statuses := STATUSES
+	if len(statuses) == 0 {
+		statuses = defaultStatuses
+	}
+
+	statusMu.Lock()
+	if next {
+		statusNext = (statusNext + 1) % len(statuses)
+	}
+	template := statuses[statusNext%len(statuses)]
+	statusMu.Unlock()
+
+	activity, text := parseStatus(template)
+	err := s.UpdateStatusComplex(discordgo.UpdateStatusData{
+		Activities: []*discordgo.Activity{
+			{
+				Name: truncate(renderStatus(text), 128),
+				Type: activity,
+			},
+		},
+		Status: string(discordgo.StatusOnline),
+	})
+
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Int("shard_id", s.ShardID).
+			Msg("Error updating status.")
+	}
+}
+
+// rotateStatuses shows the next status on every shard on an interval, which
+// also keeps the numbers in a single status up to date.
+func rotateStatuses(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			for n, s := range shards {
+				updateStatus(s, n == 0)
+			}
+		}
+	}()
+}
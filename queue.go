@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ExecQueue limits the number of executions running at the same time,
+// queueing the rest in the order they arrive.
+type ExecQueue struct {
+	mu sync.Mutex
+
+	slots   int
+	active  int
+	waiting []chan int
+}
+
+func NewExecQueue(slots int) *ExecQueue {
+	if slots < 1 {
+		slots = 1
+	}
+
+	return &ExecQueue{
+		slots: slots,
+	}
+}
+
+// Acquire blocks until an execution slot is available, or until ctx is
+// cancelled, in which case ctx.Err() is returned and the place in the queue
+// is given up. While waiting, onPosition is called with the (1-based)
+// position in the queue every time it changes. The returned release function
+// must be called once the execution is done.
+func (q *ExecQueue) Acquire(ctx context.Context, onPosition func(position int)) (release func(), err error) {
+	q.mu.Lock()
+
+	if q.active < q.slots && len(q.waiting) == 0 {
+		q.active++
+		q.mu.Unlock()
+		return q.releaseFunc(), nil
+	}
+
+	// Positions are sent on the channel, with 0 meaning a slot was handed over.
+	ch := make(chan int, 1)
+	q.waiting = append(q.waiting, ch)
+	position := len(q.waiting)
+	q.mu.Unlock()
+
+	for position > 0 {
+		if onPosition != nil {
+			onPosition(position)
+		}
+
+		select {
+		case position = <-ch:
+		case <-ctx.Done():
+			q.leave(ch)
+			return nil, ctx.Err()
+		}
+	}
+
+	return q.releaseFunc(), nil
+}
+
+// leave removes a waiting execution from the queue, and updates the
+// positions of the executions behind it. If it was handed a slot in the
+// meantime, the slot is released.
+func (q *ExecQueue) leave(ch chan int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for n, c := range q.waiting {
+		if c != ch {
+			continue
+		}
+
+		q.waiting = append(q.waiting[:n], q.waiting[n+1:]...)
+		for m := n; m < len(q.waiting); m++ {
+			sendPosition(q.waiting[m], m+1)
+		}
+		return
+	}
+
+	q.releaseSlot()
+}
+
+// Len returns the number of executions waiting in the queue.
+func (q *ExecQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.waiting)
+}
+
+func (q *ExecQueue) releaseFunc() func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(q.release)
+	}
+}
+
+func (q *ExecQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.releaseSlot()
+}
+
+// releaseSlot frees a running execution's slot, handing it over to the first
+// waiting execution. q.mu must be held.
+func (q *ExecQueue) releaseSlot() {
+	// Don't hand the slot over if the number of slots was reduced.
+	if len(q.waiting) == 0 || q.active > q.slots {
+		q.active--
+		return
+	}
+
+	q.handOver()
+}
+
+// handOver hands a slot over to the first waiting execution, and updates the
+// positions of the others.
+func (q *ExecQueue) handOver() {
+	for n, ch := range q.waiting {
+		sendPosition(ch, n)
+	}
+	q.waiting = q.waiting[1:]
+}
+
+// SetSlots changes the number of executions that can run at the same time.
+// If it is reduced, running executions finish before new ones are started.
+func (q *ExecQueue) SetSlots(slots int) {
+	if slots < 1 {
+		slots = 1
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.slots = slots
+	for q.active < q.slots && len(q.waiting) > 0 {
+		q.active++
+		q.handOver()
+	}
+}
+
+// sendPosition sends a position, replacing any position not yet read.
+func sendPosition(ch chan int, position int) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- position
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecQueueAcquireCancelled(t *testing.T) {
+	q := NewExecQueue(1)
+
+	release, err := q.Acquire(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first waiting execution gives up its place.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, err := q.Acquire(ctx, nil)
+		cancelled <- err
+	}()
+	waitForQueue(t, q, 1)
+
+	// The second one moves up once it does.
+	positions := make(chan int, 2)
+	acquired := make(chan func())
+	go func() {
+		release, err := q.Acquire(context.Background(), func(position int) {
+			positions <- position
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+	waitForQueue(t, q, 2)
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if position := <-positions; position != 2 {
+		t.Errorf("expected to wait in position 2, got %d", position)
+	}
+	if position := <-positions; position != 1 {
+		t.Errorf("expected to move up to position 1, got %d", position)
+	}
+
+	release()
+	(<-acquired)()
+
+	if n := q.Len(); n != 0 {
+		t.Errorf("expected an empty queue, got %d waiting", n)
+	}
+}
+
+func TestExecQueueAcquireExpired(t *testing.T) {
+	q := NewExecQueue(1)
+
+	release, err := q.Acquire(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = q.Acquire(ctx, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+// waitForQueue waits until n executions are waiting in a queue.
+func waitForQueue(t *testing.T, q *ExecQueue, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for q.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d waiting executions, got %d", n, q.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// How long a guild's count of running executions is kept in Redis after it
+// last changed, so executions of a replica that stopped don't count forever.
+const sharedActiveTTL = 10 * time.Minute
+
+// RateLimiter enforces per-user cooldowns and per-guild concurrent execution
+// limits. The limits are shared between replicas in Redis if it is used.
+type RateLimiter struct {
+	mu sync.Mutex
+
+	UserCooldown     time.Duration // minimum time between executions of a user
+	GuildConcurrency int           // maximum concurrent executions in a guild; 0 for unlimited
+
+	lastRun     map[string]time.Time
+	guildActive map[string]int
+}
+
+func NewRateLimiter(userCooldown time.Duration, guildConcurrency int) *RateLimiter {
+	return &RateLimiter{
+		UserCooldown:     userCooldown,
+		GuildConcurrency: guildConcurrency,
+		lastRun:          make(map[string]time.Time),
+		guildActive:      make(map[string]int),
+	}
+}
+
+// Acquire reserves an execution for a user in a guild. If the user is on
+// cooldown, the remaining cooldown is returned. If the guild has too many
+// executions running, ok is false with a zero wait. The returned release
+// function must be called once the execution is done.
+func (r *RateLimiter) Acquire(userID string, guildID string) (release func(), wait time.Duration, ok bool) {
+	if redisClient != nil {
+		release, wait, ok, err := r.acquireShared(userID, guildID)
+		if err == nil {
+			return release, wait, ok
+		}
+
+		log.Error().
+			Err(err).
+			Msg("Error acquiring shared rate limit, using the local rate limit.")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	// Remove expired cooldowns.
+	for id, t := range r.lastRun {
+		if now.Sub(t) >= r.UserCooldown {
+			delete(r.lastRun, id)
+		}
+	}
+
+	if t, found := r.lastRun[userID]; found {
+		return nil, r.UserCooldown - now.Sub(t), false
+	}
+
+	if r.GuildConcurrency > 0 && r.guildActive[guildID] >= r.GuildConcurrency {
+		return nil, 0, false
+	}
+
+	r.lastRun[userID] = now
+	r.guildActive[guildID]++
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.guildActive[guildID]--
+			if r.guildActive[guildID] <= 0 {
+				delete(r.guildActive, guildID)
+			}
+		})
+	}
+
+	return release, 0, true
+}
+
+// acquireShared is like Acquire, but for the rate limits shared between
+// replicas in Redis.
+func (r *RateLimiter) acquireShared(userID string, guildID string) (release func(), wait time.Duration, ok bool, err error) {
+	r.mu.Lock()
+	cooldown, concurrency := r.UserCooldown, r.GuildConcurrency
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	cooldownKey := redisKey("cooldown", userID)
+	if cooldown > 0 {
+		set, err := redisClient.SetNX(ctx, cooldownKey, 1, cooldown).Result()
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if !set {
+			wait, err := redisClient.PTTL(ctx, cooldownKey).Result()
+			return nil, wait, false, err
+		}
+	}
+
+	activeKey := redisKey("active", guildID)
+	active, err := redisClient.Incr(ctx, activeKey).Result()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	redisClient.Expire(ctx, activeKey, sharedActiveTTL)
+
+	if concurrency > 0 && active > int64(concurrency) {
+		redisClient.Decr(ctx, activeKey)
+		redisClient.Del(ctx, cooldownKey)
+		return nil, 0, false, nil
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+			defer cancel()
+
+			err := redisClient.Decr(ctx, activeKey).Err()
+			if err != nil {
+				log.Error().
+					Err(err).
+					Str("guild_id", guildID).
+					Msg("Error releasing shared rate limit.")
+			}
+		})
+	}
+
+	return release, 0, true, nil
+}
+
+// SetLimits changes the user cooldown and guild concurrency limit.
+func (r *RateLimiter) SetLimits(userCooldown time.Duration, guildConcurrency int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.UserCooldown = userCooldown
+	r.GuildConcurrency = guildConcurrency
+}
+
+// acquireRun reserves an execution for the user of the interaction. If code
+// can't be run in the channel or the user is throttled, an ephemeral message
+// is sent and ok is false.
+func acquireRun(s Discord, i *discordgo.InteractionCreate) (release func(), ok bool) {
+	if !checkChannel(s, i) {
+		return nil, false
+	}
+
+	release, content, ok := reserveRun(i)
+	if !ok {
+		respondEphemeral(s, i, content)
+	}
+	return release, ok
+}
+
+// acquireDeferredRun is like acquireRun for handlers that have already
+// checked the channel and deferred their response, replacing the response
+// with the message if the user is throttled.
+func acquireDeferredRun(w *ResponseWriter) (release func(), ok bool) {
+	release, content, ok := reserveRun(w.Interaction)
+	if !ok {
+		w.Error(content)
+	}
+	return release, ok
+}
+
+// reserveRun reserves an execution for the user of the interaction. If the
+// user is throttled, ok is false and content tells them why.
+func reserveRun(i *discordgo.InteractionCreate) (release func(), content string, ok bool) {
+	// Executions in direct messages are limited per user instead of per guild.
+	guildID := i.GuildID
+	if guildID == "" {
+		guildID = "@" + interactionUser(i).ID
+	}
+
+	release, wait, ok := rateLimiter.Acquire(interactionUser(i).ID, guildID)
+	if ok {
+		return release, "", true
+	}
+
+	if wait > 0 {
+		content = tr(i.Locale, "error.slow_down", wait.Round(time.Second/10))
+	} else {
+		content = tr(i.Locale, "error.server_busy")
+	}
+
+	log.Debug().
+		Str("user_id", interactionUser(i).ID).
+		Str("guild_id", guildID).
+		Dur("wait", wait).
+		Msg("Execution throttled.")
+
+	return nil, content, false
+}
+
+// rateLimitMiddleware reserves an execution with acquireRun for the commands
+// and components the dispatcher rate limits, until they have been handled.
+func (d *Dispatcher) rateLimitMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		runsCode := i.Type == discordgo.InteractionApplicationCommand || i.Type == discordgo.InteractionMessageComponent
+		if !runsCode || !d.RateLimited[interactionName(i)] {
+			next(ctx, s, i)
+			return
+		}
+
+		release, ok := acquireRun(s, i)
+		if !ok {
+			return
+		}
+		defer release()
+
+		next(ctx, s, i)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	defer func(r *RateLimiter) { rateLimiter = r }(rateLimiter)
+	rateLimiter = NewRateLimiter(time.Minute, 100)
+
+	d := &Dispatcher{RateLimited: map[string]bool{"format": true}}
+
+	tests := []struct {
+		name    string
+		command string
+		calls   int
+	}{
+		{"rate limited", "format", 1},
+		{"not rate limited", "help", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := d.rateLimitMiddleware(func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+				calls++
+			})
+
+			s := newFakeDiscord()
+			for n := 0; n < 2; n++ {
+				i := newCommand(tt.command)
+				i.Member.User.ID = "user " + tt.name
+				handler(context.Background(), s, i)
+			}
+
+			if calls != tt.calls {
+				t.Errorf("expected the handler to be called %d times, was called %d times", tt.calls, calls)
+			}
+			if tt.calls == 1 && len(s.responses) != 1 {
+				t.Errorf("expected the user to be told to slow down, got %d responses", len(s.responses))
+			}
+		})
+	}
+}
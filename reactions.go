@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// reactionHandler runs a code message when a user reacts to it with RUN_EMOJI,
+// replying with the output.
+func reactionHandler(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	defer recoverEvent("reaction add")
+
+	runEmoji := getRunEmoji()
+	if runEmoji == "" || r.Emoji.Name != runEmoji || r.Member == nil || r.Member.User == nil || r.Member.User.Bot {
+		return
+	}
+
+	if !shutdown.Begin() {
+		return
+	}
+	defer shutdown.Done()
+
+	// Check that the user is allowed to run code here.
+	if !guildConfigs.Get(r.GuildID).ChannelAllowed(r.ChannelID, threadParent(s, r.ChannelID)) {
+		return
+	}
+	if !isAdmin(r.UserID) && !memberHasRole(r.GuildID, r.Member, "Run Code") {
+		return
+	}
+
+	message, err := s.ChannelMessage(r.ChannelID, r.MessageID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("message_id", r.MessageID).
+			Msg("Error getting message.")
+		return
+	}
+
+	if !isCodeMessage(message) {
+		return
+	}
+
+	runCodeMessage(s, message, r.UserID, r.GuildID, "reaction")
+}
+
+// runCodeMessage runs a code message for a user, replying to it with the
+// output. The source, e.g. "reaction", is counted in the metrics.
+func runCodeMessage(s *discordgo.Session, message *discordgo.Message, userID string, guildID string, source string) {
+	release, wait, ok := rateLimiter.Acquire(userID, guildID)
+	if !ok {
+		log.Debug().
+			Str("user_id", userID).
+			Str("guild_id", guildID).
+			Dur("wait", wait).
+			Msg("Execution throttled.")
+		return
+	}
+	defer release()
+
+	commandsReceived.WithLabelValues(source, strconv.Itoa(s.ShardID)).Inc()
+
+	log.Debug().
+		Str("message_id", message.ID).
+		Str("user_id", userID).
+		Str("channel_id", message.ChannelID).
+		Str("guild_id", guildID).
+		Str("source", source).
+		Msg("Run of code message recieved.")
+
+	limits := guildLimits(guildID)
+	lang, files := getLanguageAndFilesFromMessage(message, guildID)
+	version := ""
+	if lang == "" {
+		lang, version = preferredLanguage(userID)
+	}
+	if lang == "" {
+		if params := languageSuggestion(message.ID, files, limits); params != nil {
+			replyWith(s, message, params)
+			return
+		}
+
+		replyWith(s, message, &discordgo.WebhookParams{
+			Content: "No language provided. Did you remember to put a valid language after the opening backticks? (e.g. ```py) You can also set a default language with `/prefs set`.",
+		})
+		return
+	}
+
+	if checkBlocked(s, guildID, message.ChannelID, userID, files) {
+		replyWith(s, message, &discordgo.WebhookParams{
+			Content: tr("", "error.blocked"),
+		})
+		return
+	}
+
+	files = applyTemplate(lang, files)
+
+	// Show that the bot is working on it.
+	err := s.ChannelTyping(message.ChannelID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending typing indicator.")
+	}
+
+	var result *piston.ExecuteResponse
+	releaseSlot, err := execQueue.Acquire(context.Background(), nil)
+	if err == nil {
+		result, err = Execute(context.Background(), ExecRequest{
+			Language: lang,
+			Version:  version,
+			Files:    files,
+			Limits:   limits,
+		})
+		releaseSlot()
+	}
+	recordExecution(message.ID, userID, guildID, lang, version, files, result, err)
+	auditExecution(s, message.ChannelID, userID, guildID, executionID(result, err), lang, files, executionStatus(result, err))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+
+		replyWith(s, message, &discordgo.WebhookParams{
+			Content: execErrorMessage("code", err),
+		})
+		return
+	}
+
+	// Store the code so that it can be run again from the button.
+	storeRun(message.ID, storedRun{
+		Language: lang,
+		Version:  version,
+		Files:    files,
+		Limits:   limits,
+	})
+
+	collapse := outputCollapse(guildID, "")
+	messages := renderOutput(result, message.ID, userID, guildID, limits, collapse == OutputCollapseSpoiler)
+
+	// Post the output in a thread off the code message if the guild collapses
+	// output into threads.
+	if collapse == OutputCollapseThread && postInThread(s, message.ChannelID, message.ID, outputThreadName(lang), messages) {
+		return
+	}
+
+	var sent []string
+	for _, params := range messages {
+		if m := replyWith(s, message, params); m != nil {
+			sent = append(sent, m.ID)
+		}
+	}
+	scheduleCleanup(s, guildID, message.ChannelID, sent)
+}
+
+// replyWith sends a message as a reply to another message, returning it, or
+// nil if it couldn't be sent.
+func replyWith(s *discordgo.Session, m *discordgo.Message, params *discordgo.WebhookParams) *discordgo.Message {
+	reply, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:         params.Content,
+		Embeds:          params.Embeds,
+		Components:      params.Components,
+		Files:           params.Files,
+		Reference:       m.Reference(),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending message.")
+		return nil
+	}
+
+	return reply
+}
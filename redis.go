@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// Redis client sharing state between replicas of the bot, or nil if the
+// state is only kept in memory.
+var redisClient *redis.Client
+
+// Prefix of the keys of the bot in Redis.
+const redisPrefix = "crb:"
+
+// Maximum time for a Redis command.
+const redisTimeout = 5 * time.Second
+
+// connectRedis connects to the Redis server at a URL, e.g.
+// redis://:password@localhost:6379/0.
+func connectRedis(url string) (*redis.Client, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	err = client.Ping(ctx).Err()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// redisKey returns the key of a value of a kind in Redis.
+func redisKey(kind string, id string) string {
+	return redisPrefix + kind + ":" + id
+}
+
+// setShared stores a value shared between replicas, which expires after ttl.
+func setShared(kind string, id string, v interface{}, ttl time.Duration) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		defer cancel()
+
+		err = redisClient.Set(ctx, redisKey(kind, id), data, ttl).Err()
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("kind", kind).
+			Str("id", id).
+			Msg("Error storing shared state.")
+	}
+}
+
+// getShared loads a value shared between replicas into v, returning false if
+// it doesn't exist or has expired.
+func getShared(kind string, id string, v interface{}) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	data, err := redisClient.Get(ctx, redisKey(kind, id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false
+	}
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("kind", kind).
+			Str("id", id).
+			Msg("Error loading shared state.")
+		return false
+	}
+
+	return true
+}
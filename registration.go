@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// GUILD_ID value that registers the commands in every guild the bot is in.
+const allGuilds = "*"
+
+// registration is the commands created in a guild, or globally.
+type registration struct {
+	Commands    []*discordgo.ApplicationCommand
+	Definitions []byte // to tell if the commands have changed
+}
+
+var (
+	registrationsMu sync.Mutex
+	// Commands created by guild ID, with an empty ID for global commands.
+	registrations = make(map[string]registration)
+)
+
+// parseGuildIDs parses a comma-separated list of guild IDs.
+func parseGuildIDs(v string) []string {
+	var ids []string
+	for _, id := range strings.Split(v, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// commandGuilds returns the guilds this process creates commands in, with an
+// empty ID for global commands. Each guild is handled by the process running
+// its shard.
+func commandGuilds() []string {
+	guildIDs := getGuildIDs()
+
+	var ids []string
+	switch {
+	case len(guildIDs) == 0:
+		ids = []string{""}
+	case stringInSlice(allGuilds, guildIDs):
+		for _, s := range shards {
+			for _, g := range s.State.Guilds {
+				ids = append(ids, g.ID)
+			}
+		}
+	default:
+		ids = guildIDs
+	}
+
+	owned := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if ownsGuild(id) {
+			owned = append(owned, id)
+		}
+	}
+	return owned
+}
+
+// registersInGuild checks if commands are created in a guild when the bot
+// joins it.
+func registersInGuild(guildID string) bool {
+	guildIDs := getGuildIDs()
+	return stringInSlice(allGuilds, guildIDs) || stringInSlice(guildID, guildIDs)
+}
+
+// registerCommands creates all commands in every guild of GUILD_ID, or
+// globally, unless they were already created there with the same
+// definitions. Commands created in other guilds before are deleted. It
+// returns whether any commands were created.
+func registerCommands(s *discordgo.Session) (bool, error) {
+	registrationsMu.Lock()
+	defer registrationsMu.Unlock()
+
+	definitions, err := commandDefinitions()
+	if err != nil {
+		return false, err
+	}
+
+	guildIDs := commandGuilds()
+	for guildID := range registrations {
+		if !stringInSlice(guildID, guildIDs) {
+			deleteCommands(s, guildID)
+		}
+	}
+
+	created := false
+	for _, guildID := range guildIDs {
+		ok, err := createCommands(s, guildID, definitions)
+		if err != nil {
+			return created, err
+		}
+		created = created || ok
+	}
+
+	return created, nil
+}
+
+// unregisterCommands deletes the commands created by registerCommands, unless
+// DELETE_COMMANDS_ON_SHUTDOWN is false.
+func unregisterCommands(s *discordgo.Session) {
+	if !DELETE_COMMANDS_ON_SHUTDOWN {
+		return
+	}
+
+	registrationsMu.Lock()
+	defer registrationsMu.Unlock()
+
+	for guildID := range registrations {
+		deleteCommands(s, guildID)
+	}
+}
+
+// commandDefinitions prepares the commands to be created and returns their
+// definitions.
+func commandDefinitions() ([]byte, error) {
+	// Create all commands, with their descriptions in every locale.
+	localizeCommands(commands)
+	setDMPermissions(commands)
+	return json.Marshal(commands)
+}
+
+// createCommands makes the commands in a guild match the definitions,
+// unless they were already created with the same definitions. Only the
+// commands that are new, changed or removed are created, edited or deleted,
+// as Discord takes time to update commands. It returns whether any were.
+func createCommands(s *discordgo.Session, guildID string, definitions []byte) (bool, error) {
+	if r, ok := registrations[guildID]; ok && string(r.Definitions) == string(definitions) {
+		return false, nil
+	}
+
+	existing, err := s.ApplicationCommands(s.State.User.ID, guildID)
+	if err != nil {
+		return false, err
+	}
+	byName := make(map[string]*discordgo.ApplicationCommand, len(existing))
+	for _, cmd := range existing {
+		byName[commandKey(cmd)] = cmd
+	}
+
+	var created, edited, deleted int
+	current := make([]*discordgo.ApplicationCommand, 0, len(commands))
+	for _, cmd := range commands {
+		old, ok := byName[commandKey(cmd)]
+		delete(byName, commandKey(cmd))
+
+		switch {
+		case !ok:
+			old, err = s.ApplicationCommandCreate(s.State.User.ID, guildID, cmd)
+			created++
+		case commandChanged(cmd, old):
+			old, err = s.ApplicationCommandEdit(s.State.User.ID, guildID, old.ID, cmd)
+			edited++
+		}
+		if err != nil {
+			return false, fmt.Errorf("command %v: %w", cmd.Name, err)
+		}
+
+		current = append(current, old)
+	}
+
+	// Commands that were removed.
+	for _, cmd := range byName {
+		err = s.ApplicationCommandDelete(s.State.User.ID, guildID, cmd.ID)
+		if err != nil {
+			return false, fmt.Errorf("command %v: %w", cmd.Name, err)
+		}
+		deleted++
+	}
+
+	registrations[guildID] = registration{
+		Commands:    current,
+		Definitions: definitions,
+	}
+
+	log.Info().
+		Str("guild_id", guildID).
+		Int("created", created).
+		Int("edited", edited).
+		Int("deleted", deleted).
+		Int("unchanged", len(commands)-created-edited).
+		Msg("Commands synchronized.")
+
+	return created+edited+deleted > 0, nil
+}
+
+// commandKey identifies a command. Commands of different types can have the
+// same name.
+func commandKey(cmd *discordgo.ApplicationCommand) string {
+	return fmt.Sprintf("%d:%v", commandType(cmd), cmd.Name)
+}
+
+func commandType(cmd *discordgo.ApplicationCommand) discordgo.ApplicationCommandType {
+	if cmd.Type == 0 {
+		return discordgo.ChatApplicationCommand
+	}
+	return cmd.Type
+}
+
+// commandChanged checks if a command created in Discord differs from its
+// definition, ignoring the fields set by Discord.
+func commandChanged(want *discordgo.ApplicationCommand, have *discordgo.ApplicationCommand) bool {
+	return commandDefinition(want) != commandDefinition(have)
+}
+
+// commandDefinition returns the fields of a command that are defined by the
+// bot, with the defaults Discord fills in.
+func commandDefinition(cmd *discordgo.ApplicationCommand) string {
+	dmPermission := true
+	if cmd.DMPermission != nil {
+		dmPermission = *cmd.DMPermission
+	}
+
+	data, _ := json.Marshal(struct {
+		Type                     discordgo.ApplicationCommandType
+		Name                     string
+		NameLocalizations        map[discordgo.Locale]string
+		Description              string
+		DescriptionLocalizations map[discordgo.Locale]string
+		DefaultMemberPermissions *int64
+		DMPermission             bool
+		Options                  []*discordgo.ApplicationCommandOption
+	}{
+		Type:                     commandType(cmd),
+		Name:                     cmd.Name,
+		NameLocalizations:        localizationsOrNil(cmd.NameLocalizations),
+		Description:              cmd.Description,
+		DescriptionLocalizations: localizationsOrNil(cmd.DescriptionLocalizations),
+		DefaultMemberPermissions: cmd.DefaultMemberPermissions,
+		DMPermission:             dmPermission,
+		Options:                  cmd.Options,
+	})
+	return string(data)
+}
+
+// localizationsOrNil treats empty localizations the same as none.
+func localizationsOrNil(l *map[discordgo.Locale]string) map[discordgo.Locale]string {
+	if l == nil || len(*l) == 0 {
+		return nil
+	}
+	return *l
+}
+
+// deleteCommands deletes the commands created in a guild.
+func deleteCommands(s *discordgo.Session, guildID string) {
+	for _, cmd := range registrations[guildID].Commands {
+		err := s.ApplicationCommandDelete(s.State.User.ID, guildID, cmd.ID)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("command", cmd.Name).
+				Str("guild_id", guildID).
+				Msg("Error deleting command.")
+		}
+	}
+
+	delete(registrations, guildID)
+}
+
+// guildCreateHandler creates the commands in guilds the bot joins, or that
+// become available when it connects.
+func guildCreateHandler(s *discordgo.Session, g *discordgo.GuildCreate) {
+	defer recoverEvent("guild create")
+
+	if !registersInGuild(g.ID) {
+		return
+	}
+
+	registrationsMu.Lock()
+	defer registrationsMu.Unlock()
+
+	definitions, err := commandDefinitions()
+	if err == nil {
+		_, err = createCommands(s, g.ID, definitions)
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("guild_id", g.ID).
+			Msg("Error creating commands.")
+	}
+}
+
+// guildDeleteHandler forgets the commands of guilds the bot leaves. Discord
+// deletes them, so they don't need to be deleted.
+func guildDeleteHandler(s *discordgo.Session, g *discordgo.GuildDelete) {
+	defer recoverEvent("guild delete")
+
+	// Guilds become unavailable during outages, which doesn't remove the bot.
+	if g.Unavailable {
+		return
+	}
+
+	registrationsMu.Lock()
+	defer registrationsMu.Unlock()
+
+	delete(registrations, g.ID)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// settingsMu guards the settings reloadConfig changes while the bot is
+// running. Outside of loadConfig and reloadConfig, they are read with the
+// functions below, or with settingsMu held.
+var settingsMu sync.RWMutex
+
+// dmExecutionAllowed returns ALLOW_DM_EXECUTION.
+func dmExecutionAllowed() bool {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return ALLOW_DM_EXECUTION
+}
+
+// getGuildIDs returns GUILD_IDS.
+func getGuildIDs() []string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return GUILD_IDS
+}
+
+// getRunEmoji returns RUN_EMOJI.
+func getRunEmoji() string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return RUN_EMOJI
+}
+
+// getScanDepth returns SCAN_DEPTH.
+func getScanDepth() int {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return SCAN_DEPTH
+}
+
+// getOutputFileThreshold returns OUTPUT_FILE_THRESHOLD.
+func getOutputFileThreshold() int {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return OUTPUT_FILE_THRESHOLD
+}
+
+// getBenchmarkMaxRuns returns BENCHMARK_MAX_RUNS.
+func getBenchmarkMaxRuns() int {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return BENCHMARK_MAX_RUNS
+}
+
+// getDefaultLimits returns DEFAULT_LIMITS.
+func getDefaultLimits() Limits {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return DEFAULT_LIMITS
+}
+
+// reloadConfig reads the environment file again and applies the settings
+// that can be changed while the bot is running. Settings that are removed
+// from the file keep their current values. If any setting is invalid,
+// nothing is changed. It returns the names of the settings that changed.
+func reloadConfig() ([]string, error) {
+	err := godotenv.Overload(DOTENV)
+	if err != nil {
+		return nil, err
+	}
+
+	logLevel := os.Getenv("LOG_LEVEL")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(logLevel))
+	if err != nil || level == zerolog.NoLevel {
+		return nil, fmt.Errorf("invalid LOG_LEVEL: %q", logLevel)
+	}
+
+	var adminIDs []string
+	if v := os.Getenv("ADMIN_IDS"); v != "" {
+		adminIDs = strings.Split(v, ",")
+	}
+
+	runEmoji := os.Getenv("RUN_EMOJI")
+	switch runEmoji {
+	case "":
+		runEmoji = "▶️"
+	case "none":
+		runEmoji = ""
+	}
+
+	// Integer settings and their defaults.
+	ints := []struct {
+		name string
+		def  int
+	}{
+		{"GUILD_CONCURRENCY", 3},
+		{"MAX_CONCURRENT_EXECUTIONS", 5},
+		{"OUTPUT_FILE_THRESHOLD", 1500},
+		{"SCAN_DEPTH", 10},
+		{"BENCHMARK_MAX_RUNS", 10},
+		{"COMPILE_TIMEOUT", 0},
+		{"RUN_TIMEOUT", 0},
+		{"COMPILE_MEMORY_LIMIT", 0},
+		{"RUN_MEMORY_LIMIT", 0},
+	}
+	values := make(map[string]int, len(ints))
+	for _, v := range ints {
+		n, err := parseEnvInt(v.name, v.def)
+		if err != nil {
+			return nil, err
+		}
+		values[v.name] = n
+	}
+	if values["SCAN_DEPTH"] < 1 || values["SCAN_DEPTH"] > 100 {
+		return nil, fmt.Errorf("SCAN_DEPTH must be between 1 and 100")
+	}
+
+	allowDMExecution, err := parseEnvBool("ALLOW_DM_EXECUTION", true)
+	if err != nil {
+		return nil, err
+	}
+
+	userCooldown, err := parseEnvDuration("USER_COOLDOWN", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	resultCacheTTL, err := parseEnvDuration("RESULT_CACHE_TTL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	templateFile := os.Getenv("TEMPLATE_FILE")
+	newTemplates, err := loadTemplates(templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := Limits{
+		CompileTimeout:     values["COMPILE_TIMEOUT"],
+		RunTimeout:         values["RUN_TIMEOUT"],
+		CompileMemoryLimit: values["COMPILE_MEMORY_LIMIT"],
+		RunMemoryLimit:     values["RUN_MEMORY_LIMIT"],
+	}
+
+	// Every setting is valid, so apply them.
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	var changed []string
+	set := func(name string, old interface{}, new interface{}) bool {
+		if fmt.Sprint(old) == fmt.Sprint(new) {
+			return false
+		}
+		changed = append(changed, name)
+		return true
+	}
+
+	if set("LOG_LEVEL", LOG_LEVEL, logLevel) {
+		LOG_LEVEL = logLevel
+		zerolog.SetGlobalLevel(level)
+	}
+	if set("ADMIN_IDS", ADMIN_IDS, adminIDs) {
+		ADMIN_IDS = adminIDs
+	}
+	if set("ALLOW_DM_EXECUTION", ALLOW_DM_EXECUTION, allowDMExecution) {
+		ALLOW_DM_EXECUTION = allowDMExecution
+	}
+	if guildIDs := parseGuildIDs(os.Getenv("GUILD_ID")); set("GUILD_ID", GUILD_IDS, guildIDs) {
+		GUILD_IDS = guildIDs
+	}
+	if set("RUN_EMOJI", RUN_EMOJI, runEmoji) {
+		RUN_EMOJI = runEmoji
+	}
+	cooldownChanged := set("USER_COOLDOWN", USER_COOLDOWN, userCooldown)
+	concurrencyChanged := set("GUILD_CONCURRENCY", GUILD_CONCURRENCY, values["GUILD_CONCURRENCY"])
+	if cooldownChanged || concurrencyChanged {
+		USER_COOLDOWN = userCooldown
+		GUILD_CONCURRENCY = values["GUILD_CONCURRENCY"]
+		rateLimiter.SetLimits(USER_COOLDOWN, GUILD_CONCURRENCY)
+	}
+	if set("MAX_CONCURRENT_EXECUTIONS", MAX_CONCURRENT_EXECUTIONS, values["MAX_CONCURRENT_EXECUTIONS"]) {
+		MAX_CONCURRENT_EXECUTIONS = values["MAX_CONCURRENT_EXECUTIONS"]
+		execQueue.SetSlots(MAX_CONCURRENT_EXECUTIONS)
+	}
+	if set("OUTPUT_FILE_THRESHOLD", OUTPUT_FILE_THRESHOLD, values["OUTPUT_FILE_THRESHOLD"]) {
+		OUTPUT_FILE_THRESHOLD = values["OUTPUT_FILE_THRESHOLD"]
+	}
+	if set("SCAN_DEPTH", SCAN_DEPTH, values["SCAN_DEPTH"]) {
+		SCAN_DEPTH = values["SCAN_DEPTH"]
+	}
+	if set("BENCHMARK_MAX_RUNS", BENCHMARK_MAX_RUNS, values["BENCHMARK_MAX_RUNS"]) {
+		BENCHMARK_MAX_RUNS = values["BENCHMARK_MAX_RUNS"]
+	}
+	if set("DEFAULT_LIMITS", DEFAULT_LIMITS, limits) {
+		DEFAULT_LIMITS = limits
+	}
+	if set("RESULT_CACHE_TTL", RESULT_CACHE_TTL, resultCacheTTL) {
+		RESULT_CACHE_TTL = resultCacheTTL
+		resultCache.SetTTL(RESULT_CACHE_TTL)
+	}
+	// Template files can change without TEMPLATE_FILE changing.
+	set("TEMPLATE_FILE", TEMPLATE_FILE, templateFile)
+	TEMPLATE_FILE = templateFile
+	templates = newTemplates
+
+	return changed, nil
+}
+
+// adminReloadHandler reloads the configuration and languages, and creates the
+// commands again if they have changed.
+func adminReloadHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	changed, err := reloadConfig()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("env_file", DOTENV).
+			Msg("Error reloading configuration.")
+
+		adminFollowup(s, i, fmt.Sprintf("Error reloading configuration, nothing was changed.```\n%v\n```", err))
+		return
+	}
+
+	log.Info().
+		Strs("changed", changed).
+		Str("user_id", interactionUser(i).ID).
+		Msg("Configuration reloaded.")
+
+	lines := []string{"Reloaded configuration."}
+	if len(changed) > 0 {
+		lines = append(lines, "**Changed:** "+strings.Join(changed, ", "))
+	}
+
+	err = loadLanguages()
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error refreshing languages.")
+
+		lines = append(lines, fmt.Sprintf("Error refreshing languages.```\n%v\n```", err))
+	} else {
+		lines = append(lines, fmt.Sprintf("Refreshed languages. %d languages are supported.", len(getLanguages())))
+	}
+
+	registered, err := registerCommands(shards[0])
+	switch {
+	case err != nil:
+		log.Error().
+			Err(err).
+			Msg("Error creating commands.")
+
+		lines = append(lines, fmt.Sprintf("Error creating commands.```\n%v\n```", err))
+	case registered:
+		lines = append(lines, "Commands have changed and were updated.")
+	}
+
+	adminFollowup(s, i, strings.Join(lines, "\n"))
+}
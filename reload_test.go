@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// TestReloadConfig reloads settings while they are read, which the race
+// detector checks, with the settings the tests are set up with except for
+// SCAN_DEPTH and RESULT_CACHE_TTL.
+func TestReloadConfig(t *testing.T) {
+	// Setting the variables first restores them after the test.
+	for _, name := range []string{
+		"LOG_LEVEL", "ADMIN_IDS", "RUN_EMOJI", "GUILD_ID", "ALLOW_DM_EXECUTION", "USER_COOLDOWN",
+		"RESULT_CACHE_TTL", "TEMPLATE_FILE", "GUILD_CONCURRENCY", "MAX_CONCURRENT_EXECUTIONS",
+		"OUTPUT_FILE_THRESHOLD", "SCAN_DEPTH", "BENCHMARK_MAX_RUNS", "COMPILE_TIMEOUT",
+		"RUN_TIMEOUT", "COMPILE_MEMORY_LIMIT", "RUN_MEMORY_LIMIT",
+	} {
+		t.Setenv(name, "")
+	}
+
+	dotenv := filepath.Join(t.TempDir(), ".env")
+	err := os.WriteFile(dotenv, []byte("LOG_LEVEL=disabled\nUSER_COOLDOWN=0s\nGUILD_CONCURRENCY=100\nMAX_CONCURRENT_EXECUTIONS=1\nSCAN_DEPTH=20\nRESULT_CACHE_TTL=1m\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(dotenv string, logLevel string, runEmoji string, scanDepth int) {
+		DOTENV = dotenv
+		LOG_LEVEL = logLevel
+		RUN_EMOJI = runEmoji
+		SCAN_DEPTH = scanDepth
+		resultCache.SetTTL(0)
+	}(DOTENV, LOG_LEVEL, RUN_EMOJI, SCAN_DEPTH)
+	DOTENV = dotenv
+
+	cache := resultCache
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				getScanDepth()
+				dmExecutionAllowed()
+				getDefaultLimits()
+				applyTemplate("python", []piston.File{{Content: "print(1)"}})
+				resultCache.Get(piston.ExecuteRequest{Language: "python"})
+			}
+		}
+	}()
+
+	changed, err := reloadConfig()
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if depth := getScanDepth(); depth != 20 {
+		t.Errorf("expected SCAN_DEPTH to be 20, got %d", depth)
+	}
+	if resultCache != cache {
+		t.Error("expected the result cache to be kept")
+	}
+	if ttl := resultCache.TTL(); ttl != time.Minute {
+		t.Errorf("expected the result cache to keep results for 1m, got %v", ttl)
+	}
+	if !stringInSlice("SCAN_DEPTH", changed) || !stringInSlice("RESULT_CACHE_TTL", changed) {
+		t.Errorf("expected SCAN_DEPTH and RESULT_CACHE_TTL to have changed, got %v", changed)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Output styles.
+const (
+	OutputStyleEmbed = "embed" // an embed with a field for each output stream
+	OutputStyleText  = "text"  // code blocks split over as many pages as needed
+)
+
+// Ways of collapsing output so it doesn't flood the channel.
+const (
+	OutputCollapseNone    = "none"    // output is shown as is
+	OutputCollapseSpoiler = "spoiler" // output is hidden behind spoiler tags
+	OutputCollapseThread  = "thread"  // output is posted in a thread off the response
+)
+
+// Embed colors of successful and failed runs.
+const (
+	colorSuccess = 0x2ecc71
+	colorFailure = 0xe74c3c
+)
+
+// Discord allows at most 1024 characters in an embed field.
+const embedFieldLimit = 1024
+
+// Discord allows at most 2000 characters in a message.
+const messageLimit = 2000
+
+// Size of the pages of output, leaving room in a message for a label,
+// spoiler tags, the footer, and a note about truncated output.
+const outputPageLimit = messageLimit - 250
+
+// Smallest size of pages of output a guild can set.
+const minOutputPageSize = 100
+
+// guildOutputPages returns the size of the pages of output in code blocks in
+// a guild, and the number of pages output is cut off after.
+func guildOutputPages(g GuildConfig) (size int, maxPages int) {
+	return limit(g.OutputPageSize, outputPageLimit), limit(g.OutputMaxPages, MAX_OUTPUT_PAGES)
+}
+
+// capPages keeps at most maxPages pages of output, noting how much output
+// was left out on the last page kept.
+func capPages(pages []string, maxPages int) []string {
+	if maxPages <= 0 || len(pages) <= maxPages {
+		return pages
+	}
+
+	// Count the output in the code blocks of the pages left out.
+	omitted := 0
+	for _, page := range pages[maxPages:] {
+		omitted += len(page) - strings.Index(page, "```\n") - len("```\n\n```")
+	}
+
+	pages = pages[:maxPages]
+	pages[maxPages-1] += fmt.Sprintf("\n*Output truncated, %v bytes omitted.*", omitted)
+	return pages
+}
+
+// renderOutput renders the output of code in the output style of a user, or
+// of the guild, with the "Run Again" button of an interaction attached to the
+// last message. The output is hidden behind spoiler tags if spoiler is true.
+// If the code was stopped, e.g. for exceeding the limits it was run with, it
+// is explained below the output.
+func renderOutput(result *piston.ExecuteResponse, id string, userID string, guildID string, limits Limits, spoiler bool) []*discordgo.WebhookParams {
+	stopped := terminationMessage(result, limits)
+	if outputStyle(userID, guildID) == OutputStyleText {
+		return renderText(result, id, userID, guildID, stopped, spoiler)
+	}
+	return renderEmbed(result, id, userID, stopped, spoiler)
+}
+
+// spoilerOutput hides output behind spoiler tags if spoiler is true.
+func spoilerOutput(output string, spoiler bool) string {
+	if !spoiler {
+		return output
+	}
+	return "||" + output + "||"
+}
+
+// renderText splits the output of code into pages of code blocks, with the
+// exit status below the output and the "Run Again" button of an interaction
+// attached. Output with several pages is shown in one message with buttons
+// to move between them.
+func renderText(result *piston.ExecuteResponse, id string, userID string, guildID string, stopped string, spoiler bool) []*discordgo.WebhookParams {
+	size, maxPages := guildOutputPages(guildConfigs.Get(guildID))
+
+	// Split code output into pages of the size set by the guild, with the
+	// compiler output in its own section.
+	var messages []string
+	if result.Compile != nil && result.Compile.Output != "" {
+		messages = append(messages, labelOutput("Compilation", splitOutput(result.Compile.Output, size))...)
+
+		// The code is only run if it compiled successfully.
+		if result.Compile.Code == 0 {
+			messages = append(messages, runPages(result.Run, "Output", size)...)
+		}
+	} else {
+		messages = runPages(result.Run, "", size)
+	}
+
+	// Output is cut off after the pages the guild allows, unless it is long
+	// enough to be sent as a file.
+	attach := len(fullOutput(result)) > getOutputFileThreshold()
+	if !attach {
+		messages = capPages(messages, maxPages)
+	}
+
+	for n := range messages {
+		messages[n] = spoilerOutput(messages[n], spoiler)
+	}
+
+	// Send long output as a file instead of spamming messages, keeping only the first chunk.
+	var attachments []*discordgo.File
+	if attach {
+		var note string
+		note, attachments = outputAttachment(result)
+		messages = messages[:1]
+		messages[0] += "\n" + note
+	}
+
+	// Explain why the code was stopped, instead of showing empty output.
+	if stopped != "" {
+		if fullOutput(result) == "" {
+			messages = []string{"*" + stopped + "*"}
+		} else {
+			messages[len(messages)-1] += "\n*" + stopped + "*"
+		}
+	}
+
+	// Show output that needs several messages in one message with pages,
+	// with the exit status and execution time below every page.
+	if len(messages) > 1 {
+		for n := range messages {
+			messages[n] += "\n" + resultFooter(result)
+		}
+		return []*discordgo.WebhookParams{paginate(id, messages, runAgainComponents(id, userID))}
+	}
+
+	// Add the exit status and execution time below the output, and attach the
+	// output file and the "Run Again" button.
+	return []*discordgo.WebhookParams{
+		{
+			Content:    messages[0] + "\n" + resultFooter(result),
+			Files:      attachments,
+			Components: runAgainComponents(id, userID),
+		},
+	}
+}
+
+// runPages splits the output of a program into pages, with stdout and stderr
+// in their own labeled sections if it wrote to both. Otherwise, the output
+// is labeled with label, if any.
+func runPages(run piston.ExecuteResults, label string, size int) []string {
+	if run.Stdout != "" && run.Stderr != "" {
+		return append(labelOutput("Stdout", splitOutput(run.Stdout, size)), labelOutput("Stderr", splitOutput(run.Stderr, size))...)
+	}
+
+	pages := splitOutput(run.Output, size)
+	if label != "" {
+		return labelOutput(label, pages)
+	}
+	return pages
+}
+
+// stderrOnly returns a copy of a result without the standard output of the
+// program, to debug noisy programs.
+func stderrOnly(result *piston.ExecuteResponse) *piston.ExecuteResponse {
+	r := *result
+	r.Run.Stdout = ""
+	r.Run.Output = r.Run.Stderr
+	return &r
+}
+
+// renderEmbed renders the output of code as an embed, colored by whether it
+// succeeded, with the output that doesn't fit attached as a file.
+func renderEmbed(result *piston.ExecuteResponse, id string, userID string, stopped string, spoiler bool) []*discordgo.WebhookParams {
+	var fields []*discordgo.MessageEmbedField
+	truncated := false
+
+	addField := func(name string, output string) {
+		value, cut := embedCodeBlock(output)
+		truncated = truncated || cut
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  name,
+			Value: spoilerOutput(value, spoiler),
+		})
+	}
+
+	compiled := result.Compile == nil || result.Compile.Code == 0
+	if result.Compile != nil && result.Compile.Output != "" {
+		addField("Compilation", result.Compile.Output)
+	}
+
+	// The code is only run if it compiled successfully. Empty output isn't
+	// shown if why the code was stopped is.
+	if compiled {
+		if result.Run.Stdout != "" || (result.Run.Stderr == "" && stopped == "") {
+			addField("Stdout", result.Run.Stdout)
+		}
+		if result.Run.Stderr != "" {
+			addField("Stderr", result.Run.Stderr)
+		}
+	}
+
+	color := colorFailure
+	if executionStatus(result, nil) == "success" {
+		color = colorSuccess
+	}
+
+	params := &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       fmt.Sprintf("%v %v", result.Language, result.Version),
+				Description: stopped,
+				Color:       color,
+				Fields:      fields,
+				Footer: &discordgo.MessageEmbedFooter{
+					Text: resultStats(result),
+				},
+			},
+		},
+		Components: runAgainComponents(id, userID),
+	}
+
+	if truncated {
+		params.Content, params.Files = outputAttachment(result)
+	}
+
+	return []*discordgo.WebhookParams{params}
+}
+
+// embedCodeBlock puts output in a code block that fits in an embed field,
+// cutting it off if it is too long.
+func embedCodeBlock(output string) (block string, truncated bool) {
+	if output == "" {
+		return "*No output*", false
+	}
+
+	output = sanitizeOutput(output)
+
+	// Leave room for the backticks, newlines, and spoiler tags.
+	limit := embedFieldLimit - 12
+	if len(output) > limit {
+		output = output[:limit]
+		for !utf8.ValidString(output) {
+			output = output[:len(output)-1]
+		}
+		truncated = true
+	}
+
+	return "```\n" + output + "\n```", truncated
+}
+
+// resultStats describes how the code exited, how long it took, and the
+// resources it used.
+func resultStats(result *piston.ExecuteResponse) string {
+	stats := []string{resultSummary(result)}
+
+	if result.Run.CPUTime > 0 {
+		stats = append(stats, fmt.Sprintf("CPU %dms", result.Run.CPUTime))
+	}
+	if result.Run.Memory > 0 {
+		stats = append(stats, fmt.Sprintf("%.2f MB", float64(result.Run.Memory)/1e6))
+	}
+	if result.ExecutionID != "" {
+		stats = append(stats, "Run "+result.ExecutionID)
+	}
+
+	return strings.Join(stats, " | ")
+}
+
+// outputAttachment returns the full output of code as a file, or a link to
+// it if pastes are enabled, with a note saying where to find it.
+func outputAttachment(result *piston.ExecuteResponse) (note string, files []*discordgo.File) {
+	link, files := attachLong("output.txt", stripControlSequences(fullOutput(result)))
+	if link != "" {
+		return "*Output truncated, the full output is at " + link + "*", nil
+	}
+	return "*Output truncated, the full output is attached.*", files
+}
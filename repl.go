@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// replSession is a thread where every message of a user is run with the code
+// of the previous messages.
+type replSession struct {
+	UserID     string
+	GuildID    string
+	Language   string
+	Version    string
+	Limits     Limits
+	Snippets   []string // code of the messages that ran successfully
+	Stdout     string   // stdout of the last successful run
+	LastActive time.Time
+}
+
+var (
+	replSessions   = make(map[string]*replSession) // thread ID -> session
+	replSessionsMu sync.Mutex
+)
+
+// REPL command definition.
+var replCommand = &discordgo.ApplicationCommand{
+	Name:        "repl",
+	Description: "Runs every message you post in a thread, keeping the code of previous messages.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "start",
+			Description: "Starts a REPL in a new thread.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "language",
+					Description: "The language to run the code in.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+				},
+				{
+					Name:         "version",
+					Description:  "The version of the language to use. Defaults to the latest version.",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     false,
+					Autocomplete: true,
+				},
+			},
+		},
+		{
+			Name:        "end",
+			Description: "Ends the REPL in this thread.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+	},
+}
+
+func replHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	cmd := i.ApplicationCommandData().Options[0]
+	switch cmd.Name {
+	case "start":
+		replStartHandler(s, i, optionMap(cmd.Options))
+	case "end":
+		replEndHandler(ctx, s, i)
+	}
+}
+
+// replStartHandler starts a REPL session in a new thread.
+func replStartHandler(s Discord, i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	if !checkChannel(s, i) || !checkThreadChannel(s, i) {
+		return
+	}
+
+	lang := resolveGuildLanguage(i.GuildID, options["language"].StringValue())
+	if lang == "" {
+		respondEphemeral(s, i, fmt.Sprintf("Language %v is not supported. Supported languages are: %v", options["language"].StringValue(), getLanguages()))
+		return
+	}
+
+	version := ""
+	if option, ok := options["version"]; ok {
+		version = option.StringValue()
+		if !stringInSlice(version, getLanguageVersions(lang)) {
+			respondEphemeral(s, i, fmt.Sprintf("Version %v of %v is not supported. Supported versions are: %v", version, lang, getLanguageVersions(lang)))
+			return
+		}
+	}
+
+	user := interactionUser(i)
+	thread, err := s.ThreadStart(i.ChannelID, fmt.Sprintf("%v REPL (%v)", lang, user.Username), discordgo.ChannelTypeGuildPublicThread, 60)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error starting thread.")
+
+		respondEphemeral(s, i, "Error starting the REPL thread. REPLs can't be started inside threads, and the bot needs permission to create threads here.")
+		return
+	}
+
+	replSessionsMu.Lock()
+	replSessions[thread.ID] = &replSession{
+		UserID:     user.ID,
+		GuildID:    i.GuildID,
+		Language:   lang,
+		Version:    version,
+		Limits:     guildLimits(i.GuildID),
+		LastActive: time.Now(),
+	}
+	replSessionsMu.Unlock()
+
+	_, err = s.ChannelMessageSend(thread.ID, fmt.Sprintf(
+		"<@%v>, every message you post here is run as %v, with the code of your previous messages before it. "+
+			"Messages that fail are not kept. Use `/repl end` to stop, or the REPL ends after %v of inactivity.",
+		user.ID, lang, REPL_IDLE_TIMEOUT,
+	))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending message.")
+	}
+
+	log.Info().
+		Str("thread_id", thread.ID).
+		Str("user_id", user.ID).
+		Str("language", lang).
+		Msg("REPL started.")
+
+	err = s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Started a %v REPL in <#%v>.", lang, thread.ID),
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// replEndHandler ends the REPL session of the thread the command is used in.
+func replEndHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	replSessionsMu.Lock()
+	session, ok := replSessions[i.ChannelID]
+	if ok && (session.UserID == interactionUser(i).ID || canManageGuild(i)) {
+		delete(replSessions, i.ChannelID)
+	}
+	replSessionsMu.Unlock()
+
+	if !ok {
+		respondEphemeral(s, i, "There is no REPL running in this channel.")
+		return
+	}
+	if session.UserID != interactionUser(i).ID && !canManageGuild(i) {
+		respondEphemeral(s, i, "Only the user who started this REPL can end it.")
+		return
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "REPL ended.",
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+
+	archiveThread(s, i.ChannelID)
+}
+
+// replMessageHandler runs the messages posted by the user of a REPL session in
+// its thread.
+func replMessageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	defer recoverEvent("repl message")
+
+	if m.Author == nil || m.Author.Bot {
+		return
+	}
+
+	replSessionsMu.Lock()
+	session, ok := replSessions[m.ChannelID]
+	if ok && session.UserID == m.Author.ID {
+		session.LastActive = time.Now()
+	}
+	replSessionsMu.Unlock()
+
+	if !ok || session.UserID != m.Author.ID {
+		return
+	}
+
+	code := replCode(m.Message)
+	if code == "" {
+		return
+	}
+
+	if !shutdown.Begin() {
+		return
+	}
+	defer shutdown.Done()
+
+	release, wait, ok := rateLimiter.Acquire(m.Author.ID, m.GuildID)
+	if !ok {
+		replyWith(s, m.Message, &discordgo.WebhookParams{
+			Content: fmt.Sprintf("Slow down! You can run code again in %v.", wait.Round(time.Second/10)),
+		})
+		return
+	}
+	defer release()
+
+	commandsReceived.WithLabelValues("repl", strconv.Itoa(s.ShardID)).Inc()
+
+	err := s.ChannelTyping(m.ChannelID)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending typing indicator.")
+	}
+
+	replSessionsMu.Lock()
+	program := strings.Join(append(append([]string(nil), session.Snippets...), code), "\n")
+	previous := session.Stdout
+	replSessionsMu.Unlock()
+
+	if checkBlocked(s, m.GuildID, m.ChannelID, m.Author.ID, []piston.File{{Content: code}}) {
+		replyWith(s, m.Message, &discordgo.WebhookParams{
+			Content: tr("", "error.blocked"),
+		})
+		return
+	}
+
+	files := applyTemplate(session.Language, []piston.File{{Content: program}})
+
+	var result *piston.ExecuteResponse
+	releaseSlot, err := execQueue.Acquire(context.Background(), nil)
+	if err == nil {
+		result, err = Execute(context.Background(), ExecRequest{
+			Language: session.Language,
+			Version:  session.Version,
+			Files:    files,
+			Limits:   session.Limits,
+		})
+		releaseSlot()
+	}
+	recordExecution(m.ID, m.Author.ID, m.GuildID, session.Language, session.Version, files, result, err)
+	auditExecution(s, m.ChannelID, m.Author.ID, m.GuildID, executionID(result, err), session.Language, files, executionStatus(result, err))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("execution_id", executionID(nil, err)).
+			Msg("Error executing code.")
+
+		replyWith(s, m.Message, &discordgo.WebhookParams{
+			Content: execErrorMessage("code", err),
+		})
+		return
+	}
+
+	// Only keep code that ran, so a mistake doesn't break the session.
+	status := executionStatus(result, nil)
+	if status == "success" {
+		replSessionsMu.Lock()
+		session.Snippets = append(session.Snippets, code)
+		session.Stdout = result.Run.Stdout
+		replSessionsMu.Unlock()
+	}
+
+	replyWith(s, m.Message, &discordgo.WebhookParams{
+		Content: replOutput(result, previous, status),
+	})
+}
+
+// replCode returns the code of a REPL message: its code blocks if it has
+// any, or else the whole message.
+func replCode(m *discordgo.Message) string {
+	blocks := parseCodeBlocks(m.Content)
+	if len(blocks) == 0 {
+		return strings.TrimSpace(strings.Trim(m.Content, "`"))
+	}
+
+	code := make([]string, len(blocks))
+	for n, b := range blocks {
+		code[n] = b.Code
+	}
+	return strings.Join(code, "\n")
+}
+
+// replOutput renders the output of a REPL message. The output of the
+// previous messages is removed, since their code is run again.
+func replOutput(result *piston.ExecuteResponse, previous string, status string) string {
+	if result.Compile != nil && result.Compile.Code != 0 {
+		return labelOutput("Compilation", splitOutput(result.Compile.Output, 1800))[0]
+	}
+
+	stdout := strings.TrimPrefix(result.Run.Stdout, previous)
+	output := stdout + result.Run.Stderr
+	if strings.TrimSpace(output) == "" {
+		output = "No output."
+	}
+
+	content := splitOutput(output, 1800)[0]
+	if status != "success" {
+		content += "\n" + resultFooter(result) + " This message was not kept."
+	}
+	return content
+}
+
+// endIdleRepls periodically ends the REPL sessions that have been inactive for
+// REPL_IDLE_TIMEOUT, archiving their threads.
+func endIdleRepls(s *discordgo.Session, interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			var idle []string
+
+			replSessionsMu.Lock()
+			for id, session := range replSessions {
+				if time.Since(session.LastActive) > REPL_IDLE_TIMEOUT {
+					idle = append(idle, id)
+					delete(replSessions, id)
+				}
+			}
+			replSessionsMu.Unlock()
+
+			for _, id := range idle {
+				_, err := s.ChannelMessageSend(id, fmt.Sprintf("REPL ended after %v of inactivity.", REPL_IDLE_TIMEOUT))
+				if err != nil {
+					log.Error().
+						Err(err).
+						Msg("Error sending message.")
+				}
+
+				archiveThread(s, id)
+			}
+		}
+	}()
+}
+
+// archiveThread archives and locks a thread.
+func archiveThread(s Discord, threadID string) {
+	archived := true
+	_, err := s.ChannelEditComplex(threadID, &discordgo.ChannelEdit{
+		Archived: &archived,
+		Locked:   &archived,
+	})
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("thread_id", threadID).
+			Msg("Error archiving thread.")
+	}
+
+	log.Info().
+		Str("thread_id", threadID).
+		Msg("REPL ended.")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+)
+
+// How long code is kept around to be run again.
+const storedRunTTL = 24 * time.Hour
+
+// storedRun is code that was executed by an interaction.
+type storedRun struct {
+	Language string
+	Version  string
+	Files    []piston.File
+	Env      map[string]string `json:",omitempty"`
+	Deps     []string          `json:",omitempty"`
+	Limits   Limits
+	Created  time.Time
+}
+
+var (
+	storedRuns   = make(map[string]storedRun)
+	storedRunsMu sync.Mutex
+)
+
+// storeRun saves the code executed by an interaction, removing expired runs.
+func storeRun(id string, run storedRun) {
+	run.Created = time.Now()
+
+	if redisClient != nil {
+		setShared("run", id, run, storedRunTTL)
+		return
+	}
+
+	storedRunsMu.Lock()
+	defer storedRunsMu.Unlock()
+
+	for k, r := range storedRuns {
+		if time.Since(r.Created) > storedRunTTL {
+			delete(storedRuns, k)
+		}
+	}
+
+	storedRuns[id] = run
+}
+
+// getRun returns the code executed by an interaction, if it has not expired.
+func getRun(id string) (storedRun, bool) {
+	if redisClient != nil {
+		var r storedRun
+		return r, getShared("run", id, &r)
+	}
+
+	storedRunsMu.Lock()
+	defer storedRunsMu.Unlock()
+
+	r, ok := storedRuns[id]
+	if !ok || time.Since(r.Created) > storedRunTTL {
+		return storedRun{}, false
+	}
+
+	return r, true
+}
+
+// runAgainComponents returns the components for the "Run Again" button of an interaction.
+func runAgainComponents(id string, userID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Run Again",
+					Style:    discordgo.PrimaryButton,
+					CustomID: "run_again:" + id,
+				},
+				deleteOutputButton(userID),
+			},
+		},
+	}
+}
+
+// runAgainHandler runs the code of an interaction again. It also handles
+// confirming a detected language, which runs the code for the first time.
+func runAgainHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	id := customID[strings.Index(customID, ":")+1:]
+
+	w := NewResponseWriter(ctx, s, i)
+
+	run, ok := getRun(id)
+	if !ok {
+		w.Error("This code has expired and can no longer be run again. Please run it with `/run` instead.")
+		return
+	}
+
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	// Execute the code and send the output.
+	w.Env = run.Env
+	w.Deps = run.Deps
+	runCode(w, run.Language, run.Version, run.Files, run.Limits)
+}
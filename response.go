@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// ResponseWriter sends the responses to an interaction. Output is posted
+// publicly unless the writer is ephemeral, while errors are only shown to the
+// user unless the guild has made errors public.
+type ResponseWriter struct {
+	Session     Discord
+	Interaction *discordgo.InteractionCreate
+	Source      *discordgo.Message // code message being run, if any
+	Ephemeral   bool               // every response is only visible to the user
+	Raw         bool               // code is run without its language's template
+	Collapse    string             // how output is collapsed, see outputCollapse
+	Stdin       string             // input given to the program
+	Interactive bool               // the user can give the program input after it runs
+	Expect      string             // output the program is expected to print, if any
+	Compare     string             // how the output is compared with Expect
+	StderrOnly  bool               // only the standard error of the program is shown
+	Env         map[string]string  // environment variables the program is run with
+	Deps        []string           // packages installed before running the program
+
+	ctx      context.Context
+	deferred bool // a deferred response was sent
+	sent     bool // a message replaced the deferred response
+}
+
+func NewResponseWriter(ctx context.Context, s Discord, i *discordgo.InteractionCreate) *ResponseWriter {
+	return &ResponseWriter{
+		Session:     s,
+		Interaction: i,
+		ctx:         ctx,
+	}
+}
+
+// Context returns the context of the interaction, which is cancelled once it
+// can no longer be responded to.
+func (w *ResponseWriter) Context() context.Context {
+	return w.ctx
+}
+
+// Defer sends a deferred response, telling the user that a response is coming
+// shortly. False is returned if it could not be sent, or if the bot lacks
+// the permissions it needs in the channel, which the user is told about.
+func (w *ResponseWriter) Defer() bool {
+	if !checkBotPermissions(w.Session, w.Interaction, w.Ephemeral) {
+		return false
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	}
+	if w.Ephemeral {
+		response.Data = &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+		}
+	}
+
+	err := w.Session.InteractionRespond(w.Interaction.Interaction, response, discordgo.WithContext(w.Context()))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+		return false
+	}
+
+	w.deferred = true
+	return true
+}
+
+// Send sends a message, which is public unless the writer is ephemeral. The
+// first one is the response, replacing the deferred response if there is one
+// so the placeholder doesn't stay around, and the rest are sent as followups.
+// The sent message is returned, or nil if it couldn't be sent or is the
+// response to an interaction that wasn't deferred.
+func (w *ResponseWriter) Send(params *discordgo.WebhookParams) *discordgo.Message {
+	if w.Ephemeral {
+		params.Flags |= discordgo.MessageFlagsEphemeral
+	}
+
+	var m *discordgo.Message
+	var err error
+	if !w.deferred && !w.sent {
+		err = w.Session.InteractionRespond(
+			w.Interaction.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content:         params.Content,
+					Embeds:          params.Embeds,
+					Components:      params.Components,
+					Files:           params.Files,
+					AllowedMentions: params.AllowedMentions,
+					Flags:           params.Flags,
+				},
+			},
+			discordgo.WithContext(w.Context()),
+		)
+	} else if w.deferred && !w.sent {
+		edit := &discordgo.WebhookEdit{
+			Content:         &params.Content,
+			Files:           params.Files,
+			AllowedMentions: params.AllowedMentions,
+		}
+		if params.Components != nil {
+			edit.Components = &params.Components
+		}
+		if params.Embeds != nil {
+			edit.Embeds = &params.Embeds
+		}
+
+		m, err = w.Session.InteractionResponseEdit(w.Interaction.Interaction, edit, discordgo.WithContext(w.Context()))
+	} else {
+		m, err = w.Session.FollowupMessageCreate(w.Interaction.Interaction, true, params, discordgo.WithContext(w.Context()))
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending response.")
+		return nil
+	}
+
+	w.sent = true
+	return m
+}
+
+// Error sends an error message, which is only visible to the user unless the
+// guild has made errors public.
+func (w *ResponseWriter) Error(content string) {
+	public := guildConfigs.Get(w.Interaction.GuildID).PublicErrors
+
+	if w.Ephemeral {
+		w.Send(&discordgo.WebhookParams{
+			Content: content,
+		})
+		return
+	}
+
+	if !w.deferred && !w.sent && !public {
+		respondEphemeral(w.Session, w.Interaction, content)
+		return
+	}
+
+	if !w.deferred && !w.sent {
+		err := w.Session.InteractionRespond(
+			w.Interaction.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{
+					Content: content,
+				},
+			},
+			discordgo.WithContext(w.Context()),
+		)
+
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error responding to interaction.")
+		}
+		return
+	}
+
+	if public {
+		w.Send(&discordgo.WebhookParams{
+			Content: content,
+		})
+		return
+	}
+
+	// The deferred response is public and can't be made ephemeral, so remove
+	// it before sending the error.
+	if w.deferred && !w.sent {
+		err := w.Session.InteractionResponseDelete(w.Interaction.Interaction, discordgo.WithContext(w.Context()))
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error deleting interaction response.")
+		}
+	}
+
+	_, err := w.Session.FollowupMessageCreate(w.Interaction.Interaction, false, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	}, discordgo.WithContext(w.Context()))
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending followup message.")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// peakMemory returns the peak memory used by a process that has exited, in
+// bytes, or 0 if it isn't known.
+func peakMemory(state *os.ProcessState) int {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+
+	// Linux reports kilobytes, while macOS reports bytes.
+	if runtime.GOOS == "darwin" {
+		return int(usage.Maxrss)
+	}
+	return int(usage.Maxrss) * 1024
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// peakMemory returns the peak memory used by a process that has exited, in
+// bytes, or 0 if it isn't known. Windows doesn't report it.
+func peakMemory(state *os.ProcessState) int {
+	return 0
+}
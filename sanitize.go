@@ -0,0 +1,52 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Matches ANSI escape sequences: CSI (colors, cursor movement), OSC (titles,
+// hyperlinks), and other two character escapes.
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)?|\x1b[@-Z\\-_]`)
+
+// Zero-width space, used to break up backticks.
+const zeroWidthSpace = "\u200b"
+
+// isInvisible checks if a rune is a zero-width or text direction character,
+// which can be used to make output look different from what it is.
+func isInvisible(r rune) bool {
+	switch {
+	case r >= '\u200b' && r <= '\u200f', // zero-width space, joiners, direction marks
+		r >= '\u202a' && r <= '\u202e', // direction embeddings and overrides
+		r >= '\u2060' && r <= '\u2064', // word joiner and invisible operators
+		r >= '\u2066' && r <= '\u2069', // direction isolates
+		r == '\ufeff':                  // byte order mark
+		return true
+	}
+	return false
+}
+
+// stripControlSequences removes ANSI escape sequences, control characters
+// (except newlines and tabs), and invisible characters from output.
+func stripControlSequences(output string) string {
+	output = ansiRegex.ReplaceAllString(output, "")
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || isInvisible(r) {
+			return -1
+		}
+		return r
+	}, output)
+}
+
+// sanitizeOutput makes output safe to post inside a code block, removing
+// control sequences and breaking up backticks that would close the block.
+func sanitizeOutput(output string) string {
+	output = stripControlSequences(output)
+	return strings.ReplaceAll(output, "```", "`"+zeroWidthSpace+"`"+zeroWidthSpace+"`")
+}
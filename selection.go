@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// How long the user has to choose which code message to run.
+const codeSelectionTTL = 15 * time.Minute
+
+// Discord allows at most 25 options in a select menu.
+const maxSelectOptions = 25
+
+// codeSelection is a command waiting for its user to choose which of several
+// code messages to run.
+type codeSelection struct {
+	UserID      string
+	Language    string            // language option, if any
+	Version     string            // version option, if any
+	Raw         bool              // raw option
+	Collapse    string            // spoiler option, if any
+	Interactive bool              // interactive option
+	Expect      string            // expect option, if any
+	Compare     string            // compare option, if any
+	StderrOnly  bool              // stderr_only option
+	Env         map[string]string // env option, if any
+	Deps        []string          // requirements option, if any
+	Limits      Limits
+	Created     time.Time
+}
+
+var (
+	codeSelections   = make(map[string]*codeSelection)
+	codeSelectionsMu sync.Mutex
+)
+
+// askCodeSelection asks the user of an interaction to choose which of the
+// code messages to run, showing the author and first line of each.
+func askCodeSelection(w *ResponseWriter, messages []*discordgo.Message, sel *codeSelection) {
+	sel.Created = time.Now()
+
+	if redisClient != nil {
+		setShared("selection", w.Interaction.ID, sel, codeSelectionTTL)
+	} else {
+		codeSelectionsMu.Lock()
+		for k, c := range codeSelections {
+			if time.Since(c.Created) > codeSelectionTTL {
+				delete(codeSelections, k)
+			}
+		}
+		codeSelections[w.Interaction.ID] = sel
+		codeSelectionsMu.Unlock()
+	}
+
+	if len(messages) > maxSelectOptions {
+		messages = messages[:maxSelectOptions]
+	}
+
+	options := make([]discordgo.SelectMenuOption, len(messages))
+	for n, m := range messages {
+		options[n] = discordgo.SelectMenuOption{
+			Label:       truncate(m.Author.Username+" at "+m.Timestamp.Format("15:04"), 100),
+			Value:       m.ID,
+			Description: truncate(codePreview(m), 100),
+		}
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Content: "There are multiple code messages. Which one should be run?",
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						MenuType:    discordgo.StringSelectMenu,
+						CustomID:    "select_code:" + w.Interaction.ID,
+						Placeholder: "Choose a code message",
+						Options:     options,
+					},
+				},
+			},
+		},
+	})
+}
+
+// codePreview returns the first non-empty line of code in a code message.
+func codePreview(m *discordgo.Message) string {
+	for _, b := range parseCodeBlocks(m.Content) {
+		for _, line := range strings.Split(b.Code, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				return line
+			}
+		}
+	}
+	return "(empty)"
+}
+
+// truncate shortens a string to at most n runes, ending it with an ellipsis if it was cut.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// getCodeSelection returns the command waiting for its user to choose the
+// code to run.
+func getCodeSelection(id string) (*codeSelection, bool) {
+	if redisClient != nil {
+		sel := &codeSelection{}
+		return sel, getShared("selection", id, sel)
+	}
+
+	codeSelectionsMu.Lock()
+	defer codeSelectionsMu.Unlock()
+
+	sel, ok := codeSelections[id]
+	return sel, ok
+}
+
+// selectCodeHandler runs the code message chosen by the user.
+func selectCodeHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	w := NewResponseWriter(ctx, s, i)
+	data := i.MessageComponentData()
+	id := strings.TrimPrefix(data.CustomID, "select_code:")
+
+	sel, ok := getCodeSelection(id)
+
+	if !ok || time.Since(sel.Created) > codeSelectionTTL {
+		w.Error("This choice has expired. Please run the command again.")
+		return
+	}
+	if sel.UserID != interactionUser(i).ID {
+		respondEphemeral(s, i, "Only the user who ran the command can choose the code to run.")
+		return
+	}
+
+	message, ok := getTargetMessage(w, data.Values[0], sel.Language)
+	if !ok {
+		return
+	}
+
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Send deferred message, telling the user that a response is coming shortly.
+	if !w.Defer() {
+		return
+	}
+
+	w.Raw = sel.Raw
+	w.Collapse = sel.Collapse
+	w.Interactive = sel.Interactive
+	w.Expect = sel.Expect
+	w.Compare = sel.Compare
+	w.StderrOnly = sel.StderrOnly
+	w.Env = sel.Env
+	w.Deps = sel.Deps
+	lang, version, files, ok := getCodeFromMessage(w, message, sel.Language, sel.Version, sel.Limits)
+	if !ok {
+		return
+	}
+
+	// Execute the code and send the output.
+	runCode(w, lang, version, files, sel.Limits)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Timeouts of the HTTP server, so slow or idle clients can't hold on to
+// connections. Requests are small, but /api/run responds once the code has
+// waited in the queue and run.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpWriteTimeout      = 5 * time.Minute
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// Handlers of the HTTP server, used for operational endpoints and the API.
+var httpMux = http.NewServeMux()
+
+// startHTTPServer serves the operational endpoints and the API in the
+// background, until the bot starts shutting down. Requests being handled
+// then are given SHUTDOWN_TIMEOUT to finish.
+func startHTTPServer(addr string) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           httpMux,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+
+	go func() {
+		log.Info().
+			Str("addr", addr).
+			Msg("HTTP server listening.")
+
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().
+				Err(err).
+				Msg("Error running HTTP server.")
+		}
+	}()
+
+	go func() {
+		<-shutdown.Context().Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error shutting down HTTP server.")
+		}
+	}()
+}
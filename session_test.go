@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeDiscord records the responses to interactions instead of sending them
+// to Discord. Methods the tests don't use panic.
+type fakeDiscord struct {
+	Discord
+
+	mu        sync.Mutex
+	channels  map[string]*discordgo.Channel
+	perms     map[string]int64     // of the user in each channel
+	messages  []*discordgo.Message // in the channel of the interaction, newest first
+	responses []*discordgo.InteractionResponse
+	edits     []*discordgo.WebhookEdit
+	followups []*discordgo.WebhookParams
+	deleted   bool // the response was deleted
+}
+
+func newFakeDiscord(messages ...*discordgo.Message) *fakeDiscord {
+	return &fakeDiscord{
+		channels: make(map[string]*discordgo.Channel),
+		perms:    make(map[string]int64),
+		messages: messages,
+	}
+}
+
+func (f *fakeDiscord) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses = append(f.responses, resp)
+	return nil
+}
+
+func (f *fakeDiscord) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.edits = append(f.edits, newresp)
+	return &discordgo.Message{ID: "response", ChannelID: interaction.ChannelID}, nil
+}
+
+func (f *fakeDiscord) InteractionResponseDelete(interaction *discordgo.Interaction, options ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deleted = true
+	return nil
+}
+
+func (f *fakeDiscord) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.followups = append(f.followups, data)
+	return &discordgo.Message{ID: fmt.Sprintf("followup%d", len(f.followups)), ChannelID: interaction.ChannelID}, nil
+}
+
+func (f *fakeDiscord) UserChannelPermissions(userID, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if perms, ok := f.perms[channelID]; ok {
+		return perms, nil
+	}
+	return 0, fmt.Errorf("unknown channel %v", channelID)
+}
+
+func (f *fakeDiscord) Channel(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if channel, ok := f.channels[channelID]; ok {
+		return channel, nil
+	}
+	return &discordgo.Channel{ID: channelID, Type: discordgo.ChannelTypeGuildText}, nil
+}
+
+func (f *fakeDiscord) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string, options ...discordgo.RequestOption) ([]*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.messages) > limit {
+		return f.messages[:limit], nil
+	}
+	return f.messages, nil
+}
+
+func (f *fakeDiscord) ChannelMessage(channelID, messageID string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, m := range f.messages {
+		if m.ID == messageID {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown message %v", messageID)
+}
+
+// contents returns the content and embeds of every response, edit, and
+// followup, in the order of their kind.
+func (f *fakeDiscord) contents() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var contents []string
+	add := func(content string, embeds []*discordgo.MessageEmbed) {
+		if content != "" {
+			contents = append(contents, content)
+		}
+		for _, e := range embeds {
+			contents = append(contents, e.Description)
+			for _, field := range e.Fields {
+				contents = append(contents, field.Value)
+			}
+		}
+	}
+
+	for _, r := range f.responses {
+		if r.Data != nil {
+			add(r.Data.Content, r.Data.Embeds)
+		}
+	}
+	for _, e := range f.edits {
+		var content string
+		if e.Content != nil {
+			content = *e.Content
+		}
+		var embeds []*discordgo.MessageEmbed
+		if e.Embeds != nil {
+			embeds = *e.Embeds
+		}
+		add(content, embeds)
+	}
+	for _, p := range f.followups {
+		add(p.Content, p.Embeds)
+	}
+	return contents
+}
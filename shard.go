@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Discord allows one gateway connection to be identified every 5 seconds.
+const shardIdentifyInterval = 5 * time.Second
+
+// Sessions of the shards run by this process.
+var shards []*discordgo.Session
+
+// shardCount returns SHARD_COUNT, or the number of shards recommended by
+// Discord if it isn't set.
+func shardCount(s *discordgo.Session) (int, error) {
+	if SHARD_COUNT > 0 {
+		return SHARD_COUNT, nil
+	}
+
+	gateway, err := s.GatewayBot()
+	if err != nil {
+		return 0, err
+	}
+
+	return gateway.Shards, nil
+}
+
+// localShardIDs returns the IDs of the shards run by this process: SHARD_ID
+// if it is set, otherwise all of them.
+func localShardIDs(count int) []int {
+	if SHARD_ID >= 0 {
+		return []int{SHARD_ID}
+	}
+
+	ids := make([]int, count)
+	for n := range ids {
+		ids[n] = n
+	}
+	return ids
+}
+
+// guildShard returns the ID of the shard that receives the events of a guild.
+func guildShard(guildID string, count int) int {
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return int((id >> 22) % uint64(count))
+}
+
+// ownsGuild checks if a guild's events are received by this process, which
+// then manages its commands. Global commands are managed by the process
+// running the first shard.
+func ownsGuild(guildID string) bool {
+	if len(shards) == 0 {
+		return true
+	}
+
+	shard := 0
+	if guildID != "" {
+		shard = guildShard(guildID, shards[0].ShardCount)
+	}
+
+	for _, s := range shards {
+		if s.ShardID == shard {
+			return true
+		}
+	}
+	return false
+}
+
+// openShards opens a session for each shard run by this process, waiting
+// between them as Discord requires. setup adds the handlers to each session
+// before it is opened.
+func openShards(count int, setup func(s *discordgo.Session)) error {
+	for n, id := range localShardIDs(count) {
+		if n > 0 {
+			time.Sleep(shardIdentifyInterval)
+		}
+
+		s, err := discordgo.New("Bot " + TOKEN)
+		if err != nil {
+			return err
+		}
+		s.ShardID = id
+		s.ShardCount = count
+		setup(s)
+
+		err = s.Open()
+		if err != nil {
+			return err
+		}
+		shards = append(shards, s)
+
+		log.Info().
+			Int("shard", id).
+			Int("shard_count", count).
+			Msg("Shard connected.")
+	}
+
+	return nil
+}
+
+// closeShards closes the sessions of all shards.
+func closeShards() {
+	for _, s := range shards {
+		err := s.Close()
+		if err != nil {
+			log.Error().
+				Err(err).
+				Int("shard", s.ShardID).
+				Msg("Error closing shard.")
+		}
+	}
+}
+
+// watchShard tracks the connection of a shard to the Discord gateway.
+func watchShard(s *discordgo.Session) {
+	s.AddHandler(func(s *discordgo.Session, _ *discordgo.Connect) {
+		shardConnected.WithLabelValues(strconv.Itoa(s.ShardID)).Set(1)
+	})
+	s.AddHandler(func(s *discordgo.Session, _ *discordgo.Disconnect) {
+		shardConnected.WithLabelValues(strconv.Itoa(s.ShardID)).Set(0)
+
+		log.Warn().
+			Int("shard", s.ShardID).
+			Msg("Shard disconnected.")
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ShutdownCoordinator tracks in-flight interactions so that the bot can wait
+// for them to finish before shutting down.
+type ShutdownCoordinator struct {
+	mu       sync.Mutex
+	closing  bool
+	inFlight sync.WaitGroup
+
+	ctx    context.Context // cancelled once shutting down
+	cancel context.CancelFunc
+}
+
+// Context returns a context that is cancelled once the bot starts shutting
+// down, for work that should stop then, like waiting for new messages.
+func (c *ShutdownCoordinator) Context() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.initContext()
+	return c.ctx
+}
+
+// initContext creates the context of the coordinator if it doesn't have one.
+func (c *ShutdownCoordinator) initContext() {
+	if c.ctx == nil {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// Begin starts tracking an interaction. It returns false if the bot is
+// shutting down, in which case the interaction should not be handled.
+func (c *ShutdownCoordinator) Begin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closing {
+		return false
+	}
+
+	c.inFlight.Add(1)
+	return true
+}
+
+// Done stops tracking an interaction started with Begin.
+func (c *ShutdownCoordinator) Done() {
+	c.inFlight.Done()
+}
+
+// Shutdown stops new interactions from being handled, and waits for the
+// in-flight interactions to finish. It returns false if they didn't finish
+// before the timeout.
+func (c *ShutdownCoordinator) Shutdown(timeout time.Duration) bool {
+	c.mu.Lock()
+	c.closing = true
+	c.initContext()
+	c.cancel()
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// shutdownMiddleware tracks interactions while they are handled, and stops
+// new ones from being handled while shutting down.
+func shutdownMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+		if !shutdown.Begin() {
+			if i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+				respondEphemeral(s, i, "The bot is restarting. Please try again in a moment.")
+			}
+			return
+		}
+		defer shutdown.Done()
+
+		next(ctx, s, i)
+	}
+}
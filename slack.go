@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum age of a Slack request, to prevent replaying old requests.
+const slackMaxRequestAge = 5 * time.Minute
+
+// Maximum size of a request from Slack.
+const slackMaxRequestSize = 1 << 20
+
+// Callback ID of the message shortcut that runs the code of a message.
+const slackRunShortcut = "run_code"
+
+var slackClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// SlackAdapter runs code from a Slack workspace, with the /run slash command
+// and the "Run Code" message shortcut of a Slack app.
+type SlackAdapter struct {
+	SigningSecret string
+}
+
+func (a *SlackAdapter) Name() string {
+	return "slack"
+}
+
+// Start adds the request URLs of the slash command and of interactivity.
+func (a *SlackAdapter) Start(mux *http.ServeMux) {
+	mux.HandleFunc("/slack/commands", a.commandHandler)
+	mux.HandleFunc("/slack/interactions", a.interactionHandler)
+}
+
+// verify reads the body of a request, checking that it was signed by Slack.
+func (a *SlackAdapter) verify(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST is allowed.", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, slackMaxRequestSize))
+	if err != nil {
+		http.Error(w, "Invalid request.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	age := time.Since(time.Unix(seconds, 0))
+	if err != nil || age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		http.Error(w, "Invalid timestamp.", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.SigningSecret))
+	fmt.Fprintf(mac, "v0:%v:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		http.Error(w, "Invalid signature.", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid request.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return values, true
+}
+
+// commandHandler runs the code given to the slash command. Slack needs a
+// response within 3 seconds, so the output is sent to the response URL.
+func (a *SlackAdapter) commandHandler(w http.ResponseWriter, r *http.Request) {
+	values, ok := a.verify(w, r)
+	if !ok {
+		return
+	}
+
+	a.run(ChatRun{
+		Platform: a.Name(),
+		UserID:   values.Get("user_id"),
+		GroupID:  values.Get("team_id"),
+		Text:     html.UnescapeString(values.Get("text")),
+	}, values.Get("response_url"))
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"response_type": "ephemeral",
+		"text":          "Running your code...",
+	})
+}
+
+// slackInteraction is the payload of a message shortcut.
+type slackInteraction struct {
+	Type       string `json:"type"`
+	CallbackID string `json:"callback_id"`
+	User       struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	Message struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	ResponseURL string `json:"response_url"`
+}
+
+// interactionHandler runs the code of the message the shortcut was used on.
+func (a *SlackAdapter) interactionHandler(w http.ResponseWriter, r *http.Request) {
+	values, ok := a.verify(w, r)
+	if !ok {
+		return
+	}
+
+	var payload slackInteraction
+	err := json.Unmarshal([]byte(values.Get("payload")), &payload)
+	if err != nil {
+		http.Error(w, "Invalid payload.", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Type == "message_action" && payload.CallbackID == slackRunShortcut {
+		a.run(ChatRun{
+			Platform: a.Name(),
+			UserID:   payload.User.ID,
+			GroupID:  payload.Team.ID,
+			Text:     html.UnescapeString(payload.Message.Text),
+		}, payload.ResponseURL)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// run runs code in the background and posts the output to a response URL.
+func (a *SlackAdapter) run(run ChatRun, responseURL string) {
+	if !shutdown.Begin() {
+		return
+	}
+
+	go func() {
+		defer shutdown.Done()
+		defer recoverEvent("slack")
+
+		reply := runChatCode(context.Background(), run)
+		err := a.respond(responseURL, reply)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error responding to Slack.")
+		}
+	}()
+}
+
+// respond posts a message to the channel through a response URL.
+func (a *SlackAdapter) respond(responseURL string, text string) error {
+	body, err := json.Marshal(map[string]string{
+		"response_type": "in_channel",
+		"text":          text,
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := slackClient.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack responded with %v", res.Status)
+	}
+	return nil
+}
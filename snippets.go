@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of snippets a user can save.
+const maxSnippets = 25
+
+// Maximum number of tags a guild can create.
+const maxTags = 100
+
+// Maximum size of the code of a snippet, in bytes.
+const maxSnippetSize = 16 * 1024
+
+// Matches the name of a snippet, e.g. "test-harness".
+var snippetNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Snippet is code saved to run again by name, by a user for themselves or
+// by the staff of a guild as a tag.
+type Snippet struct {
+	Language  string        `json:"language"`
+	Files     []piston.File `json:"files"`
+	CreatedBy string        `json:"created_by,omitempty"` // user who created a tag
+	Uses      int           `json:"uses,omitempty"`       // times a tag was shown or run
+	Created   time.Time     `json:"created"`
+}
+
+// SnippetStore stores snippets by owner, a user or a guild, and name in a
+// JSON file, or in the database if there is one.
+type SnippetStore struct {
+	mu     sync.RWMutex
+	kind   string // kind of the documents in the database
+	path   string
+	max    int // maximum number of snippets of an owner
+	owners map[string]map[string]*Snippet
+}
+
+// LoadSnippetStore loads the snippets from a file, which is created when a
+// snippet is first saved. Owners can save at most max snippets.
+func LoadSnippetStore(kind string, path string, max int) (*SnippetStore, error) {
+	p := &SnippetStore{
+		kind:   kind,
+		path:   path,
+		max:    max,
+		owners: make(map[string]map[string]*Snippet),
+	}
+
+	if database != nil {
+		return p, loadDocuments(kind, path, &p.owners)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &p.owners)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Get returns a snippet of an owner by name.
+func (p *SnippetStore) Get(owner string, name string) (Snippet, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if snippet, ok := p.owners[owner][name]; ok {
+		return *snippet, true
+	}
+	return Snippet{}, false
+}
+
+// Names returns the names of the snippets of an owner, sorted.
+func (p *SnippetStore) Names(owner string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	names := make([]string, 0, len(p.owners[owner]))
+	for name := range p.owners[owner] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save saves a snippet of an owner, replacing the snippet with the same name
+// but keeping how many times it was used.
+func (p *SnippetStore) Save(owner string, name string, snippet Snippet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	saved, ok := p.owners[owner]
+	if !ok {
+		saved = make(map[string]*Snippet)
+		p.owners[owner] = saved
+	}
+
+	old, ok := saved[name]
+	if !ok && len(saved) >= p.max {
+		return fmt.Errorf("at most %v can be saved, delete one first", p.max)
+	}
+	if ok {
+		snippet.Uses = old.Uses
+	}
+
+	snippet.Created = time.Now()
+	saved[name] = &snippet
+
+	return p.save(owner)
+}
+
+// Use counts a use of a snippet of an owner.
+func (p *SnippetStore) Use(owner string, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snippet, ok := p.owners[owner][name]
+	if !ok {
+		return nil
+	}
+	snippet.Uses++
+
+	return p.save(owner)
+}
+
+// Delete removes a snippet of an owner, returning false if it doesn't exist.
+func (p *SnippetStore) Delete(owner string, name string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.owners[owner][name]; !ok {
+		return false, nil
+	}
+
+	delete(p.owners[owner], name)
+	if len(p.owners[owner]) == 0 {
+		delete(p.owners, owner)
+	}
+
+	return true, p.save(owner)
+}
+
+// save saves the snippets of an owner to the database, or every snippet to
+// the file. Owners without snippets are removed.
+func (p *SnippetStore) save(owner string) error {
+	if database != nil {
+		if saved, ok := p.owners[owner]; ok {
+			return saveDocument(p.kind, owner, saved)
+		}
+		return database.DeleteDocument(p.kind, owner)
+	}
+
+	data, err := json.MarshalIndent(p.owners, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(p.path, data, 0o600)
+}
+
+// snippetNameOption is the name of a snippet or tag, suggested from the
+// saved ones if autocomplete is true.
+func snippetNameOption(description string, autocomplete bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Name:         "name",
+		Description:  description,
+		Type:         discordgo.ApplicationCommandOptionString,
+		Required:     true,
+		Autocomplete: autocomplete,
+	}
+}
+
+// snippetAutocomplete suggests the names of the snippets of the user, or of
+// the tags of the guild.
+func snippetAutocomplete(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	typed := ""
+	if option, ok := commandOptions(i)["name"]; ok {
+		typed = strings.ToLower(option.StringValue())
+	}
+
+	names := snippets.Names(interactionUser(i).ID)
+	if i.ApplicationCommandData().Name == "tag" {
+		names = tags.Names(i.GuildID)
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, name := range names {
+		// Discord allows at most 25 choices.
+		if len(choices) == 25 {
+			break
+		}
+		if strings.Contains(name, typed) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  name,
+				Value: name,
+			})
+		}
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{
+				Choices: choices,
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to autocomplete interaction.")
+	}
+}
+
+// snippetName returns the name option of a snippet or tag, or an empty
+// string if it isn't a valid name, sending an ephemeral message.
+func snippetName(s Discord, i *discordgo.InteractionCreate) string {
+	name := strings.ToLower(strings.TrimSpace(commandOptions(i)["name"].StringValue()))
+	if !snippetNameRegex.MatchString(name) {
+		respondEphemeral(s, i, "Names can only have up to 32 lowercase letters, digits, dashes, and underscores.")
+		return ""
+	}
+	return name
+}
+
+// getSnippetCode returns the language and files of the message given in the
+// command options, or of the latest code message in the channel, as they
+// were posted. If there is no code to save, an error is sent and ok is
+// false.
+func getSnippetCode(w *ResponseWriter) (lang string, files []piston.File, ok bool) {
+	i := w.Interaction
+	options := commandOptions(i)
+
+	if option, ok := options["language"]; ok {
+		lang = resolveGuildLanguage(i.GuildID, option.StringValue())
+		if lang == "" {
+			w.Error(tr(i.Locale, "error.language_unsupported", option.StringValue(), getLanguages()))
+			return "", nil, false
+		}
+	}
+
+	var message *discordgo.Message
+	if option, ok := options["message"]; ok {
+		message, ok = getTargetMessage(w, option.StringValue(), lang)
+		if !ok {
+			return "", nil, false
+		}
+	} else {
+		messages, ok := getCodeMessages(w, lang)
+		if !ok {
+			return "", nil, false
+		}
+		message = messages[0]
+	}
+
+	// The code is saved as it was posted, and wrapped when it is run.
+	codeLang, files := getLanguageAndFilesFromMessage(message, i.GuildID)
+	if len(files) == 0 {
+		files = []piston.File{{Content: parseInlineCode(message.Content)}}
+	}
+	if lang == "" {
+		lang = codeLang
+	}
+	if lang == "" {
+		w.Error(tr(i.Locale, "error.no_language"))
+		return "", nil, false
+	}
+	if codeSize(files) > maxSnippetSize {
+		w.Error(fmt.Sprintf("Snippets can be at most %v KB.", maxSnippetSize/1024))
+		return "", nil, false
+	}
+
+	return lang, files, true
+}
+
+// runSnippet runs a snippet or tag.
+func runSnippet(ctx context.Context, s Discord, i *discordgo.InteractionCreate, snippet Snippet) {
+	// Check that the user is allowed to run code.
+	release, ok := acquireRun(s, i)
+	if !ok {
+		return
+	}
+	defer release()
+
+	w := NewResponseWriter(ctx, s, i)
+	if !w.Defer() {
+		return
+	}
+
+	lang, version, files, ok := checkCode(w, snippet.Language, snippet.Files, snippet.Language, "", guildLimits(i.GuildID))
+	if !ok {
+		return
+	}
+
+	// Execute the code and send the output.
+	runCode(w, lang, version, files, guildLimits(i.GuildID))
+}
+
+// snippetSaveHandler saves the latest code message in the channel, or the
+// given message, as a snippet of the user.
+func snippetSaveHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	name := snippetName(s, i)
+	if name == "" {
+		return
+	}
+
+	w := NewResponseWriter(ctx, s, i)
+	if !w.Defer() {
+		return
+	}
+
+	lang, files, ok := getSnippetCode(w)
+	if !ok {
+		return
+	}
+
+	err := snippets.Save(interactionUser(i).ID, name, Snippet{
+		Language: lang,
+		Files:    files,
+	})
+	if err != nil {
+		w.Error(fmt.Sprintf("Couldn't save the snippet: %v.", err))
+		return
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Content: fmt.Sprintf("Saved the %v snippet `%v`. Run it with `/snippet run %v`.", lang, name, name),
+	})
+}
+
+// snippetRunHandler runs a snippet of the user.
+func snippetRunHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	if i.GuildID == "" && !dmExecutionAllowed() {
+		respondEphemeral(s, i, tr(i.Locale, "error.dm_disabled"))
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(commandOptions(i)["name"].StringValue()))
+	snippet, ok := snippets.Get(interactionUser(i).ID, name)
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("You have no snippet named `%v`. Use `/snippet list` to see your snippets.", name))
+		return
+	}
+
+	runSnippet(ctx, s, i, snippet)
+}
+
+// snippetListHandler lists the snippets of the user.
+func snippetListHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	userID := interactionUser(i).ID
+	names := snippets.Names(userID)
+	if len(names) == 0 {
+		respondEphemeral(s, i, "You have no snippets. Save the latest code message with `/snippet save <name>`.")
+		return
+	}
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		snippet, _ := snippets.Get(userID, name)
+		lines = append(lines, fmt.Sprintf("`%v` %v, %v bytes", name, snippet.Language, codeSize(snippet.Files)))
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("**Your snippets (%v/%v)**\n%v", len(names), maxSnippets, strings.Join(lines, "\n")))
+}
+
+// snippetDeleteHandler deletes a snippet of the user.
+func snippetDeleteHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	name := strings.ToLower(strings.TrimSpace(commandOptions(i)["name"].StringValue()))
+
+	deleted, err := snippets.Delete(interactionUser(i).ID, name)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("snippet", name).
+			Msg("Error deleting snippet.")
+
+		respondEphemeral(s, i, tr(i.Locale, "error.internal"))
+		return
+	}
+	if !deleted {
+		respondEphemeral(s, i, fmt.Sprintf("You have no snippet named `%v`.", name))
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("Deleted the snippet `%v`.", name))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Number of users shown by /leaderboard.
+const leaderboardUsers = 10
+
+// UserStats are the statistics of a user in a guild.
+type UserStats struct {
+	UserID     string
+	Executions int
+	Successes  int
+	Duration   time.Duration // total duration of the executions
+	Languages  map[string]int
+	Challenges int // challenges submitted to
+	Solved     int // challenges with every test case passed
+	Score      int // test cases passed across every challenge
+}
+
+// SuccessRate returns the percentage of successful executions.
+func (u *UserStats) SuccessRate() float64 {
+	if u.Executions == 0 {
+		return 0
+	}
+	return float64(u.Successes) / float64(u.Executions) * 100
+}
+
+// guildStats collects the statistics of every user in a guild from the
+// execution history and the challenges.
+func guildStats(guildID string) map[string]*UserStats {
+	stats := make(map[string]*UserStats)
+	user := func(id string) *UserStats {
+		u, ok := stats[id]
+		if !ok {
+			u = &UserStats{
+				UserID:    id,
+				Languages: make(map[string]int),
+			}
+			stats[id] = u
+		}
+		return u
+	}
+
+	for _, e := range history.All() {
+		if e.GuildID != guildID {
+			continue
+		}
+		u := user(e.UserID)
+		u.Executions++
+		if e.Status == "success" {
+			u.Successes++
+		}
+		u.Duration += e.Duration
+		u.Languages[e.Language]++
+	}
+
+	guildChallenges := challenges.List(func(ch *Challenge) bool {
+		return ch.GuildID == guildID
+	})
+	for _, ch := range guildChallenges {
+		for id, sub := range ch.Submissions {
+			u := user(id)
+			u.Challenges++
+			u.Score += sub.Passed
+			if sub.Passed == len(ch.Cases) {
+				u.Solved++
+			}
+		}
+	}
+
+	return stats
+}
+
+// Stats command definition.
+var statsCommand = &discordgo.ApplicationCommand{
+	Name:        "stats",
+	Description: "Shows the statistics of a user in this server.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "user",
+			Description: "The user to show. Defaults to you.",
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Required:    false,
+		},
+	},
+}
+
+// Leaderboard command definition.
+var leaderboardCommand = &discordgo.ApplicationCommand{
+	Name:        "leaderboard",
+	Description: "Shows the top users in this server.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "by",
+			Description: "What to rank users by. Defaults to executions.",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{
+					Name:  "Executions",
+					Value: "executions",
+				},
+				{
+					Name:  "Challenge Score",
+					Value: "challenges",
+				},
+				{
+					Name:  "Tag Uses",
+					Value: "tags",
+				},
+			},
+		},
+	},
+}
+
+func statsHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	user := interactionUser(i)
+	data := i.ApplicationCommandData()
+	if option, ok := optionMap(data.Options)["user"]; ok {
+		user = option.UserValue(nil)
+		if data.Resolved != nil && data.Resolved.Users[user.ID] != nil {
+			user = data.Resolved.Users[user.ID]
+		}
+	}
+
+	u, ok := guildStats(i.GuildID)[user.ID]
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("<@%v> hasn't run any code here yet.", user.ID))
+		return
+	}
+
+	languages := "None"
+	if top := topCounts(u.Languages, 5); len(top) > 0 {
+		lines := make([]string, len(top))
+		for n, c := range top {
+			lines[n] = fmt.Sprintf("%v: %d", c.Key, c.Count)
+		}
+		languages = strings.Join(lines, "\n")
+	}
+
+	average := time.Duration(0)
+	if u.Executions > 0 {
+		average = u.Duration / time.Duration(u.Executions)
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Title:       "Stats",
+						Description: fmt.Sprintf("<@%v>", user.ID),
+						Thumbnail: &discordgo.MessageEmbedThumbnail{
+							URL: user.AvatarURL(""),
+						},
+						Fields: []*discordgo.MessageEmbedField{
+							{
+								Name:   "Executions",
+								Value:  fmt.Sprint(u.Executions),
+								Inline: true,
+							},
+							{
+								Name:   "Success Rate",
+								Value:  fmt.Sprintf("%.1f%%", u.SuccessRate()),
+								Inline: true,
+							},
+							{
+								Name:   "Average Duration",
+								Value:  average.Round(time.Millisecond).String(),
+								Inline: true,
+							},
+							{
+								Name:   "Challenges",
+								Value:  fmt.Sprintf("%d entered, %d solved", u.Challenges, u.Solved),
+								Inline: true,
+							},
+							{
+								Name:   "Challenge Score",
+								Value:  fmt.Sprint(u.Score),
+								Inline: true,
+							},
+							{
+								Name:  "Top Languages",
+								Value: languages,
+							},
+						},
+					},
+				},
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+func leaderboardHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	by := "executions"
+	if option, ok := optionMap(i.ApplicationCommandData().Options)["by"]; ok {
+		by = option.StringValue()
+	}
+
+	// Rank by the chosen statistic, breaking ties with the other one.
+	ranked := make([]*UserStats, 0)
+	for _, u := range guildStats(i.GuildID) {
+		ranked = append(ranked, u)
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		x, y := ranked[a], ranked[b]
+		if by == "challenges" && x.Score != y.Score {
+			return x.Score > y.Score
+		}
+		if x.Executions != y.Executions {
+			return x.Executions > y.Executions
+		}
+		if x.Score != y.Score {
+			return x.Score > y.Score
+		}
+		return x.UserID < y.UserID
+	})
+
+	title := "Leaderboard (Executions)"
+	if by == "challenges" {
+		title = "Leaderboard (Challenge Score)"
+	}
+
+	var lines []string
+	if by == "tags" {
+		title = "Leaderboard (Tag Uses)"
+		for n, c := range topCounts(tagUses(i.GuildID), leaderboardUsers) {
+			lines = append(lines, fmt.Sprintf("**%d.** `%v` used %d times", n+1, c.Key, c.Count))
+		}
+		ranked = nil
+	}
+
+	for n, u := range ranked {
+		if n == leaderboardUsers {
+			break
+		}
+		if by == "challenges" {
+			if u.Score == 0 {
+				break
+			}
+			lines = append(lines, fmt.Sprintf("**%d.** <@%v> %d points, %d solved", n+1, u.UserID, u.Score, u.Solved))
+		} else {
+			lines = append(lines, fmt.Sprintf("**%d.** <@%v> %d runs, %.0f%% successful", n+1, u.UserID, u.Executions, u.SuccessRate()))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "Nobody is on the leaderboard yet.")
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{
+					{
+						Title:       "🏆 " + title,
+						Description: strings.Join(lines, "\n"),
+					},
+				},
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Tag command definition.
+var tagCommand = &discordgo.ApplicationCommand{
+	Name:        "tag",
+	Description: "Shows and runs the examples saved by the staff of this server.",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Name:        "create",
+			Description: "Saves the latest code message, or the given message, as a tag of this server.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				snippetNameOption("The name of the tag, e.g. sorting-demo.", false),
+				{
+					Name:        "language",
+					Description: "The language of the code.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+				{
+					Name:        "message",
+					Description: "The link to or ID of the message to save, instead of the latest code message.",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "show",
+			Description: "Posts the code of a tag, with a button to run it.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				snippetNameOption("The name of the tag.", true),
+			},
+		},
+		{
+			Name:        "run",
+			Description: "Runs a tag.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				snippetNameOption("The name of the tag.", true),
+			},
+		},
+		{
+			Name:        "list",
+			Description: "Lists the tags of this server and how often they were used.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+		},
+		{
+			Name:        "delete",
+			Description: "Deletes a tag of this server.",
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				snippetNameOption("The name of the tag.", true),
+			},
+		},
+	},
+}
+
+func tagHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	cmd := i.ApplicationCommandData().Options[0]
+	switch cmd.Name {
+	case "create":
+		tagCreateHandler(ctx, s, i)
+	case "show":
+		tagShowHandler(ctx, s, i)
+	case "run":
+		tagRunHandler(ctx, s, i)
+	case "list":
+		tagListHandler(ctx, s, i)
+	case "delete":
+		tagDeleteHandler(ctx, s, i)
+	}
+}
+
+// getTag returns a tag of the guild of an interaction, counting its use. If
+// it doesn't exist, an ephemeral message is sent and ok is false.
+func getTag(s Discord, i *discordgo.InteractionCreate) (name string, tag Snippet, ok bool) {
+	name = strings.ToLower(strings.TrimSpace(commandOptions(i)["name"].StringValue()))
+	tag, ok = tags.Get(i.GuildID, name)
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("This server has no tag named `%v`. Use `/tag list` to see its tags.", name))
+		return "", Snippet{}, false
+	}
+
+	err := tags.Use(i.GuildID, name)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("guild_id", i.GuildID).
+			Str("tag", name).
+			Msg("Error counting use of tag.")
+	}
+
+	return name, tag, true
+}
+
+// tagCreateHandler saves the latest code message in the channel, or the
+// given message, as a tag of the guild.
+func tagCreateHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	if !canManageGuild(i) {
+		respondEphemeral(s, i, "You need the Manage Server permission to create tags.")
+		return
+	}
+
+	name := snippetName(s, i)
+	if name == "" {
+		return
+	}
+
+	w := NewResponseWriter(ctx, s, i)
+	if !w.Defer() {
+		return
+	}
+
+	lang, files, ok := getSnippetCode(w)
+	if !ok {
+		return
+	}
+
+	err := tags.Save(i.GuildID, name, Snippet{
+		Language:  lang,
+		Files:     files,
+		CreatedBy: interactionUser(i).ID,
+	})
+	if err != nil {
+		w.Error(fmt.Sprintf("Couldn't save the tag: %v.", err))
+		return
+	}
+
+	w.Send(&discordgo.WebhookParams{
+		Content: fmt.Sprintf("Saved the %v tag `%v`. Anyone can show it with `/tag show %v` or run it with `/tag run %v`.", lang, name, name, name),
+	})
+}
+
+// tagShowHandler posts the code of a tag, with a button to run it.
+func tagShowHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	name, tag, ok := getTag(s, i)
+	if !ok {
+		return
+	}
+
+	blocks := make([]string, len(tag.Files))
+	for n, f := range tag.Files {
+		blocks[n] = "```" + tag.Language + "\n" + strings.TrimRight(f.Content, "\n") + "\n```"
+	}
+	content := fmt.Sprintf("**%v**\n%v", name, strings.Join(blocks, "\n"))
+	if len(content) > messageLimit {
+		respondEphemeral(s, i, fmt.Sprintf("The tag `%v` is too long to show. Run it with `/tag run %v` instead.", name, name))
+		return
+	}
+
+	err := s.InteractionRespond(
+		i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.Button{
+								Label:    "Run it",
+								Style:    discordgo.PrimaryButton,
+								CustomID: "example_run",
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error responding to interaction.")
+	}
+}
+
+// tagRunHandler runs a tag.
+func tagRunHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	_, tag, ok := getTag(s, i)
+	if !ok {
+		return
+	}
+
+	runSnippet(ctx, s, i, tag)
+}
+
+// tagListHandler lists the tags of the guild.
+func tagListHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	names := tags.Names(i.GuildID)
+	if len(names) == 0 {
+		respondEphemeral(s, i, "This server has no tags yet. Server managers can create them with `/tag create <name>`.")
+		return
+	}
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		tag, _ := tags.Get(i.GuildID, name)
+		lines = append(lines, fmt.Sprintf("`%v` %v, used %d times", name, tag.Language, tag.Uses))
+	}
+
+	respondEphemeral(s, i, truncate(fmt.Sprintf("**Tags (%v/%v)**\n%v", len(names), maxTags, strings.Join(lines, "\n")), messageLimit))
+}
+
+// tagDeleteHandler deletes a tag of the guild.
+func tagDeleteHandler(ctx context.Context, s Discord, i *discordgo.InteractionCreate) {
+	if !canManageGuild(i) {
+		respondEphemeral(s, i, "You need the Manage Server permission to delete tags.")
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(commandOptions(i)["name"].StringValue()))
+
+	deleted, err := tags.Delete(i.GuildID, name)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("guild_id", i.GuildID).
+			Str("tag", name).
+			Msg("Error deleting tag.")
+
+		respondEphemeral(s, i, tr(i.Locale, "error.internal"))
+		return
+	}
+	if !deleted {
+		respondEphemeral(s, i, fmt.Sprintf("This server has no tag named `%v`.", name))
+		return
+	}
+
+	respondEphemeral(s, i, fmt.Sprintf("Deleted the tag `%v`.", name))
+}
+
+// tagUses returns how many times each tag of a guild was used, by name.
+func tagUses(guildID string) map[string]int {
+	uses := make(map[string]int)
+	for _, name := range tags.Names(guildID) {
+		if tag, ok := tags.Get(guildID, name); ok && tag.Uses > 0 {
+			uses[name] = tag.Uses
+		}
+	}
+	return uses
+}
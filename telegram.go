@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Base URL of the Telegram Bot API.
+const telegramAPIURL = "https://api.telegram.org/bot"
+
+// How long a request for updates waits for one to arrive.
+const telegramPollTimeout = 50 * time.Second
+
+var telegramClient = &http.Client{
+	Timeout: telegramPollTimeout + 10*time.Second,
+}
+
+// TelegramAdapter runs code from Telegram chats, receiving the /run command
+// by long polling, so the bot doesn't need to be reachable from the internet.
+type TelegramAdapter struct {
+	Token string
+
+	username string // of the bot, which can follow commands in groups
+}
+
+func (a *TelegramAdapter) Name() string {
+	return "telegram"
+}
+
+// telegramMessage is a message in a Telegram chat.
+type telegramMessage struct {
+	MessageID int `json:"message_id"`
+	From      *struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text           string           `json:"text"`
+	Entities       []telegramEntity `json:"entities"`
+	ReplyToMessage *telegramMessage `json:"reply_to_message"`
+}
+
+// telegramEntity is formatting of a part of the text of a message. Offsets
+// and lengths are in UTF-16 code units.
+type telegramEntity struct {
+	Type     string `json:"type"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	Language string `json:"language"` // of a pre entity
+}
+
+// fencedText returns the text of a message with its code blocks fenced
+// again, since Telegram removes the fences and keeps them as entities.
+func (m *telegramMessage) fencedText() string {
+	units := utf16.Encode([]rune(m.Text))
+
+	var b strings.Builder
+	last := 0
+	for _, e := range m.Entities {
+		if e.Type != "pre" || e.Offset < last || e.Offset+e.Length > len(units) {
+			continue
+		}
+		b.WriteString(string(utf16.Decode(units[last:e.Offset])))
+		b.WriteString("\n```" + e.Language + "\n" + string(utf16.Decode(units[e.Offset:e.Offset+e.Length])) + "\n```\n")
+		last = e.Offset + e.Length
+	}
+	b.WriteString(string(utf16.Decode(units[last:])))
+
+	return b.String()
+}
+
+// telegramUpdate is an event received from Telegram.
+type telegramUpdate struct {
+	UpdateID int              `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+// call calls a method of the Bot API, decoding its result into v.
+func (a *TelegramAdapter) call(ctx context.Context, method string, params interface{}, v interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", telegramAPIURL+a.Token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return redactTelegramURL(method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := telegramClient.Do(req)
+	if err != nil {
+		return redactTelegramURL(method, err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if !response.OK {
+		return fmt.Errorf("Telegram responded with %v", response.Description)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, v)
+}
+
+// redactTelegramURL removes the URL of a request from its error, since it
+// contains the token of the bot.
+func redactTelegramURL(method string, err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%v %v: %w", urlErr.Op, method, urlErr.Err)
+	}
+	return err
+}
+
+// Start polls for messages in the background. It doesn't add endpoints to
+// the HTTP server.
+func (a *TelegramAdapter) Start(_ *http.ServeMux) {
+	var me struct {
+		Username string `json:"username"`
+	}
+	err := a.call(shutdown.Context(), "getMe", struct{}{}, &me)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Error connecting to Telegram.")
+	}
+	a.username = me.Username
+
+	log.Info().
+		Str("username", a.username).
+		Msg("Polling Telegram for messages.")
+
+	go a.poll()
+}
+
+// poll receives updates until the bot starts shutting down, waiting before
+// retrying after an error.
+func (a *TelegramAdapter) poll() {
+	ctx := shutdown.Context()
+
+	offset := 0
+	for ctx.Err() == nil {
+		var updates []telegramUpdate
+		err := a.call(ctx, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         int(telegramPollTimeout.Seconds()),
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error getting updates from Telegram.")
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message != nil {
+				a.handleMessage(u.Message)
+			}
+		}
+	}
+}
+
+// commandText returns the text following the /run command in a message, or
+// false if the message isn't the command. In groups, the command can be
+// followed by the username of the bot, e.g. /run@CodeRunnerBot.
+func (a *TelegramAdapter) commandText(text string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	command := fields[0]
+	if command != "/run" && command != "/run@"+a.username {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(text, command)), true
+}
+
+// handleMessage runs the code of a /run command. The code follows the
+// command, or is the message the command replies to.
+func (a *TelegramAdapter) handleMessage(m *telegramMessage) {
+	text, ok := a.commandText(m.fencedText())
+	if !ok || m.From == nil {
+		return
+	}
+
+	// A language can be given with the command for a replied to message.
+	if m.ReplyToMessage != nil && len(parseCodeBlocks(text)) == 0 && len(strings.Fields(text)) <= 1 {
+		text = strings.TrimSpace(text + "\n" + m.ReplyToMessage.fencedText())
+	}
+
+	if !shutdown.Begin() {
+		return
+	}
+
+	go func() {
+		defer shutdown.Done()
+		defer recoverEvent("telegram")
+
+		reply := runChatCode(context.Background(), ChatRun{
+			Platform: a.Name(),
+			UserID:   strconv.FormatInt(m.From.ID, 10),
+			GroupID:  strconv.FormatInt(m.Chat.ID, 10),
+			Text:     text,
+		})
+
+		err := a.send(m, reply)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error replying on Telegram.")
+		}
+	}()
+}
+
+// send replies to a message. The reply is sent as Markdown, or as plain text
+// if Telegram can't parse it. Replies are still sent while shutting down, but
+// give up once the bot would have stopped waiting for them.
+func (a *TelegramAdapter) send(m *telegramMessage, text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	params := map[string]interface{}{
+		"chat_id":             m.Chat.ID,
+		"text":                text,
+		"parse_mode":          "Markdown",
+		"reply_to_message_id": m.MessageID,
+	}
+
+	err := a.call(ctx, "sendMessage", params, nil)
+	if err == nil || !strings.Contains(err.Error(), "can't parse entities") {
+		return err
+	}
+
+	delete(params, "parse_mode")
+	return a.call(ctx, "sendMessage", params, nil)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// Template wraps code without boilerplate, such as bare statements, in a
+// complete program so it can be run.
+type Template struct {
+	// Code matching this pattern is already a complete program and isn't wrapped.
+	Skip string `json:"skip"`
+	// Program the code is put in, in place of {{code}}. An empty wrap disables
+	// the template of a language.
+	Wrap string `json:"wrap"`
+
+	skip *regexp.Regexp
+}
+
+// Templates of the languages whose programs need boilerplate.
+var defaultTemplates = map[string]Template{
+	"c": {
+		Skip: `\bmain\s*\(`,
+		Wrap: "#include <stdio.h>\n#include <stdlib.h>\n#include <string.h>\n\nint main(void) {\n{{code}}\nreturn 0;\n}\n",
+	},
+	"c++": {
+		Skip: `\bmain\s*\(`,
+		Wrap: "#include <bits/stdc++.h>\nusing namespace std;\n\nint main() {\n{{code}}\nreturn 0;\n}\n",
+	},
+	"java": {
+		Skip: `\b(class|interface|enum|record)\s+\w+`,
+		Wrap: "import java.util.*;\n\npublic class Main {\npublic static void main(String[] args) throws Exception {\n{{code}}\n}\n}\n",
+	},
+	"csharp": {
+		Skip: `\b(class|struct|interface)\s+\w+`,
+		Wrap: "using System;\nusing System.Collections.Generic;\nusing System.Linq;\n\npublic class Program {\npublic static void Main(string[] args) {\n{{code}}\n}\n}\n",
+	},
+	"rust": {
+		Skip: `\bfn\s+main\s*\(`,
+		Wrap: "fn main() {\n{{code}}\n}\n",
+	},
+}
+
+// Templates used to wrap code, by language.
+var templates map[string]Template
+
+// loadTemplates loads the default templates, replaced by the templates in a
+// JSON file if a path is given.
+func loadTemplates(path string) (map[string]Template, error) {
+	loaded := make(map[string]Template, len(defaultTemplates))
+	for lang, t := range defaultTemplates {
+		loaded[lang] = t
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var custom map[string]Template
+		err = json.Unmarshal(data, &custom)
+		if err != nil {
+			return nil, err
+		}
+
+		for lang, t := range custom {
+			lang = strings.ToLower(lang)
+			if t.Wrap == "" {
+				delete(loaded, lang)
+				continue
+			}
+			loaded[lang] = t
+		}
+	}
+
+	for lang, t := range loaded {
+		if t.Skip != "" {
+			skip, err := regexp.Compile(t.Skip)
+			if err != nil {
+				return nil, err
+			}
+			t.skip = skip
+		}
+		loaded[lang] = t
+	}
+
+	return loaded, nil
+}
+
+// applyTemplate wraps the file that is run in the template of its language,
+// unless it is already a complete program.
+func applyTemplate(lang string, files []piston.File) []piston.File {
+	settingsMu.RLock()
+	t, ok := templates[lang]
+	settingsMu.RUnlock()
+
+	if !ok || len(files) == 0 || (t.skip != nil && t.skip.MatchString(files[0].Content)) {
+		return files
+	}
+
+	wrapped := append([]piston.File(nil), files...)
+	wrapped[0].Content = strings.ReplaceAll(t.Wrap, "{{code}}", files[0].Content)
+	return wrapped
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// What signals that commonly stop programs mean, by signal name.
+var signalDescriptions = map[string]string{
+	"SIGSEGV": "crashed accessing memory it shouldn't (segmentation fault)",
+	"SIGBUS":  "crashed accessing memory it shouldn't (bus error)",
+	"SIGABRT": "aborted, e.g. on a failed assertion",
+	"SIGFPE":  "crashed on an arithmetic error, like dividing by zero",
+	"SIGILL":  "crashed on an illegal instruction",
+	"SIGXCPU": "used more CPU time than it is allowed",
+	"SIGXFSZ": "wrote a file larger than it is allowed",
+	"SIGPIPE": "wrote to a closed pipe",
+}
+
+// Share of the memory limit a program killed by SIGKILL must have used to be
+// considered out of memory.
+const outOfMemoryShare = 0.9
+
+// terminationMessage explains why the program, or the compiler if the code
+// didn't compile, was stopped, e.g. "Your program exceeded the 3s time
+// limit." It is empty if it exited on its own.
+func terminationMessage(result *piston.ExecuteResponse, limits Limits) string {
+	stage, who := result.Run, "Your program"
+	timeout, memoryLimit := limits.RunTimeout, limits.RunMemoryLimit
+	if result.Compile != nil && result.Compile.Code != 0 {
+		stage, who = *result.Compile, "The compiler"
+		timeout, memoryLimit = limits.CompileTimeout, limits.CompileMemoryLimit
+	}
+
+	switch {
+	case stage.Status == "TO":
+		if timeout > 0 {
+			return fmt.Sprintf("%v exceeded the %v time limit.", who, time.Duration(timeout)*time.Millisecond)
+		}
+		return who + " took too long and was stopped."
+	case stage.Status == "OL" || stage.Status == "EL":
+		return who + " printed too much output and was stopped."
+	case stage.Signal == "SIGKILL":
+		outOfMemory := strings.Contains(strings.ToLower(stage.Message), "memory") ||
+			(memoryLimit > 0 && float64(stage.Memory) >= outOfMemoryShare*float64(memoryLimit))
+		if outOfMemory && memoryLimit > 0 {
+			return fmt.Sprintf("%v ran out of memory, exceeding the %.0f MB limit.", who, float64(memoryLimit)/1e6)
+		}
+		if outOfMemory {
+			return who + " ran out of memory."
+		}
+		return who + " was killed, usually for using too much memory or time."
+	case stage.Signal != "":
+		if description, ok := signalDescriptions[stage.Signal]; ok {
+			return fmt.Sprintf("%v %v (%v).", who, description, stage.Signal)
+		}
+		return fmt.Sprintf("%v was stopped by %v.", who, stage.Signal)
+	}
+
+	return ""
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// getChannel returns a channel from the state of the session if it is there,
+// or from Discord otherwise.
+func getChannel(s Discord, channelID string) (*discordgo.Channel, error) {
+	if session, ok := s.(*discordgo.Session); ok && session.State != nil {
+		if channel, err := session.State.Channel(channelID); err == nil {
+			return channel, nil
+		}
+	}
+	return s.Channel(channelID)
+}
+
+// getThread returns a channel if it is a thread or a forum post, or nil
+// otherwise.
+func getThread(s Discord, channelID string) *discordgo.Channel {
+	if channelID == "" {
+		return nil
+	}
+
+	channel, err := getChannel(s, channelID)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("channel_id", channelID).
+			Msg("Error getting channel.")
+		return nil
+	}
+
+	if !channel.IsThread() {
+		return nil
+	}
+	return channel
+}
+
+// threadParent returns the channel a thread or forum post is in, or an empty
+// string if the channel isn't a thread.
+func threadParent(s Discord, channelID string) string {
+	if thread := getThread(s, channelID); thread != nil {
+		return thread.ParentID
+	}
+	return ""
+}
+
+// resolveStarterMessage returns the message a thread was started from in
+// place of the message marking the start of the thread, which has no
+// content. Other messages are returned as they are.
+func resolveStarterMessage(s Discord, m *discordgo.Message) *discordgo.Message {
+	if m.Type != discordgo.MessageTypeThreadStarterMessage || m.MessageReference == nil {
+		return m
+	}
+	if m.ReferencedMessage != nil {
+		return m.ReferencedMessage
+	}
+
+	starter, err := s.ChannelMessage(m.MessageReference.ChannelID, m.MessageReference.MessageID)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("channel_id", m.MessageReference.ChannelID).
+			Str("message_id", m.MessageReference.MessageID).
+			Msg("Error getting thread starter message.")
+		return m
+	}
+	return starter
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Windows of time that /admin usage can summarize, by option value.
+var usageWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+// Maximum number of days listed in the usage embed.
+const usageMaxDays = 14
+
+// Size of the usage chart, in pixels.
+const (
+	usageChartWidth  = 600
+	usageChartHeight = 200
+)
+
+// Options of /admin usage.
+var usageOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Name:        "window",
+		Description: "The time to summarize. Defaults to the last week.",
+		Type:        discordgo.ApplicationCommandOptionString,
+		Required:    false,
+		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{Name: "Last day", Value: "day"},
+			{Name: "Last week", Value: "week"},
+			{Name: "Last 30 days", Value: "month"},
+			{Name: "All time", Value: "all"},
+		},
+	},
+	{
+		Name:        "chart",
+		Description: "Attach a chart of the executions per day.",
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Required:    false,
+	},
+}
+
+// usageDay is the number of executions on a day.
+type usageDay struct {
+	Day   time.Time
+	Count int
+}
+
+// Usage summarizes the executions in a window of time.
+type Usage struct {
+	Executions int
+	Failures   int // code that didn't run successfully
+	Errors     int // code that couldn't be run
+	Duration   time.Duration
+	Languages  map[string]int
+	Users      map[string]int
+	Days       []usageDay // oldest first, including days without executions
+}
+
+// collectUsage summarizes the executions in the history since a time.
+func collectUsage(since time.Time) *Usage {
+	u := &Usage{
+		Languages: make(map[string]int),
+		Users:     make(map[string]int),
+	}
+
+	perDay := make(map[time.Time]int)
+	var first time.Time
+	for _, e := range history.All() {
+		if e.Created.Before(since) {
+			continue
+		}
+
+		u.Executions++
+		u.Duration += e.Duration
+		u.Languages[e.Language]++
+		u.Users[e.UserID]++
+		switch e.Status {
+		case "success":
+		case "error":
+			u.Errors++
+		default:
+			u.Failures++
+		}
+
+		day := e.Created.UTC().Truncate(24 * time.Hour)
+		perDay[day]++
+		if first.IsZero() || day.Before(first) {
+			first = day
+		}
+	}
+
+	if u.Executions == 0 {
+		return u
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for day := first; !day.After(today); day = day.Add(24 * time.Hour) {
+		u.Days = append(u.Days, usageDay{day, perDay[day]})
+	}
+
+	return u
+}
+
+// usageEmbed renders a usage summary.
+func usageEmbed(u *Usage, title string) *discordgo.MessageEmbed {
+	if u.Executions == 0 {
+		return &discordgo.MessageEmbed{
+			Title:       title,
+			Description: "No code has been run in this time.",
+		}
+	}
+
+	percent := func(n int) string {
+		return fmt.Sprintf("%.1f%%", float64(n)/float64(u.Executions)*100)
+	}
+
+	var languages strings.Builder
+	for _, c := range topCounts(u.Languages, 5) {
+		fmt.Fprintf(&languages, "%v: %d\n", c.Key, c.Count)
+	}
+
+	var users strings.Builder
+	for _, c := range topCounts(u.Users, 5) {
+		fmt.Fprintf(&users, "<@%v>: %d\n", c.Key, c.Count)
+	}
+
+	var days strings.Builder
+	shown := u.Days
+	if len(shown) > usageMaxDays {
+		shown = shown[len(shown)-usageMaxDays:]
+	}
+	for _, d := range shown {
+		fmt.Fprintf(&days, "%v: %d\n", d.Day.Format("2006-01-02"), d.Count)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: title,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Executions",
+				Value:  fmt.Sprint(u.Executions),
+				Inline: true,
+			},
+			{
+				Name:   "Users",
+				Value:  fmt.Sprint(len(u.Users)),
+				Inline: true,
+			},
+			{
+				Name:   "Average Latency",
+				Value:  (u.Duration / time.Duration(u.Executions)).Round(time.Millisecond).String(),
+				Inline: true,
+			},
+			{
+				Name:   "Failure Rate",
+				Value:  percent(u.Failures),
+				Inline: true,
+			},
+			{
+				Name:   "Error Rate",
+				Value:  percent(u.Errors),
+				Inline: true,
+			},
+			{
+				Name:  "Top Languages",
+				Value: languages.String(),
+			},
+			{
+				Name:  "Top Users",
+				Value: users.String(),
+			},
+			{
+				Name:  "Executions per Day (UTC)",
+				Value: days.String(),
+			},
+		},
+	}
+}
+
+// usageChart draws a bar chart of the executions per day as a PNG image.
+func usageChart(days []usageDay) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, usageChartWidth, usageChartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0x2f, 0x31, 0x36, 0xff}}, image.Point{}, draw.Src)
+
+	max := 0
+	for _, d := range days {
+		if d.Count > max {
+			max = d.Count
+		}
+	}
+
+	if len(days) > 0 && max > 0 {
+		const padding = 10
+		width := (usageChartWidth - padding) / len(days)
+		height := usageChartHeight - 2*padding
+		bar := &image.Uniform{color.RGBA{0x58, 0x65, 0xf2, 0xff}}
+
+		for n, d := range days {
+			top := usageChartHeight - padding - d.Count*height/max
+			rect := image.Rect(padding+n*width, top, padding+(n+1)*width-1, usageChartHeight-padding)
+			draw.Draw(img, rect, bar, image.Point{}, draw.Src)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// adminUsageHandler shows the usage of the bot over a window of time.
+func adminUsageHandler(s Discord, i *discordgo.InteractionCreate, cmd *discordgo.ApplicationCommandInteractionDataOption) {
+	options := optionMap(cmd.Options)
+
+	window := "week"
+	if option, ok := options["window"]; ok {
+		window = option.StringValue()
+	}
+
+	var since time.Time
+	title := "Usage (all time)"
+	if d := usageWindows[window]; d != 0 {
+		since = time.Now().Add(-d)
+		title = fmt.Sprintf("Usage (last %v)", window)
+	}
+
+	u := collectUsage(since)
+	params := &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{usageEmbed(u, title)},
+		Flags:  discordgo.MessageFlagsEphemeral,
+	}
+
+	if option, ok := options["chart"]; ok && option.BoolValue() && u.Executions > 0 {
+		chart, err := usageChart(u.Days)
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("Error drawing usage chart.")
+		} else {
+			params.Files = []*discordgo.File{
+				{
+					Name:        "usage.png",
+					ContentType: "image/png",
+					Reader:      bytes.NewReader(chart),
+				},
+			}
+			params.Embeds[0].Image = &discordgo.MessageEmbedImage{
+				URL: "attachment://usage.png",
+			}
+		}
+	}
+
+	_, err := s.FollowupMessageCreate(i.Interaction, false, params)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Error sending followup message.")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Nathan13888/DiscordCodeRunner/v2/pkg/piston"
+)
+
+// WASIExecutor runs code locally with interpreters compiled to WebAssembly,
+// so no execution service is needed. Each interpreter is a module in the
+// modules directory named <language>-<version>.wasm, e.g. python-3.11.wasm,
+// which is given the path of the main file as its argument.
+type WASIExecutor struct {
+	Runtime    string // WebAssembly runtime binary, e.g. wasmtime
+	ModulesDir string
+}
+
+func NewWASIExecutor(runtime string, modulesDir string) *WASIExecutor {
+	return &WASIExecutor{
+		Runtime:    runtime,
+		ModulesDir: modulesDir,
+	}
+}
+
+func (w *WASIExecutor) Runtimes(ctx context.Context) ([]piston.Runtime, error) {
+	entries, err := os.ReadDir(w.ModulesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var runtimes []piston.Runtime
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".wasm")
+		if e.IsDir() || name == e.Name() {
+			continue
+		}
+
+		parts := strings.SplitN(name, "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		runtimes = append(runtimes, piston.Runtime{
+			Language: parts[0],
+			Version:  parts[1],
+		})
+	}
+
+	return runtimes, nil
+}
+
+func (w *WASIExecutor) Execute(ctx context.Context, req piston.ExecuteRequest) (*piston.ExecuteResponse, error) {
+	module := filepath.Join(w.ModulesDir, req.Language+"-"+req.Version+".wasm")
+	if _, err := os.Stat(module); err != nil {
+		return nil, fmt.Errorf("no WASI module for %v %v: %w", req.Language, req.Version, piston.ErrUnsupportedLanguage)
+	}
+	if len(req.Dependencies) > 0 {
+		return nil, fmt.Errorf("the WASI executor can't install dependencies: %w", piston.ErrUnsupportedFeature)
+	}
+
+	// Write the files to a directory shared with the module.
+	dir, err := os.MkdirTemp("", "coderunner-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	for n, f := range req.Files {
+		name := f.Name
+		if name == "" {
+			name = fmt.Sprintf("file%d", n)
+		}
+		if filepath.Base(name) != name {
+			return nil, errors.New("invalid file name " + name)
+		}
+
+		err := os.WriteFile(filepath.Join(dir, name), []byte(f.Content), 0o600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	main := req.Files[0].Name
+	if main == "" {
+		main = "file0"
+	}
+
+	timeout := time.Duration(req.RunTimeout) * time.Millisecond
+	if timeout == 0 {
+		timeout = PISTON_TIMEOUT
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := []string{"run", "--dir=" + dir + "::/code"}
+	if req.RunMemoryLimit > 0 {
+		args = append(args, fmt.Sprintf("-Wmax-memory-size=%d", req.RunMemoryLimit))
+	}
+	for name, value := range req.Env {
+		args = append(args, "--env="+name+"="+value)
+	}
+	args = append(args, module, "/code/"+main)
+	args = append(args, req.Args...)
+
+	// Modules printing more than MAX_OUTPUT_SIZE are stopped.
+	capture := newOutputCapture(MAX_OUTPUT_SIZE, cancel)
+	cmd := exec.CommandContext(runCtx, w.Runtime, args...)
+	cmd.Stdin = strings.NewReader(req.Stdin)
+	cmd.Stdout = capture.Stdout()
+	cmd.Stderr = capture.Stderr()
+
+	start := time.Now()
+	err = cmd.Run()
+	duration := time.Since(start)
+
+	res := &piston.ExecuteResponse{
+		Language: req.Language,
+		Version:  req.Version,
+		Duration: duration,
+		Run: piston.ExecuteResults{
+			WallTime: int(duration.Milliseconds()),
+		},
+	}
+	capture.fill(&res.Run)
+
+	var exitErr *exec.ExitError
+	switch {
+	case res.Run.Status == "OL":
+		res.Run.Signal = "SIGKILL"
+	case runCtx.Err() == context.DeadlineExceeded:
+		res.Run.Status = "TO"
+		res.Run.Signal = "SIGKILL"
+	case errors.As(err, &exitErr):
+		res.Run.Code = exitErr.ExitCode()
+	case err != nil:
+		return nil, err
+	}
+
+	// The runtime reports the resources used by the module and itself.
+	if cmd.ProcessState != nil {
+		res.Run.CPUTime = int((cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()).Milliseconds())
+		res.Run.Memory = peakMemory(cmd.ProcessState)
+	}
+
+	return res, nil
+}